@@ -2,20 +2,23 @@ package adapter
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"user-service/model"
 )
 
 type HydraAdapter struct {
 	hydraEndpoint string
+	hydraVersion  string
+	client        *hydraClient
 }
 
-// NewHydraAdapter creates new Instance of Adapter Service
+// NewHydraAdapter creates new Instance of Adapter Service, HYDRA_VERSION selects the admin api (v1, v2 or auto)
 func NewHydraAdapter() HydraAdapter {
 	hydraEndpoint := os.Getenv("HYDRA_URL")
 	if hydraEndpoint == "" {
@@ -23,85 +26,152 @@ func NewHydraAdapter() HydraAdapter {
 	}
 	return HydraAdapter{
 		hydraEndpoint: hydraEndpoint,
+		hydraVersion:  os.Getenv("HYDRA_VERSION"),
+		client:        defaultClient(),
 	}
 
 }
 
+func (a *HydraAdapter) version() apiVersion {
+	return resolveVersion(a.hydraEndpoint, a.hydraVersion)
+}
+
 // ReadChallenge fetch data from Challgnge
-func (a *HydraAdapter) ReadChallenge(loginChallenge, challengeMethod string) (challengeBody model.LoginChallenge, err error) {
-	headers := map[string][]string{
-		"Accept": {"application/json"},
+func (a *HydraAdapter) ReadChallenge(ctx context.Context, loginChallenge, challengeMethod string) (challengeBody model.LoginChallenge, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s?%s_challenge=%s", a.hydraEndpoint, a.version().requestPath(challengeMethod, ""), challengeMethod, url.QueryEscape(loginChallenge)), nil)
+	if err != nil {
+		log.Print(err)
+		return
 	}
+	req.Header.Set("Accept", "application/json")
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/oauth2/auth/requests/%s?%s_challenge=%s", a.hydraEndpoint, challengeMethod, challengeMethod, loginChallenge), nil)
+	body, err := a.client.do(ctx, req)
 	if err != nil {
 		log.Print(err)
 		return
 	}
-	req.Header = headers
+	err = json.Unmarshal(body, &challengeBody)
+	if err != nil {
+		log.Print(err)
+	}
+	return
+}
 
-	client := &http.Client{}
-	res, err := client.Do(req)
+// SendRejectBody used to reqject requests for login, logout or consent
+func (a *HydraAdapter) SendRejectBody(ctx context.Context, method, challenge string, rawJson []byte) (redirectUrl string, err error) {
+	return a.sendRequest(ctx, fmt.Sprintf("%s%s?%s_challenge=%s", a.hydraEndpoint, a.version().requestPath(method, "reject"), method, url.QueryEscape(challenge)), rawJson)
+}
 
-	body, err := ioutil.ReadAll(res.Body)
+// SendAcceptBody used to accept requests
+func (a *HydraAdapter) SendAcceptBody(ctx context.Context, method, challenge string, rawJson []byte) (redirectUrl string, err error) {
+	return a.sendRequest(ctx, fmt.Sprintf("%s%s?%s_challenge=%s", a.hydraEndpoint, a.version().requestPath(method, "accept"), method, url.QueryEscape(challenge)), rawJson)
+}
 
-	var challangeBody model.LoginChallenge
+// AcceptUserCode accepts the user code of a device challenge, hydra redirects to the login of the device authorization.
+// The device flow needs hydra v2.3 or later
+func (a *HydraAdapter) AcceptUserCode(ctx context.Context, deviceChallenge, userCode string) (redirectUrl string, err error) {
+	if a.version().name != HydraV2 {
+		return "", ErrUnsupportedVersion
+	}
+	rawJson, err := json.Marshal(model.AcceptUserCode{UserCode: userCode})
+	if err != nil {
+		return
+	}
+	return a.SendAcceptBody(ctx, "device", deviceChallenge, rawJson)
+}
 
-	err = json.Unmarshal(body, &challangeBody)
+func (a *HydraAdapter) sendRequest(ctx context.Context, requestURL string, rawJson []byte) (redirectUrl string, err error) {
+	req, err := http.NewRequest("PUT", requestURL, bytes.NewBuffer(rawJson))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
 
+	body, err := a.client.do(ctx, req)
 	if err != nil {
 		log.Print(err)
 		return
 	}
-
-	res.Body.Close()
-	return challangeBody, err
+	var redirect model.Redirect
+	if err = json.Unmarshal(body, &redirect); err != nil {
+		log.Print(err)
+		return
+	}
+	return redirect.RedirectURL, nil
 }
 
-// SendRejectBody used to reqject requests for login, logout or consent
-func (a *HydraAdapter) SendRejectBody(method, challenge string, rawJson []byte) (redirectUrl string, err error) {
-	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/oauth2/auth/requests/%s/reject?%s_challenge=%s", a.hydraEndpoint, method, method, challenge), bytes.NewBuffer(rawJson))
+// ListConsentSessions returns all remembered consents of a subject
+func (a *HydraAdapter) ListConsentSessions(ctx context.Context, subject string) (consentSessions []model.ConsentSession, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s?subject=%s", a.hydraEndpoint, a.version().consentSessionsPath(), url.QueryEscape(subject)), nil)
 	if err != nil {
 		log.Println(err)
+		return
 	}
-	return sendRequest(req)
-}
+	req.Header.Set("Accept", "application/json")
 
-// SendAcceptBody used to accept requests
-func (a *HydraAdapter) SendAcceptBody(method, challenge string, rawJson []byte) (redirectUrl string, err error) {
-	headers := map[string][]string{
-		"Accept":       {"application/json"},
-		"Content-Type": {"application/json"},
+	body, err := a.client.do(ctx, req)
+	if err != nil {
+		return
 	}
+	consentSessions = make([]model.ConsentSession, 0)
+	err = json.Unmarshal(body, &consentSessions)
+	return
+}
 
-	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/oauth2/auth/requests/%s/accept?%s_challenge=%s", a.hydraEndpoint, method, method, challenge), bytes.NewBuffer(rawJson))
+// RevokeConsentSessions revokes the consents of a subject for one client or for all clients if clientID is empty
+func (a *HydraAdapter) RevokeConsentSessions(ctx context.Context, subject, clientID string) error {
+	query := url.Values{}
+	query.Set("subject", subject)
+	if clientID != "" {
+		query.Set("client", clientID)
+	} else {
+		query.Set("all", "true")
+	}
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s%s?%s", a.hydraEndpoint, a.version().consentSessionsPath(), query.Encode()), nil)
 	if err != nil {
 		log.Println(err)
+		return err
 	}
-	req.Header = headers
-	return sendRequest(req)
+	_, err = a.client.do(ctx, req)
+	return err
 }
 
-func sendRequest(req *http.Request) (redirectUrl string, err error) {
-
-	client := &http.Client{}
-
-	res, err := client.Do(req)
-
-	var redirect model.Redirect
-
-	body, err := ioutil.ReadAll(res.Body)
-
-	err = json.Unmarshal(body, &redirect)
-
+// RevokeLoginSessions logs the subject out of all login sessions
+func (a *HydraAdapter) RevokeLoginSessions(ctx context.Context, subject string) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s%s?subject=%s", a.hydraEndpoint, a.version().loginSessionsPath(), url.QueryEscape(subject)), nil)
 	if err != nil {
-		log.Print(err)
-		return
+		log.Println(err)
+		return err
 	}
+	_, err = a.client.do(ctx, req)
+	return err
+}
 
-	redirectUrl = redirect.RedirectURL
-
-	res.Body.Close()
-	return
+// RevokeLoginSession ends one login session, hydra sends the back-channel logout tokens of the session to the clients.
+// Hydra v1 can only revoke all sessions of a subject
+func (a *HydraAdapter) RevokeLoginSession(ctx context.Context, sessionID string) error {
+	version := a.version()
+	if version.name == HydraV1 {
+		return ErrUnsupportedVersion
+	}
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s%s?sid=%s", a.hydraEndpoint, version.loginSessionsPath(), url.QueryEscape(sessionID)), nil)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = a.client.do(ctx, req)
+	return err
+}
 
+// RevokeClientTokens revokes all access and refresh tokens issued to a client
+func (a *HydraAdapter) RevokeClientTokens(ctx context.Context, clientID string) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s%s?client_id=%s", a.hydraEndpoint, a.version().tokensPath(), url.QueryEscape(clientID)), nil)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = a.client.do(ctx, req)
+	return err
 }
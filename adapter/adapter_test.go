@@ -1,6 +1,7 @@
 package adapter
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -16,7 +17,7 @@ func TestHydraAdapter_ReadChallenge(t *testing.T) {
 	defer srv.Close()
 
 	adapter := NewHydraAdapter()
-	body, err := adapter.ReadChallenge("loginChallenge", "login")
+	body, err := adapter.ReadChallenge(context.Background(), "loginChallenge", "login")
 	if err != nil {
 		t.Error("error should be nil", err)
 		t.FailNow()
@@ -33,7 +34,7 @@ func TestHydraAdapter_ReadChallenge_Failure(t *testing.T) {
 	defer srv.Close()
 
 	adapter := NewHydraAdapter()
-	_, err := adapter.ReadChallenge("loginChallenge", "login")
+	_, err := adapter.ReadChallenge(context.Background(), "loginChallenge", "login")
 	if err == nil {
 		t.Error("error should not be nil")
 		t.FailNow()
@@ -64,3 +65,155 @@ func mockChallenge() http.HandlerFunc {
 		json.NewEncoder(w).Encode(loginResponse)
 	}
 }
+
+func TestHydraAdapter_ReadChallenge_ClientMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"client": {"client_id": "app", "client_name": "App", "logo_uri": "https://app/logo.png",
+			"policy_uri": "https://app/policy", "tos_uri": "https://app/tos", "client_uri": "https://app", "contacts": ["admin@app"]}}`))
+	}))
+	os.Setenv("HYDRA_URL", srv.URL)
+	defer srv.Close()
+
+	adapter := NewHydraAdapter()
+	body, err := adapter.ReadChallenge(context.Background(), "consentChallenge", "consent")
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	client := body.Client
+	if client.LogoURI != "https://app/logo.png" || client.PolicyURI != "https://app/policy" || client.TosURI != "https://app/tos" ||
+		client.ClientURI != "https://app" || len(client.Contacts) != 1 || client.DisplayName() != "App" {
+		t.Error("client metadata should be read", client)
+	}
+}
+
+func TestHydraAdapter_ListConsentSessions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/auth/sessions/consent" || r.URL.Query().Get("subject") != "homer@springfield.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[{"consent_request": {"client": {"client_id": "app"}}, "grant_scope": ["openid"], "remember": true}]`))
+	}))
+	os.Setenv("HYDRA_URL", srv.URL)
+	defer srv.Close()
+
+	adapter := NewHydraAdapter()
+	sessions, err := adapter.ListConsentSessions(context.Background(), "homer@springfield.com")
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if len(sessions) != 1 || sessions[0].ConsentRequest.Client.ClientID != "app" || sessions[0].GrantScope[0] != "openid" {
+		t.Error("consent session should be read", sessions)
+	}
+}
+
+func TestHydraAdapter_RevokeConsentSessions(t *testing.T) {
+	var query map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query = r.URL.Query()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	os.Setenv("HYDRA_URL", srv.URL)
+	defer srv.Close()
+
+	adapter := NewHydraAdapter()
+	if err := adapter.RevokeConsentSessions(context.Background(), "homer", "app"); err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if query["subject"][0] != "homer" || query["client"][0] != "app" {
+		t.Error("consent of client should be revoked", query)
+	}
+	if err := adapter.RevokeConsentSessions(context.Background(), "homer", ""); err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if query["all"][0] != "true" {
+		t.Error("all consents should be revoked", query)
+	}
+}
+
+func TestHydraAdapter_RevokeConsentSessions_Failure(t *testing.T) {
+	srv := httptest.NewServer(mockError())
+	os.Setenv("HYDRA_URL", srv.URL)
+	defer srv.Close()
+
+	adapter := NewHydraAdapter()
+	if err := adapter.RevokeConsentSessions(context.Background(), "homer", "app"); err == nil {
+		t.Error("error should not be nil")
+	}
+}
+
+func TestHydraAdapter_RevokeLoginSessions(t *testing.T) {
+	var path, subject string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		subject = r.URL.Query().Get("subject")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	os.Setenv("HYDRA_URL", srv.URL)
+	defer srv.Close()
+
+	adapter := NewHydraAdapter()
+	if err := adapter.RevokeLoginSessions(context.Background(), "homer"); err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if path != "/oauth2/auth/sessions/login" || subject != "homer" {
+		t.Error("login sessions of subject should be revoked", path, subject)
+	}
+}
+
+func TestHydraAdapter_RevokeClientTokens(t *testing.T) {
+	var path, clientID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		clientID = r.URL.Query().Get("client_id")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	os.Setenv("HYDRA_URL", srv.URL)
+	defer srv.Close()
+
+	adapter := NewHydraAdapter()
+	if err := adapter.RevokeClientTokens(context.Background(), "app"); err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if path != "/oauth2/tokens" || clientID != "app" {
+		t.Error("tokens of client should be revoked", path, clientID)
+	}
+}
+
+func TestHydraAdapter_AcceptUserCode(t *testing.T) {
+	var path, challenge string
+	var acceptUserCode model.AcceptUserCode
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		challenge = r.URL.Query().Get("device_challenge")
+		json.NewDecoder(r.Body).Decode(&acceptUserCode)
+		w.Write([]byte(`{"redirect_to": "http://hydra/oauth2/auth?login_verifier=abc"}`))
+	}))
+	os.Setenv("HYDRA_URL", srv.URL)
+	os.Setenv("HYDRA_VERSION", HydraV2)
+	defer os.Unsetenv("HYDRA_VERSION")
+	defer srv.Close()
+
+	adapter := NewHydraAdapter()
+	redirectURL, err := adapter.AcceptUserCode(context.Background(), "deviceChallenge", "BCDFGHJK")
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if path != "/admin/oauth2/auth/requests/device/accept" || challenge != "deviceChallenge" || acceptUserCode.UserCode != "BCDFGHJK" {
+		t.Error("user code of the device challenge should be accepted", path, challenge, acceptUserCode)
+	}
+	if redirectURL != "http://hydra/oauth2/auth?login_verifier=abc" {
+		t.Error("redirect of hydra should be returned", redirectURL)
+	}
+
+	os.Setenv("HYDRA_VERSION", HydraV1)
+	path = ""
+	v1Adapter := NewHydraAdapter()
+	if _, err := v1Adapter.AcceptUserCode(context.Background(), "deviceChallenge", "BCDFGHJK"); err != ErrUnsupportedVersion || path != "" {
+		t.Error("hydra v1 should not be asked for user codes", err, path)
+	}
+}
@@ -0,0 +1,193 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// hydraClient is the http client shared by all adapters, it retries idempotent requests and stops calling hydra while it fails
+type hydraClient struct {
+	httpClient *http.Client
+	maxRetries int
+	retryWait  time.Duration
+	threshold  int
+	cooldown   time.Duration
+	mutex      *sync.Mutex
+	breakers   map[string]*circuitBreaker
+}
+
+var (
+	sharedClient     *hydraClient
+	sharedClientOnce sync.Once
+)
+
+// defaultClient creates the shared client once from HYDRA_TIMEOUT, HYDRA_RETRIES, HYDRA_RETRY_WAIT,
+// HYDRA_BREAKER_THRESHOLD and HYDRA_BREAKER_COOLDOWN
+func defaultClient() *hydraClient {
+	sharedClientOnce.Do(func() {
+		sharedClient = newHydraClient(
+			durationFromEnv("HYDRA_TIMEOUT", 10*time.Second),
+			intFromEnv("HYDRA_RETRIES", 2),
+			durationFromEnv("HYDRA_RETRY_WAIT", 200*time.Millisecond),
+			intFromEnv("HYDRA_BREAKER_THRESHOLD", 5),
+			durationFromEnv("HYDRA_BREAKER_COOLDOWN", 30*time.Second),
+		)
+	})
+	return sharedClient
+}
+
+func newHydraClient(timeout time.Duration, maxRetries int, retryWait time.Duration, breakerThreshold int, breakerCooldown time.Duration) *hydraClient {
+	return &hydraClient{
+		httpClient: &http.Client{Timeout: timeout},
+		maxRetries: maxRetries,
+		retryWait:  retryWait,
+		threshold:  breakerThreshold,
+		cooldown:   breakerCooldown,
+		mutex:      &sync.Mutex{},
+		breakers:   make(map[string]*circuitBreaker),
+	}
+}
+
+// breaker returns the circuit breaker of the hydra host
+func (c *hydraClient) breaker(host string) *circuitBreaker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	breaker, ok := c.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{threshold: c.threshold, cooldown: c.cooldown}
+		c.breakers[host] = breaker
+	}
+	return breaker
+}
+
+// do sends the request and returns the body of a successful response or a *HydraError, GET requests are retried
+func (c *hydraClient) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	req = req.WithContext(ctx)
+	breaker := c.breaker(req.URL.Host)
+	attempts := 1
+	if req.Method == http.MethodGet {
+		attempts += c.maxRetries
+	}
+
+	var body []byte
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := c.wait(ctx, attempt); waitErr != nil {
+				return nil, waitErr
+			}
+		}
+		if !breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+		var retry bool
+		body, retry, err = c.send(req)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		breaker.record(!retry)
+		if !retry {
+			return body, err
+		}
+		log.Printf("hydra request %s %s failed (attempt %d of %d): %v", req.Method, req.URL.Path, attempt+1, attempts, err)
+	}
+	return nil, err
+}
+
+// send executes the request once, retry is true if the request failed because of hydra or the network
+func (c *hydraClient) send(req *http.Request) (body []byte, retry bool, err error) {
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, req.Context().Err() == nil, fmt.Errorf("hydra request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("could not read hydra response: %w", err)
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		hydraError := newHydraError(res.StatusCode, body)
+		return nil, hydraError.IsServerError() || res.StatusCode == http.StatusTooManyRequests, hydraError
+	}
+	return body, false, nil
+}
+
+// wait sleeps with exponential backoff and jitter before the next attempt
+func (c *hydraClient) wait(ctx context.Context, attempt int) error {
+	backoff := c.retryWait << uint(attempt-1)
+	if c.retryWait > 0 {
+		backoff += time.Duration(rand.Int63n(int64(c.retryWait)))
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// circuitBreaker opens after threshold consecutive failures and lets one request through after the cooldown
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = time.Now().Add(b.cooldown)
+	return true
+}
+
+func (b *circuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures == b.threshold {
+		log.Printf("hydra failed %d times, pausing requests for %s", b.failures, b.cooldown)
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func intFromEnv(name string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package adapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHydraClient_RetriesGet(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client := newHydraClient(time.Second, 2, time.Millisecond, 0, 0)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, err := client.do(context.Background(), req); err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls but got %d", calls)
+	}
+
+	calls = 0
+	req, _ = http.NewRequest("PUT", srv.URL, nil)
+	if _, err := client.do(context.Background(), req); err == nil {
+		t.Error("error should not be nil")
+	}
+	if calls != 1 {
+		t.Errorf("PUT should not be retried but got %d calls", calls)
+	}
+}
+
+func TestHydraClient_TypedError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "Not Found", "error_description": "Unable to locate the resource", "status_code": 404}`))
+	}))
+	defer srv.Close()
+
+	client := newHydraClient(time.Second, 2, time.Millisecond, 0, 0)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	_, err := client.do(context.Background(), req)
+	hydraError, ok := AsHydraError(err)
+	if !ok {
+		t.Fatal("error should be a hydra error", err)
+	}
+	if !hydraError.IsNotFound() || hydraError.Description != "Unable to locate the resource" {
+		t.Error("hydra error should be read", hydraError)
+	}
+
+	if hydraError := newHydraError(http.StatusBadGateway, []byte("proxy error")); hydraError.Name != "Bad Gateway" || !hydraError.IsServerError() {
+		t.Error("status text should be used for other bodies", hydraError)
+	}
+}
+
+func TestHydraClient_CircuitBreaker(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := newHydraClient(time.Second, 0, 0, 2, time.Hour)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		client.do(context.Background(), req)
+	}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, err := client.do(context.Background(), req); err != ErrCircuitOpen {
+		t.Error("circuit should be open", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls but got %d", calls)
+	}
+}
+
+func TestHydraClient_Context(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client := newHydraClient(time.Minute, 2, time.Millisecond, 1, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, err := client.do(ctx, req); err == nil {
+		t.Error("error should not be nil")
+	}
+	if !client.breaker(req.URL.Host).allow() {
+		t.Error("cancelled requests should not open the circuit")
+	}
+}
+
+func TestHydraClient_CancelledBackoff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := newHydraClient(time.Second, 2, time.Minute, 0, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if _, err := client.do(ctx, req); err != context.DeadlineExceeded {
+		t.Error("cancelled backoff should return the context error", err)
+	}
+}
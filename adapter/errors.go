@@ -0,0 +1,57 @@
+package adapter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrCircuitOpen is returned without calling hydra while hydra is considered unavailable
+var ErrCircuitOpen = errors.New("hydra is unavailable, circuit breaker is open")
+
+// ErrUnsupportedVersion is returned without calling hydra if the admin api of its version lacks the endpoint
+var ErrUnsupportedVersion = errors.New("the hydra version does not support this request")
+
+// HydraError is an error response of the hydra admin api
+type HydraError struct {
+	StatusCode  int    `json:"status_code"`
+	Name        string `json:"error"`
+	Description string `json:"error_description"`
+	Hint        string `json:"error_hint"`
+	Debug       string `json:"error_debug"`
+}
+
+func (e *HydraError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("hydra responded with status %d: %s: %s", e.StatusCode, e.Name, e.Description)
+	}
+	return fmt.Sprintf("hydra responded with status %d: %s", e.StatusCode, e.Name)
+}
+
+// IsNotFound is true if the request does not exist (anymore), hydra v2 answers handled requests with 410
+func (e *HydraError) IsNotFound() bool {
+	return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+}
+
+// IsServerError is true if hydra failed to handle a valid request
+func (e *HydraError) IsServerError() bool {
+	return e.StatusCode >= http.StatusInternalServerError
+}
+
+// newHydraError reads the error json of hydra, the status text is used if the body is no hydra error
+func newHydraError(statusCode int, body []byte) *HydraError {
+	hydraError := &HydraError{}
+	if err := json.Unmarshal(body, hydraError); err != nil || hydraError.Name == "" {
+		hydraError = &HydraError{Name: http.StatusText(statusCode), Description: string(body)}
+	}
+	hydraError.StatusCode = statusCode
+	return hydraError
+}
+
+// AsHydraError returns the hydra error wrapped in err if there is one
+func AsHydraError(err error) (*HydraError, bool) {
+	var hydraError *HydraError
+	ok := errors.As(err, &hydraError)
+	return hydraError, ok
+}
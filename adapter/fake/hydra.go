@@ -0,0 +1,434 @@
+// Package fake provides an in-memory hydra admin api for local development and end-to-end tests
+package fake
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"user-service/model"
+)
+
+// Request kinds of hydra
+const (
+	Login   = "login"
+	Consent = "consent"
+	Logout  = "logout"
+	Device  = "device"
+)
+
+// Request is a login, consent, logout or device request waiting to be accepted or rejected
+type Request struct {
+	Kind        string
+	Challenge   string
+	Body        model.LoginChallenge
+	RedirectURI string
+	Handled     bool
+}
+
+// Decision records how the user service handled a request
+type Decision struct {
+	Kind      string
+	Challenge string
+	Action    string
+	Body      json.RawMessage
+}
+
+// Revocation records a revoked session or token
+type Revocation struct {
+	Kind      string
+	Subject   string
+	ClientID  string
+	SessionID string
+}
+
+// Hydra fakes the login, consent, logout, session and token endpoints of the hydra admin api (v1 and v2 paths).
+// Accepting a login creates the consent request of the flow and redirects to ConsentURL, accepting the consent
+// redirects to the redirect uri of the client with a code. Refresh calls RefreshHookURL like a refresh token grant.
+// Accepting the user code of a device request starts the login of the device authorization, whose consent
+// redirects to DeviceSuccessURL.
+type Hydra struct {
+	Version          string
+	LoginURL         string
+	ConsentURL       string
+	LogoutURL        string
+	DeviceURL        string
+	DeviceSuccessURL string
+	RefreshHookURL   string
+	HookAPIKey       string
+
+	mutex           *sync.Mutex
+	requests        map[string]*Request
+	userCodes       map[string]model.LoginChallenge
+	decisions       []Decision
+	revocations     []Revocation
+	consentSessions map[string][]model.ConsentSession
+}
+
+// NewHydra creates an empty fake
+func NewHydra() *Hydra {
+	return &Hydra{
+		Version:         "v1.0.0-fake",
+		mutex:           &sync.Mutex{},
+		requests:        make(map[string]*Request),
+		userCodes:       make(map[string]model.LoginChallenge),
+		consentSessions: make(map[string][]model.ConsentSession),
+	}
+}
+
+// StartLogin creates the login request of a new authorization flow and returns its challenge
+func (h *Hydra) StartLogin(client model.Client, scopes []string, redirectURI string) string {
+	return h.AddRequest(Login, model.LoginChallenge{
+		Client:         client,
+		RequestedScope: scopes,
+		RequestURL:     "/oauth2/auth?client_id=" + url.QueryEscape(client.ClientID),
+	}, redirectURI)
+}
+
+// StartLogout creates a logout request of the subject and returns its challenge
+func (h *Hydra) StartLogout(subject string, rpInitiated bool, redirectURI string) string {
+	return h.AddRequest(Logout, model.LoginChallenge{Subject: subject, SessionID: randomID(), RpInitiated: rpInitiated}, redirectURI)
+}
+
+// StartDevice creates a device authorization and the device request of the verification page,
+// it returns the challenge of the device request and the user code the device shows
+func (h *Hydra) StartDevice(client model.Client, scopes []string) (challenge, userCode string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	userCode = randomUserCode()
+	h.userCodes[userCode] = model.LoginChallenge{
+		Client:         client,
+		RequestedScope: scopes,
+		RequestURL:     "/oauth2/device/verify",
+	}
+	return h.addRequest(Device, model.LoginChallenge{}, ""), userCode
+}
+
+// AddRequest adds a request of the given kind with any content and returns its challenge
+func (h *Hydra) AddRequest(kind string, body model.LoginChallenge, redirectURI string) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.addRequest(kind, body, redirectURI)
+}
+
+func (h *Hydra) addRequest(kind string, body model.LoginChallenge, redirectURI string) string {
+	challenge := randomID()
+	h.requests[challenge] = &Request{Kind: kind, Challenge: challenge, Body: body, RedirectURI: redirectURI}
+	return challenge
+}
+
+// AddConsentSession adds a remembered consent of the subject
+func (h *Hydra) AddConsentSession(subject string, consentSession model.ConsentSession) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	consentSession.ConsentRequest.Subject = subject
+	h.consentSessions[subject] = append(h.consentSessions[subject], consentSession)
+}
+
+// Request returns the request of a challenge
+func (h *Hydra) Request(challenge string) (Request, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	request, ok := h.requests[challenge]
+	if !ok {
+		return Request{}, false
+	}
+	return *request, true
+}
+
+// Decisions returns all accepted and rejected requests in the order they were handled
+func (h *Hydra) Decisions() []Decision {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]Decision(nil), h.decisions...)
+}
+
+// Revocations returns all revoked sessions and tokens in the order they were revoked
+func (h *Hydra) Revocations() []Revocation {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]Revocation(nil), h.revocations...)
+}
+
+// Refresh calls the refresh token hook like hydra does before refreshing the tokens of the subject,
+// allowed is false if the hook denied the refresh
+func (h *Hydra) Refresh(subject, clientID string, grantedScopes []string) (session model.SessionInfo, allowed bool, err error) {
+	var request model.RefreshHookRequest
+	request.Subject = subject
+	request.ClientID = clientID
+	request.GrantedScopes = grantedScopes
+	request.GrantedAudience = []string{}
+	request.Requester.ClientID = clientID
+	request.Requester.GrantedScopes = grantedScopes
+	request.Requester.GrantedAudience = []string{}
+	request.Requester.GrantTypes = []string{"refresh_token"}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return session, false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.RefreshHookURL, bytes.NewReader(body))
+	if err != nil {
+		return session, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.HookAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.HookAPIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return session, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var response model.RefreshHookResponse
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		return response.Session, err == nil, err
+	case http.StatusNoContent:
+		return session, true, nil
+	case http.StatusForbidden:
+		return session, false, nil
+	default:
+		return session, false, fmt.Errorf("refresh hook responded with status %d", resp.StatusCode)
+	}
+}
+
+// ServeHTTP serves the admin api
+func (h *Hydra) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin")
+	switch {
+	case path == "/version":
+		writeJSON(w, http.StatusOK, map[string]string{"version": h.Version})
+	case path == "/dev/login" && r.Method == http.MethodGet:
+		h.devLogin(w, r)
+	case path == "/dev/logout" && r.Method == http.MethodGet:
+		challenge := h.StartLogout(r.URL.Query().Get("subject"), true, "http://"+r.Host+"/dev/callback")
+		http.Redirect(w, r, withQuery(h.LogoutURL, url.Values{"logout_challenge": {challenge}}), http.StatusFound)
+	case path == "/dev/device" && r.Method == http.MethodGet:
+		h.devDevice(w, r)
+	case path == "/dev/callback":
+		writeJSON(w, http.StatusOK, r.URL.Query())
+	case strings.HasPrefix(path, "/oauth2/auth/requests/"):
+		h.handleRequest(w, r, strings.Split(strings.TrimPrefix(path, "/oauth2/auth/requests/"), "/"))
+	case path == "/oauth2/auth/sessions/consent":
+		h.handleConsentSessions(w, r)
+	case path == "/oauth2/auth/sessions/login" && r.Method == http.MethodDelete:
+		h.revoke(w, Revocation{Kind: "login", Subject: r.URL.Query().Get("subject"), SessionID: r.URL.Query().Get("sid")})
+	case path == "/oauth2/tokens" && r.Method == http.MethodDelete:
+		h.revoke(w, Revocation{Kind: "tokens", ClientID: r.URL.Query().Get("client_id")})
+	default:
+		writeError(w, http.StatusNotFound, "Not Found", "Unable to locate the resource")
+	}
+}
+
+func (h *Hydra) handleRequest(w http.ResponseWriter, r *http.Request, parts []string) {
+	kind := parts[0]
+	challenge := r.URL.Query().Get(kind + "_challenge")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	request, ok := h.requests[challenge]
+	if !ok || request.Kind != kind {
+		writeError(w, http.StatusNotFound, "Not Found", "Unable to locate the resource")
+		return
+	}
+
+	if len(parts) == 1 && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, request.Body)
+		return
+	}
+	if len(parts) != 2 || r.Method != http.MethodPut || (parts[1] != "accept" && parts[1] != "reject") {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "")
+		return
+	}
+	if request.Handled {
+		writeError(w, http.StatusGone, "request_was_handled", "The request was already handled")
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if kind == Device && parts[1] == "accept" {
+		var acceptUserCode model.AcceptUserCode
+		json.Unmarshal(body, &acceptUserCode)
+		loginBody, ok := h.userCodes[acceptUserCode.UserCode]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid_request", "The user code is invalid or expired")
+			return
+		}
+		delete(h.userCodes, acceptUserCode.UserCode)
+		loginBody.DeviceChallengeID = challenge
+		request.Body = loginBody
+		request.RedirectURI = h.DeviceSuccessURL
+	}
+	request.Handled = true
+	h.decisions = append(h.decisions, Decision{Kind: kind, Challenge: challenge, Action: parts[1], Body: body})
+
+	if parts[1] == "reject" {
+		var reject model.RejectRequest
+		json.Unmarshal(body, &reject)
+		writeJSON(w, http.StatusOK, model.Redirect{RedirectURL: withQuery(request.RedirectURI, url.Values{
+			"error":             {reject.Error},
+			"error_description": {reject.ErrorDescription},
+		})})
+		return
+	}
+	writeJSON(w, http.StatusOK, model.Redirect{RedirectURL: h.accept(request, body)})
+}
+
+// accept continues the flow and returns the next redirect
+func (h *Hydra) accept(request *Request, body []byte) string {
+	switch request.Kind {
+	case Login:
+		var acceptLogin model.AcceptLogin
+		json.Unmarshal(body, &acceptLogin)
+		consentBody := request.Body
+		consentBody.Subject = acceptLogin.Subject
+		consentBody.Acr = acceptLogin.Acr
+		consentBody.Amr = acceptLogin.Amr
+		if consentBody.LoginSessionID == "" {
+			consentBody.LoginSessionID = randomID()
+		}
+		consentBody.Skip = h.hasConsent(acceptLogin.Subject, request.Body.Client.ClientID)
+		challenge := h.addRequest(Consent, consentBody, request.RedirectURI)
+		return withQuery(h.ConsentURL, url.Values{"consent_challenge": {challenge}})
+	case Consent:
+		var acceptConsent model.AcceptConsent
+		json.Unmarshal(body, &acceptConsent)
+		if acceptConsent.Remember {
+			h.consentSessions[request.Body.Subject] = append(h.consentSessions[request.Body.Subject], model.ConsentSession{
+				ConsentRequest:           request.Body,
+				GrantScope:               acceptConsent.GrantScope,
+				GrantAccessTokenAudience: acceptConsent.GrantAccessTokenAudience,
+				Remember:                 acceptConsent.Remember,
+				RememberFor:              acceptConsent.RememberFor,
+			})
+		}
+		if request.Body.DeviceChallengeID != "" {
+			return request.RedirectURI
+		}
+		return withQuery(request.RedirectURI, url.Values{"code": {randomID()}})
+	case Device:
+		challenge := h.addRequest(Login, request.Body, request.RedirectURI)
+		return withQuery(h.LoginURL, url.Values{"login_challenge": {challenge}})
+	default:
+		return request.RedirectURI
+	}
+}
+
+func (h *Hydra) hasConsent(subject, clientID string) bool {
+	for _, consentSession := range h.consentSessions[subject] {
+		if consentSession.ConsentRequest.Client.ClientID == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hydra) handleConsentSessions(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("subject")
+	if r.Method == http.MethodGet {
+		h.mutex.Lock()
+		consentSessions := append(make([]model.ConsentSession, 0), h.consentSessions[subject]...)
+		h.mutex.Unlock()
+		writeJSON(w, http.StatusOK, consentSessions)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "")
+		return
+	}
+
+	clientID := r.URL.Query().Get("client")
+	h.mutex.Lock()
+	kept := make([]model.ConsentSession, 0)
+	for _, consentSession := range h.consentSessions[subject] {
+		if clientID != "" && consentSession.ConsentRequest.Client.ClientID != clientID {
+			kept = append(kept, consentSession)
+		}
+	}
+	h.consentSessions[subject] = kept
+	h.mutex.Unlock()
+	h.revoke(w, Revocation{Kind: "consent", Subject: subject, ClientID: clientID})
+}
+
+func (h *Hydra) revoke(w http.ResponseWriter, revocation Revocation) {
+	h.mutex.Lock()
+	h.revocations = append(h.revocations, revocation)
+	h.mutex.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// devLogin starts a flow for the client_id, scope and redirect_uri parameters and redirects the browser to the login page
+func (h *Hydra) devLogin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	clientID := query.Get("client_id")
+	if clientID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "client_id must be specified")
+		return
+	}
+	redirectURI := query.Get("redirect_uri")
+	if redirectURI == "" {
+		redirectURI = "http://" + r.Host + "/dev/callback"
+	}
+	challenge := h.StartLogin(model.Client{ClientID: clientID, ClientName: clientID}, strings.Fields(query.Get("scope")), redirectURI)
+	http.Redirect(w, r, withQuery(h.LoginURL, url.Values{"login_challenge": {challenge}}), http.StatusFound)
+}
+
+// devDevice starts a device authorization for the client_id and scope parameters and redirects the browser to the
+// verification page with the user code prefilled
+func (h *Hydra) devDevice(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	clientID := query.Get("client_id")
+	if clientID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "client_id must be specified")
+		return
+	}
+	challenge, userCode := h.StartDevice(model.Client{ClientID: clientID, ClientName: clientID}, strings.Fields(query.Get("scope")))
+	http.Redirect(w, r, withQuery(h.DeviceURL, url.Values{"device_challenge": {challenge}, "user_code": {userCode}}), http.StatusFound)
+}
+
+func withQuery(rawURL string, query url.Values) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query.Encode()
+	}
+	return rawURL + "?" + query.Encode()
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, name, description string) {
+	writeJSON(w, statusCode, map[string]interface{}{"error": name, "error_description": description, "status_code": statusCode})
+}
+
+// randomUserCode returns a user code of eight characters of the base20 alphabet hydra uses
+func randomUserCode() string {
+	const alphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	code := make([]byte, 8)
+	rand.Read(code)
+	for i := range code {
+		code[i] = alphabet[int(code[i])%len(alphabet)]
+	}
+	return string(code)
+}
+
+func randomID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,81 @@
+package adapter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"user-service/model"
+)
+
+// SMTPSender delivers mails through the smtp server of SMTP_HOST
+type SMTPSender struct {
+	address  string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPSender() SMTPSender {
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return SMTPSender{
+		address:  host + ":" + port,
+		host:     host,
+		username: os.Getenv("SMTP_USER"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     os.Getenv("MAIL_FROM"),
+	}
+}
+
+// Send delivers the mail, the server is authenticated with SMTP_USER and SMTP_PASSWORD if they are set
+func (s *SMTPSender) Send(mail model.Mail) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+	return smtp.SendMail(s.address, auth, s.from, []string{mail.To}, formatMail(s.from, mail))
+}
+
+// FileSender writes every mail to a file of its directory instead of sending it, for development and tests
+type FileSender struct {
+	Dir string
+}
+
+func NewFileSender(dir string) FileSender {
+	return FileSender{Dir: dir}
+}
+
+var unsafeFileName = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// Send writes the mail to <dir>/<time>-<recipient>.eml
+func (s *FileSender) Send(mail model.Mail) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileName.ReplaceAllString(mail.To, "_"))
+	return ioutil.WriteFile(filepath.Join(s.Dir, name), formatMail("", mail), 0600)
+}
+
+// formatMail builds the message, line breaks are removed from the headers so they cannot inject others
+func formatMail(from string, mail model.Mail) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+	var message strings.Builder
+	if from != "" {
+		message.WriteString("From: " + header.Replace(from) + "\r\n")
+	}
+	message.WriteString("To: " + header.Replace(mail.To) + "\r\n")
+	message.WriteString("Subject: " + header.Replace(mail.Subject) + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(mail.Body)
+	return []byte(message.String())
+}
@@ -0,0 +1,34 @@
+package adapter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"user-service/model"
+)
+
+func TestFileSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sender := NewFileSender(filepath.Join(dir, "out"))
+	if err := sender.Send(model.Mail{To: "homer@springfield.com", Subject: "Hello\r\nBcc: bart@springfield.com", Body: "Link"}); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "out", "*-homer@springfield.com.eml"))
+	if len(files) != 1 {
+		t.Fatal("mail should be written to a file of the recipient", files)
+	}
+	content, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(content), "To: homer@springfield.com\r\n") || !strings.HasSuffix(string(content), "\r\n\r\nLink") {
+		t.Error("mail should contain the headers and the body", string(content))
+	}
+	if strings.Contains(string(content), "\r\nBcc:") {
+		t.Error("line breaks in headers should be removed", string(content))
+	}
+}
@@ -0,0 +1,143 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HydraV1 and HydraV2 are the supported versions of the hydra admin api
+const (
+	HydraV1 = "v1"
+	HydraV2 = "v2"
+)
+
+// apiVersion knows the admin paths of one hydra version
+type apiVersion struct {
+	name   string
+	prefix string
+}
+
+var apiVersions = map[string]apiVersion{
+	HydraV1: {name: HydraV1, prefix: ""},
+	HydraV2: {name: HydraV2, prefix: "/admin"},
+}
+
+// requestPath returns the path of a login, consent or logout request, action may be empty, accept or reject
+func (v apiVersion) requestPath(method, action string) string {
+	path := fmt.Sprintf("%s/oauth2/auth/requests/%s", v.prefix, method)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+func (v apiVersion) consentSessionsPath() string {
+	return v.prefix + "/oauth2/auth/sessions/consent"
+}
+
+func (v apiVersion) loginSessionsPath() string {
+	return v.prefix + "/oauth2/auth/sessions/login"
+}
+
+func (v apiVersion) tokensPath() string {
+	return v.prefix + "/oauth2/tokens"
+}
+
+type versionResponse struct {
+	Version string `json:"version"`
+}
+
+// detectionRetry is how long the v1 fallback is used before the version is detected again
+const detectionRetry = time.Minute
+
+// detectedVersion is the version of an endpoint, a fallback is only valid until retryAt
+type detectedVersion struct {
+	version apiVersion
+	retryAt time.Time
+}
+
+var (
+	detectedVersions = make(map[string]detectedVersion)
+	// detections are the running detections per endpoint, they are closed when the detection finished
+	detections     = make(map[string]chan struct{})
+	detectionMutex = &sync.Mutex{}
+)
+
+// resolveVersion returns the configured version or detects it once per endpoint via the /version endpoint of hydra,
+// if hydra cannot tell its version v1 is used for detectionRetry. The lock is not held while hydra is asked,
+// calls during a detection wait for it or keep using the expired fallback
+func resolveVersion(hydraEndpoint, configuredVersion string) apiVersion {
+	if version, ok := apiVersions[strings.ToLower(configuredVersion)]; ok {
+		return version
+	}
+	if configuredVersion != "" && !strings.EqualFold(configuredVersion, "auto") {
+		log.Printf("unknown hydra version %s, detecting version", configuredVersion)
+	}
+
+	detectionMutex.Lock()
+	detected, known := detectedVersions[hydraEndpoint]
+	if known && (detected.retryAt.IsZero() || time.Now().Before(detected.retryAt)) {
+		detectionMutex.Unlock()
+		return detected.version
+	}
+	if running, ok := detections[hydraEndpoint]; ok {
+		detectionMutex.Unlock()
+		if known {
+			return detected.version
+		}
+		<-running
+		detectionMutex.Lock()
+		defer detectionMutex.Unlock()
+		return detectedVersions[hydraEndpoint].version
+	}
+	running := make(chan struct{})
+	detections[hydraEndpoint] = running
+	detectionMutex.Unlock()
+
+	version, err := detectVersion(hydraEndpoint)
+	detected = detectedVersion{version: version}
+	if err != nil {
+		log.Printf("could not detect hydra version, using %s for %s: %v", HydraV1, detectionRetry, err)
+		detected = detectedVersion{version: apiVersions[HydraV1], retryAt: time.Now().Add(detectionRetry)}
+	}
+
+	detectionMutex.Lock()
+	defer detectionMutex.Unlock()
+	detectedVersions[hydraEndpoint] = detected
+	delete(detections, hydraEndpoint)
+	close(running)
+	return detected.version
+}
+
+// detectVersion asks hydra once for its version, the request counts for the circuit breaker of the shared client
+func detectVersion(hydraEndpoint string) (apiVersion, error) {
+	req, err := http.NewRequest(http.MethodGet, hydraEndpoint+"/version", nil)
+	if err != nil {
+		return apiVersion{}, err
+	}
+	client := defaultClient()
+	breaker := client.breaker(req.URL.Host)
+	if !breaker.allow() {
+		return apiVersion{}, ErrCircuitOpen
+	}
+	body, retry, err := client.send(req)
+	breaker.record(!retry)
+	if err != nil {
+		return apiVersion{}, err
+	}
+
+	var versionBody versionResponse
+	if err := json.Unmarshal(body, &versionBody); err != nil {
+		return apiVersion{}, err
+	}
+	major := strings.SplitN(strings.TrimPrefix(versionBody.Version, "v"), ".", 2)[0]
+	if version, ok := apiVersions["v"+major]; ok {
+		return version, nil
+	}
+	return apiVersion{}, fmt.Errorf("unsupported hydra version %s", versionBody.Version)
+}
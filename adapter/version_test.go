@@ -0,0 +1,176 @@
+package adapter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// mockHydra serves the fixtures of one hydra version only on the paths of that version,
+// the login challenges handled and unknown are answered like hydra answers requests which were handled or never existed
+func mockHydra(t *testing.T, version string) *httptest.Server {
+	prefix := apiVersions[version].prefix
+	fixtures := map[string]string{
+		"GET /version": "version.json",
+		"GET " + prefix + "/oauth2/auth/requests/login":        "login_request.json",
+		"PUT " + prefix + "/oauth2/auth/requests/login/accept": "redirect.json",
+		"PUT " + prefix + "/oauth2/auth/requests/login/reject": "redirect.json",
+		"GET " + prefix + "/oauth2/auth/sessions/consent":      "consent_sessions.json",
+		"DELETE " + prefix + "/oauth2/auth/sessions/consent":   "",
+		"DELETE " + prefix + "/oauth2/auth/sessions/login":     "",
+		"DELETE " + prefix + "/oauth2/tokens":                  "",
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := fixtures[r.Method+" "+r.URL.Path]
+		status := http.StatusOK
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case fixture == "":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case r.URL.Query().Get("login_challenge") == "handled":
+			fixture, status = "handled_request.json", http.StatusGone
+		case r.URL.Query().Get("login_challenge") == "unknown":
+			fixture, status = "not_found.json", http.StatusNotFound
+		}
+		body, err := ioutil.ReadFile("testdata/" + version + "/" + fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+}
+
+func TestHydraAdapter_Contract(t *testing.T) {
+	for _, version := range []string{HydraV1, HydraV2} {
+		for _, configured := range []string{version, "auto"} {
+			srv := mockHydra(t, version)
+			os.Setenv("HYDRA_URL", srv.URL)
+			os.Setenv("HYDRA_VERSION", configured)
+			adapter := NewHydraAdapter()
+
+			challenge, err := adapter.ReadChallenge(context.Background(), "loginChallenge", "login")
+			if err != nil {
+				t.Fatal(version, configured, "error should be nil", err)
+			}
+			if challenge.Client.ClientID != "auth-code-client" || challenge.Client.DisplayName() != "Auth Code Client" ||
+				challenge.Client.LogoURI != "https://app/logo.png" || len(challenge.RequestedScope) != 2 {
+				t.Error(version, configured, "login request should be read", challenge)
+			}
+
+			for _, gone := range []string{"handled", "unknown"} {
+				_, err := adapter.ReadChallenge(context.Background(), gone, "login")
+				if hydraError, ok := AsHydraError(err); !ok || !hydraError.IsNotFound() {
+					t.Error(version, configured, gone, "request should not be found", err)
+				}
+			}
+
+			redirect, err := adapter.SendAcceptBody(context.Background(), "login", "loginChallenge", []byte(`{"subject": "homer"}`))
+			if err != nil || redirect == "" {
+				t.Error(version, configured, "accept should return redirect", redirect, err)
+			}
+			redirect, err = adapter.SendRejectBody(context.Background(), "login", "loginChallenge", []byte(`{"error": "access_denied"}`))
+			if err != nil || redirect == "" {
+				t.Error(version, configured, "reject should return redirect", redirect, err)
+			}
+
+			sessions, err := adapter.ListConsentSessions(context.Background(), "homer")
+			if err != nil {
+				t.Fatal(version, configured, "error should be nil", err)
+			}
+			if len(sessions) != 1 || sessions[0].ConsentRequest.Client.ClientID != "auth-code-client" ||
+				len(sessions[0].GrantScope) != 2 || !sessions[0].Remember || sessions[0].HandledAt == "" {
+				t.Error(version, configured, "consent sessions should be read", sessions)
+			}
+
+			if err := adapter.RevokeConsentSessions(context.Background(), "homer", "auth-code-client"); err != nil {
+				t.Error(version, configured, "consent should be revoked", err)
+			}
+			if err := adapter.RevokeLoginSessions(context.Background(), "homer"); err != nil {
+				t.Error(version, configured, "login sessions should be revoked", err)
+			}
+			if err := adapter.RevokeClientTokens(context.Background(), "auth-code-client"); err != nil {
+				t.Error(version, configured, "tokens should be revoked", err)
+			}
+			srv.Close()
+		}
+	}
+	os.Unsetenv("HYDRA_VERSION")
+}
+
+func TestResolveVersion(t *testing.T) {
+	if version := resolveVersion("http://127.0.0.1:0", "V2"); version.name != HydraV2 {
+		t.Error("configured version should be used", version)
+	}
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	for i := 0; i < 3; i++ {
+		if version := resolveVersion(srv.URL, "auto"); version.name != HydraV1 {
+			t.Error("v1 should be used if version cannot be detected", version)
+		}
+	}
+	if requests != 1 {
+		t.Error("failed detection should be remembered until the retry", requests)
+	}
+
+	detectionMutex.Lock()
+	detectedVersions[srv.URL] = detectedVersion{version: apiVersions[HydraV1], retryAt: time.Now().Add(-time.Second)}
+	detectionMutex.Unlock()
+	resolveVersion(srv.URL, "auto")
+	if requests != 2 {
+		t.Error("version should be detected again after the retry", requests)
+	}
+}
+
+func TestResolveVersion_DetectsOutsideLock(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"version":"v2.2.0"}`))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":"v2.2.0"}`))
+	}))
+	defer fast.Close()
+
+	resolved := make(chan apiVersion)
+	go func() { resolved <- resolveVersion(slow.URL, "auto") }()
+	for {
+		detectionMutex.Lock()
+		_, running := detections[slow.URL]
+		detectionMutex.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan apiVersion)
+	go func() { done <- resolveVersion(fast.URL, "auto") }()
+	select {
+	case version := <-done:
+		if version.name != HydraV2 {
+			t.Error("version of the other endpoint should be detected", version)
+		}
+	case <-time.After(time.Second):
+		t.Error("detection of one endpoint should not block other endpoints")
+	}
+	close(release)
+	if version := <-resolved; version.name != HydraV2 {
+		t.Error("slow endpoint should be detected", version)
+	}
+}
@@ -1,25 +1,98 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"user-service/adapter/fake"
 	"user-service/manager"
+	"user-service/provider"
 )
 
 func main() {
+	dev := flag.Bool("dev", false, "start a fake hydra admin api in-process instead of using HYDRA_URL")
+	devHydraAddr := flag.String("dev-hydra-addr", "127.0.0.1:4445", "address of the fake hydra admin api in dev mode")
+	flag.Parse()
+
+	if *dev {
+		startFakeHydra(*devHydraAddr)
+	}
 
 	loginHandler := manager.NewLoginHandler()
 	userHandler := manager.NewUserHandler()
+	reviewHandler := manager.NewReviewHandler()
+	authzHandler := manager.NewAuthzHandler()
+	clientHandler := manager.NewClientHandler()
+	accountHandler := manager.NewAccountHandler()
+	hookHandler := manager.NewHookHandler()
+	backChannelHandler := manager.NewBackChannelHandler()
 
 	http.HandleFunc("/login", loginHandler.LoginHandler)
+	http.HandleFunc("/login/magic", loginHandler.MagicLinkHandler)
+	http.HandleFunc("/device", loginHandler.DeviceHandler)
+	http.HandleFunc("/device/done", loginHandler.DeviceDoneHandler)
 	http.HandleFunc("/consent", loginHandler.ConsentHandler)
 	http.HandleFunc("/acceptConsent", loginHandler.AcceptConsentHandler)
 	http.HandleFunc("/logout", loginHandler.LogoutHandler)
+	http.HandleFunc("/error", loginHandler.ErrorHandler)
 	http.HandleFunc("/user", userHandler.ManageUser)
 	http.HandleFunc("/user/", userHandler.ManageUser)
 	http.HandleFunc("/user/application/", userHandler.ManageApplications)
+	http.HandleFunc("/review", reviewHandler.ManageReviews)
+	http.HandleFunc("/review/", reviewHandler.ManageReviews)
+	http.HandleFunc("/authz/check", authzHandler.Check)
+	http.HandleFunc("/authz/check/batch", authzHandler.CheckBatch)
+	http.HandleFunc("/client", clientHandler.ManageClients)
+	http.HandleFunc("/client/", clientHandler.ManageClients)
+	http.HandleFunc("/account/login", accountHandler.LoginHandler)
+	http.HandleFunc("/account/logout", accountHandler.LogoutHandler)
+	http.HandleFunc("/account/consents", accountHandler.ConsentsHandler)
+	http.HandleFunc("/account/api/consents", accountHandler.ConsentsAPIHandler)
+	http.HandleFunc("/account/api/consents/revocations", accountHandler.RevocationsAPIHandler)
+	http.HandleFunc("/account/devices", accountHandler.DevicesHandler)
+	http.HandleFunc("/account/api/devices", accountHandler.DevicesAPIHandler)
+	http.HandleFunc("/hooks/refresh", hookHandler.RefreshHandler)
+	if backChannelHandler != nil {
+		http.HandleFunc("/logout/backchannel", backChannelHandler.LogoutHandler)
+	}
+
+	if provider.IsStandalone() {
+		oidcProvider := provider.Default()
+		oidcProvider.SetRefreshHook(hookHandler.Refresh)
+		http.HandleFunc("/.well-known/openid-configuration", oidcProvider.DiscoveryHandler)
+		http.HandleFunc("/.well-known/jwks.json", oidcProvider.JWKSHandler)
+		http.HandleFunc("/oauth2/auth", oidcProvider.AuthorizeHandler)
+		http.HandleFunc("/oauth2/token", oidcProvider.TokenHandler)
+		http.HandleFunc("/oauth2/revoke", oidcProvider.RevokeHandler)
+		http.HandleFunc("/oauth2/sessions/logout", oidcProvider.LogoutHandler)
+		http.HandleFunc("/userinfo", oidcProvider.UserInfoHandler)
+		log.Println("Standalone OIDC provider is enabled.")
+	}
 
 	log.Println("Server is running at 3000 port.")
 	http.ListenAndServe(":3000", nil)
 
 }
+
+// startFakeHydra serves the fake hydra admin api and points the adapters to it, login link mails are written to mails
+func startFakeHydra(addr string) {
+	hydra := fake.NewHydra()
+	hydra.LoginURL = "http://127.0.0.1:3000/login"
+	hydra.ConsentURL = "http://127.0.0.1:3000/consent"
+	hydra.LogoutURL = "http://127.0.0.1:3000/logout"
+	hydra.DeviceURL = "http://127.0.0.1:3000/device"
+	hydra.DeviceSuccessURL = "http://127.0.0.1:3000/device/done"
+	os.Setenv("HYDRA_URL", "http://"+addr)
+	// the device endpoints of the fake only exist in hydra v2
+	hydra.Version = "v2.3.0-fake"
+	os.Setenv("HYDRA_VERSION", "v2")
+	if os.Getenv("MAIL_DIR") == "" && os.Getenv("SMTP_HOST") == "" {
+		os.Setenv("MAIL_DIR", "mails")
+	}
+
+	go func() {
+		log.Fatal(http.ListenAndServe(addr, hydra))
+	}()
+	log.Printf("Fake hydra is running at %s, start a login at http://%s/dev/login?client_id=<client>&scope=openid", addr, addr)
+}
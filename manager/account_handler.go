@@ -0,0 +1,236 @@
+package manager
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type AccountHandler struct {
+	ConfigService        ConfigService
+	AccountService       AccountService
+	Session              AccountSession
+	TrustedDeviceService *TrustedDeviceService
+}
+
+func NewAccountHandler() AccountHandler {
+	configService, err := NewConfigService()
+	if err != nil {
+		log.Print("Could not create config")
+		log.Fatal(err)
+	}
+
+	return AccountHandler{
+		ConfigService:        configService,
+		AccountService:       NewAccountService(),
+		Session:              NewAccountSession(),
+		TrustedDeviceService: NewTrustedDeviceService(),
+	}
+}
+
+// LoginHandler authenticates the user for the self service pages
+func (h *AccountHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	loginData := h.ConfigService.AccountLogin
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, pass := h.AccountService.Authenticate(r.Form.Get("username"), r.Form.Get("password"))
+		if pass {
+			h.Session.Create(w, user.ID)
+			http.Redirect(w, r, "/account/consents", http.StatusFound)
+			return
+		}
+		loginData.ErrorMessage = h.ConfigService.AccountConsents.LoginFailureMessage
+		w.WriteHeader(http.StatusForbidden)
+	}
+	templLogin := template.Must(template.ParseFiles(templateDir + "/account_login.html"))
+	templLogin.Execute(w, loginData)
+}
+
+// LogoutHandler ends the self service session
+func (h *AccountHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	h.Session.Destroy(w)
+	http.Redirect(w, r, "/account/login", http.StatusFound)
+}
+
+// ConsentsHandler lists the granted consents and revokes them on POST
+func (h *AccountHandler) ConsentsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.Session.Read(r)
+	if err != nil {
+		http.Redirect(w, r, "/account/login", http.StatusFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.AccountService.RevokeConsent(r.Context(), userID, r.Form.Get("client"), "self"); err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/account/consents?revoked=true", http.StatusFound)
+		return
+	}
+
+	user, err := h.AccountService.UserService.FindUser(userID)
+	if err != nil {
+		h.Session.Destroy(w)
+		http.Redirect(w, r, "/account/login", http.StatusFound)
+		return
+	}
+	consents, err := h.AccountService.ListConsents(r.Context(), userID)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	consentsData := h.ConfigService.AccountConsents
+	consentsData.UserName = user.UserName
+	consentsData.Consents = consents
+	if r.URL.Query().Get("revoked") == "true" {
+		consentsData.Message = consentsData.RevokedMessage
+	}
+	templConsents := template.Must(template.ParseFiles(templateDir + "/account_consents.html"))
+	templConsents.Execute(w, consentsData)
+}
+
+// ConsentsAPIHandler lists the granted consents as json and revokes them on DELETE with an optional client parameter
+func (h *AccountHandler) ConsentsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.Session.Read(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == "GET" {
+		consents, err := h.AccountService.ListConsents(r.Context(), userID)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(consents)
+		return
+	}
+	if r.Method == "DELETE" {
+		if err := h.AccountService.RevokeConsent(r.Context(), userID, r.URL.Query().Get("client"), "self"); err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte("Method must be GET or DELETE"))
+}
+
+// RevocationsAPIHandler returns the recorded consent revocations of the signed in user as JSON
+func (h *AccountHandler) RevocationsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.Session.Read(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Method must be GET"))
+		return
+	}
+	revocations, err := h.AccountService.ListRevocations(userID)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revocations)
+}
+
+// DevicesHandler lists the browsers which skip the second factor and revokes them on POST
+func (h *AccountHandler) DevicesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.Session.Read(r)
+	if err != nil {
+		http.Redirect(w, r, "/account/login", http.StatusFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		deviceID, _ := strconv.ParseUint(r.Form.Get("device"), 10, 64)
+		if err := h.TrustedDeviceService.Revoke(userID, uint(deviceID)); err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/account/devices?revoked=true", http.StatusFound)
+		return
+	}
+
+	user, err := h.AccountService.UserService.FindUser(userID)
+	if err != nil {
+		h.Session.Destroy(w)
+		http.Redirect(w, r, "/account/login", http.StatusFound)
+		return
+	}
+	devices, err := h.TrustedDeviceService.FindDevices(userID)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	devicesData := h.ConfigService.AccountDevices
+	devicesData.UserName = user.UserName
+	devicesData.Devices = devices
+	if r.URL.Query().Get("revoked") == "true" {
+		devicesData.Message = devicesData.RevokedMessage
+	}
+	templDevices := template.Must(template.ParseFiles(templateDir + "/account_devices.html"))
+	templDevices.Execute(w, devicesData)
+}
+
+// DevicesAPIHandler lists the trusted browsers as json and revokes them on DELETE with an optional device parameter
+func (h *AccountHandler) DevicesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.Session.Read(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == "GET" {
+		devices, err := h.TrustedDeviceService.FindDevices(userID)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(devices)
+		return
+	}
+	if r.Method == "DELETE" {
+		deviceID, _ := strconv.ParseUint(r.URL.Query().Get("device"), 10, 64)
+		if err := h.TrustedDeviceService.Revoke(userID, uint(deviceID)); err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte("Method must be GET or DELETE"))
+}
@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"context"
+	"log"
+	"user-service/model"
+	"user-service/repository"
+)
+
+type AccountDatabaseHandler interface {
+	CreateConsentRevocation(*model.ConsentRevocation) error
+	FindConsentRevocations(uint) ([]model.ConsentRevocation, error)
+}
+
+// AccountService Business Logic for the self service of a user
+type AccountService struct {
+	UserService     UserService
+	HydraAdapter    LoginAdapter
+	databaseHandler AccountDatabaseHandler
+}
+
+func NewAccountService() AccountService {
+	databaseHandler, err := repository.NewDatabaseHandler()
+	if err != nil {
+		log.Println("could not create new Service due to database initialization")
+		log.Fatal(err)
+	}
+	return AccountService{
+		UserService:     NewUserService(),
+		HydraAdapter:    newLoginAdapter(),
+		databaseHandler: &databaseHandler,
+	}
+}
+
+// Authenticate returns the user if the password matches
+func (s *AccountService) Authenticate(userName, password string) (model.UserDTO, bool) {
+	pass, err := s.UserService.CheckPassword(userName, password)
+	if err != nil || !pass {
+		return model.UserDTO{}, false
+	}
+	user, err := s.UserService.FindUserByEmailOrUserName(userName)
+	return user, err == nil
+}
+
+// ListConsents returns the consents the user has granted to clients
+func (s *AccountService) ListConsents(ctx context.Context, userID uint) ([]model.ConsentDTO, error) {
+	user, err := s.UserService.FindUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	consents := make([]model.ConsentDTO, 0)
+	for _, subject := range subjectsOf(user) {
+		consentSessions, err := s.HydraAdapter.ListConsentSessions(ctx, subject)
+		if err != nil {
+			return nil, err
+		}
+		for _, consentSession := range consentSessions {
+			client := consentSession.ConsentRequest.Client
+			consents = append(consents, model.ConsentDTO{
+				ClientID:    client.ClientID,
+				ClientName:  client.DisplayName(),
+				LogoURI:     client.LogoURI,
+				GrantScope:  consentSession.GrantScope,
+				Audience:    consentSession.GrantAccessTokenAudience,
+				Remember:    consentSession.Remember,
+				RememberFor: consentSession.RememberFor,
+				GrantedAt:   consentSession.HandledAt,
+			})
+		}
+	}
+	return consents, nil
+}
+
+// RevokeConsent revokes the consent of the user for one client or for all clients if clientID is empty
+func (s *AccountService) RevokeConsent(ctx context.Context, userID uint, clientID, revokedBy string) error {
+	user, err := s.UserService.FindUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, subject := range subjectsOf(user) {
+		if err := s.HydraAdapter.RevokeConsentSessions(ctx, subject, clientID); err != nil {
+			return err
+		}
+		revocation := model.ConsentRevocation{
+			UserID:    user.ID,
+			Subject:   subject,
+			ClientID:  clientID,
+			RevokedBy: revokedBy,
+		}
+		if err := s.databaseHandler.CreateConsentRevocation(&revocation); err != nil {
+			log.Println(err)
+		}
+	}
+	return nil
+}
+
+// ListRevocations returns the consents the user or an admin revoked, newest first
+func (s *AccountService) ListRevocations(userID uint) ([]model.ConsentRevocationDTO, error) {
+	revocations, err := s.databaseHandler.FindConsentRevocations(userID)
+	if err != nil {
+		return nil, err
+	}
+	revocationDTOs := make([]model.ConsentRevocationDTO, 0, len(revocations))
+	for _, revocation := range revocations {
+		revocationDTOs = append(revocationDTOs, model.ConsentRevocationDTO{
+			ClientID:  revocation.ClientID,
+			RevokedBy: revocation.RevokedBy,
+			RevokedAt: revocation.CreatedAt,
+		})
+	}
+	return revocationDTOs, nil
+}
+
+// subjectsOf returns all subjects hydra may know the user by, sessions from before the subject migration
+// use the legacy subjects recorded for the user by the migration
+func subjectsOf(user model.UserDTO) []string {
+	subjects := make([]string, 0, 1+len(user.LegacySubjects))
+	for _, subject := range append([]string{user.Subject}, user.LegacySubjects...) {
+		if subject != "" && !contains(subjects, subject) {
+			subjects = append(subjects, subject)
+		}
+	}
+	return subjects
+}
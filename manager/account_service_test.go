@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"testing"
+	"user-service/model"
+)
+
+type mockAccountDatabase struct {
+	revocations []model.ConsentRevocation
+}
+
+func (m *mockAccountDatabase) CreateConsentRevocation(revocation *model.ConsentRevocation) error {
+	m.revocations = append(m.revocations, *revocation)
+	return nil
+}
+
+func (m *mockAccountDatabase) FindConsentRevocations(userID uint) ([]model.ConsentRevocation, error) {
+	revocations := make([]model.ConsentRevocation, 0)
+	for _, revocation := range m.revocations {
+		if revocation.UserID == userID {
+			revocations = append(revocations, revocation)
+		}
+	}
+	return revocations, nil
+}
+
+func TestAccountService_ListRevocations(t *testing.T) {
+	database := &mockAccountDatabase{revocations: []model.ConsentRevocation{
+		{UserID: 1, Subject: testSubject, ClientID: "app", RevokedBy: "self"},
+		{UserID: 2, Subject: "other", RevokedBy: "admin"},
+	}}
+	service := AccountService{databaseHandler: database}
+
+	revocations, err := service.ListRevocations(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revocations) != 1 || revocations[0].ClientID != "app" || revocations[0].RevokedBy != "self" {
+		t.Error("only the revocations of the user should be listed", revocations)
+	}
+}
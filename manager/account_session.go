@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const accountSessionCookie = "idp_account_session"
+
+// AccountSession signs and verifies the cookie of the self service pages
+type AccountSession struct {
+	secret   []byte
+	lifetime time.Duration
+	secure   bool
+}
+
+func NewAccountSession() AccountSession {
+	secret := []byte(os.Getenv("ACCOUNT_SESSION_SECRET"))
+	if len(secret) == 0 {
+		log.Println("ACCOUNT_SESSION_SECRET is not set, self service sessions do not survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal(err)
+		}
+	}
+	lifetime, err := time.ParseDuration(os.Getenv("ACCOUNT_SESSION_LIFETIME"))
+	if err != nil {
+		lifetime = 30 * time.Minute
+	}
+	return AccountSession{
+		secret:   secret,
+		lifetime: lifetime,
+		secure:   os.Getenv("ACCOUNT_SESSION_INSECURE") != "true",
+	}
+}
+
+// Create sets the session cookie for the user
+func (s *AccountSession) Create(w http.ResponseWriter, userID uint) {
+	expires := time.Now().Add(s.lifetime)
+	payload := fmt.Sprintf("%d|%d", userID, expires.Unix())
+	value := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + s.sign(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     accountSessionCookie,
+		Value:    value,
+		Path:     "/account",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// Read returns the id of the logged in user
+func (s *AccountSession) Read(r *http.Request) (uint, error) {
+	cookie, err := r.Cookie(accountSessionCookie)
+	if err != nil {
+		return 0, err
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 2 {
+		return 0, errors.New("malformed session cookie")
+	}
+	rawPayload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	payload := string(rawPayload)
+	if !hmac.Equal([]byte(s.sign(payload)), []byte(parts[1])) {
+		return 0, errors.New("invalid session signature")
+	}
+	values := strings.Split(payload, "|")
+	if len(values) != 2 {
+		return 0, errors.New("malformed session payload")
+	}
+	expires, err := strconv.ParseInt(values[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, errors.New("session expired")
+	}
+	userID, err := strconv.ParseUint(values[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint(userID), nil
+}
+
+// Destroy removes the session cookie
+func (s *AccountSession) Destroy(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accountSessionCookie,
+		Value:    "",
+		Path:     "/account",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (s *AccountSession) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAccountSession(t *testing.T) {
+	session := AccountSession{secret: []byte("secret"), lifetime: time.Minute}
+
+	recorder := httptest.NewRecorder()
+	session.Create(recorder, 42)
+	cookie := recorder.Result().Cookies()[0]
+
+	r := httptest.NewRequest("GET", "/account/consents", nil)
+	r.AddCookie(cookie)
+	userID, err := session.Read(r)
+	if err != nil || userID != 42 {
+		t.Error("session should contain the user", userID, err)
+	}
+
+	tampered := httptest.NewRequest("GET", "/account/consents", nil)
+	tampered.AddCookie(&http.Cookie{Name: cookie.Name, Value: "NDN8OTk5OTk5OTk5OQ." + cookie.Value[len(cookie.Value)-10:]})
+	if _, err := session.Read(tampered); err == nil {
+		t.Error("tampered session should be rejected")
+	}
+
+	other := AccountSession{secret: []byte("other"), lifetime: time.Minute}
+	if _, err := other.Read(r); err == nil {
+		t.Error("session signed with another secret should be rejected")
+	}
+
+	expired := AccountSession{secret: []byte("secret"), lifetime: -time.Minute}
+	recorder = httptest.NewRecorder()
+	expired.Create(recorder, 42)
+	r = httptest.NewRequest("GET", "/account/consents", nil)
+	r.AddCookie(recorder.Result().Cookies()[0])
+	if _, err := session.Read(r); err == nil {
+		t.Error("expired session should be rejected")
+	}
+}
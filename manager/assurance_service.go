@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"user-service/model"
+)
+
+// AssuranceService decides which acr the login of a consent needs for high-risk scopes and clients
+type AssuranceService struct {
+	config model.AssuranceConfig
+}
+
+// NewAssuranceService loads the required acr of scopes and clients from config/assurance_config.json
+func NewAssuranceService() AssuranceService {
+	pwd, err := os.Getwd()
+	if pwd == "/" {
+		pwd = ""
+	}
+	var config model.AssuranceConfig
+	assuranceFile, err := os.Open(pwd + "/config/assurance_config.json")
+	if err != nil {
+		log.Println(err)
+	} else {
+		if err = json.NewDecoder(assuranceFile).Decode(&config); err != nil {
+			log.Println(err)
+		}
+		assuranceFile.Close()
+	}
+	return AssuranceService{config: config}
+}
+
+// RequiredAcr returns the highest acr the client and the scopes require, empty if none is required
+func (s *AssuranceService) RequiredAcr(clientID string, scopes []string) string {
+	required := s.config.Clients[clientID]
+	for _, scope := range scopes {
+		if acr := s.config.Scopes[scope]; model.AcrLevel(acr) > model.AcrLevel(required) {
+			required = acr
+		}
+	}
+	return required
+}
+
+// stepUpURL returns the authorization request with the required acr in acr_values, hydra starts a new login with it.
+// It fails if the request already asked for the acr, so a login which cannot reach it does not loop
+func stepUpURL(requestURL, requiredAcr string) (string, error) {
+	stepUp, err := url.Parse(requestURL)
+	if err != nil {
+		return "", err
+	}
+	query := stepUp.Query()
+	if contains(strings.Fields(query.Get("acr_values")), requiredAcr) {
+		return "", errors.New("login did not reach the requested acr " + requiredAcr)
+	}
+	query.Set("acr_values", requiredAcr)
+	stepUp.RawQuery = query.Encode()
+	return stepUp.String(), nil
+}
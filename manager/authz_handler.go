@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"user-service/model"
+)
+
+type AuthzHandler struct {
+	authzService AuthzService
+}
+
+func NewAuthzHandler() AuthzHandler {
+	return AuthzHandler{
+		authzService: NewAuthzService(),
+	}
+}
+
+// Check answers if a subject has a role or permission in an application
+func (h *AuthzHandler) Check(w http.ResponseWriter, r *http.Request) {
+	var check model.AuthzCheck
+	if r.Method == "GET" {
+		query := r.URL.Query()
+		check = model.AuthzCheck{
+			Subject:     query.Get("subject"),
+			Application: query.Get("application"),
+			Role:        query.Get("role"),
+			Permission:  query.Get("permission"),
+		}
+	} else if r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&check); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Method must be GET or POST"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.authzService.Check(check))
+}
+
+// CheckBatch answers multiple checks with one request
+func (h *AuthzHandler) CheckBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Method must be POST"))
+		return
+	}
+	var batch model.AuthzBatchCheck
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.authzService.CheckBatch(batch))
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"user-service/model"
+)
+
+type cachedRoles struct {
+	userID       uint
+	applications map[string][]string
+	expires      time.Time
+}
+
+// AuthzService decides if a subject has a role or a derived permission in an application
+type AuthzService struct {
+	UserService UserService
+	Permissions model.PermissionMapping
+	cacheTTL    time.Duration
+	mutex       *sync.RWMutex
+	cache       map[string]cachedRoles
+}
+
+func NewAuthzService() AuthzService {
+	pwd, err := os.Getwd()
+	if pwd == "/" {
+		pwd = ""
+	}
+	permissions := make(model.PermissionMapping)
+	permissionFile, err := os.Open(pwd + "/config/permission_config.json")
+	if err != nil {
+		log.Println(err)
+	} else {
+		if err = json.NewDecoder(permissionFile).Decode(&permissions); err != nil {
+			log.Println(err)
+		}
+		permissionFile.Close()
+	}
+
+	cacheTTL, err := time.ParseDuration(os.Getenv("AUTHZ_CACHE_TTL"))
+	if err != nil {
+		cacheTTL = 5 * time.Minute
+	}
+
+	authzService := AuthzService{
+		UserService: NewUserService(),
+		Permissions: permissions,
+		cacheTTL:    cacheTTL,
+		mutex:       &sync.RWMutex{},
+		cache:       make(map[string]cachedRoles),
+	}
+	OnUserChange(authzService.invalidate)
+	return authzService
+}
+
+// Check evaluates a single authorization request
+func (s *AuthzService) Check(check model.AuthzCheck) model.AuthzDecision {
+	decision := model.AuthzDecision{
+		Subject:     check.Subject,
+		Application: check.Application,
+		Role:        check.Role,
+		Permission:  check.Permission,
+	}
+	if check.Subject == "" || check.Application == "" {
+		decision.Reason = "subject and application must be specified"
+		return decision
+	}
+	if check.Role == "" && check.Permission == "" {
+		decision.Reason = "role or permission must be specified"
+		return decision
+	}
+
+	applications, err := s.rolesOf(check.Subject)
+	if err != nil {
+		decision.Reason = "subject is unknown"
+		return decision
+	}
+	roles, ok := applications[check.Application]
+	if !ok || len(roles) == 0 {
+		decision.Reason = fmt.Sprintf("subject has no roles in application %s", check.Application)
+		return decision
+	}
+
+	if check.Role != "" {
+		if !contains(roles, check.Role) {
+			decision.Reason = fmt.Sprintf("subject does not have role %s in application %s", check.Role, check.Application)
+			return decision
+		}
+		if check.Permission == "" {
+			decision.Allowed = true
+			decision.Reason = fmt.Sprintf("subject has role %s in application %s", check.Role, check.Application)
+			return decision
+		}
+		roles = []string{check.Role}
+	}
+
+	for _, role := range roles {
+		if contains(s.Permissions[check.Application][role], check.Permission) {
+			decision.Allowed = true
+			decision.Reason = fmt.Sprintf("role %s grants permission %s in application %s", role, check.Permission, check.Application)
+			return decision
+		}
+	}
+	decision.Reason = fmt.Sprintf("no role of subject grants permission %s in application %s", check.Permission, check.Application)
+	return decision
+}
+
+// CheckBatch evaluates all requests in the given order
+func (s *AuthzService) CheckBatch(batch model.AuthzBatchCheck) model.AuthzBatchDecision {
+	decisions := make([]model.AuthzDecision, 0, len(batch.Checks))
+	for _, check := range batch.Checks {
+		decisions = append(decisions, s.Check(check))
+	}
+	return model.AuthzBatchDecision{Decisions: decisions}
+}
+
+func (s *AuthzService) rolesOf(subject string) (map[string][]string, error) {
+	s.mutex.RLock()
+	entry, ok := s.cache[subject]
+	s.mutex.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.applications, nil
+	}
+
+	user, err := s.UserService.FindUserBySubject(subject)
+	if err != nil {
+		return nil, err
+	}
+	applications := make(map[string][]string, len(user.Applications))
+	if user.Disabled != nil && *user.Disabled {
+		user.Applications = nil
+	}
+	for _, application := range user.Applications {
+		applications[application.ApplicationName] = append(applications[application.ApplicationName], application.Roles...)
+	}
+
+	s.mutex.Lock()
+	s.cache[subject] = cachedRoles{userID: user.ID, applications: applications, expires: time.Now().Add(s.cacheTTL)}
+	s.mutex.Unlock()
+	return applications, nil
+}
+
+func (s *AuthzService) invalidate(change UserChange) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for subject, entry := range s.cache {
+		if entry.userID == change.User.ID {
+			delete(s.cache, subject)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
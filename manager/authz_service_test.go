@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"user-service/model"
+
+	"github.com/jinzhu/gorm"
+)
+
+type mockUserDatabase struct {
+	users   []model.User
+	lookups int
+}
+
+func (m *mockUserDatabase) FindByUserName(userName string) (model.User, error) {
+	for _, user := range m.users {
+		if user.UserName == userName {
+			return user, nil
+		}
+	}
+	return model.User{}, gorm.ErrRecordNotFound
+}
+
+func (m *mockUserDatabase) FindBySubject(subject string) (model.User, error) {
+	m.lookups++
+	for _, user := range m.users {
+		if user.Subject == subject {
+			return user, nil
+		}
+	}
+	return model.User{}, gorm.ErrRecordNotFound
+}
+
+func (m *mockUserDatabase) FindByID(id uint) (model.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return model.User{}, gorm.ErrRecordNotFound
+}
+
+func (m *mockUserDatabase) FindByEmail(email string) (model.User, error) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return model.User{}, gorm.ErrRecordNotFound
+}
+
+func (m *mockUserDatabase) FindAllUsers() ([]model.User, error) {
+	return m.users, nil
+}
+
+func (m *mockUserDatabase) CreateUser(user *model.User) error {
+	user.ID = uint(len(m.users) + 1)
+	m.users = append(m.users, *user)
+	return nil
+}
+
+func (m *mockUserDatabase) UpdateUser(user *model.User) error {
+	for i := range m.users {
+		if m.users[i].ID == user.ID {
+			m.users[i] = *user
+		}
+	}
+	return nil
+}
+
+func (m *mockUserDatabase) UpdateTOTPStep(userID uint, step int64) (bool, error) {
+	for i := range m.users {
+		if m.users[i].ID == userID && m.users[i].TOTPLastStep < step {
+			m.users[i].TOTPLastStep = step
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockUserDatabase) DeleteUser(user *model.User) error {
+	for i := range m.users {
+		if m.users[i].ID == user.ID {
+			m.users = append(m.users[:i], m.users[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *mockUserDatabase) FindByEmailOrUserName(userName string) (model.User, error) {
+	if user, err := m.FindByUserName(userName); err == nil {
+		return user, nil
+	}
+	return m.FindByEmail(userName)
+}
+
+func (m *mockUserDatabase) FindUsersFromApplication(applicationName string) ([]model.User, error) {
+	return m.users, nil
+}
+
+func (m *mockUserDatabase) IsNotFoundError(err error) bool {
+	return gorm.IsRecordNotFoundError(err)
+}
+
+func (m *mockUserDatabase) CloseConnection() {}
+
+func newMockUserDatabase() *mockUserDatabase {
+	return &mockUserDatabase{users: []model.User{
+		{Model: gorm.Model{ID: 1}, Subject: "5b2c7c3e-4f0e-4c6a-9d1e-7a8b9c0d1e2f", UserName: "homer", Email: "homer@springfield.com", Applications: []model.Application{
+			{ApplicationName: "app", Roles: []string{"admin"}},
+		}},
+	}}
+}
+
+func newMockAuthzService(database *mockUserDatabase) AuthzService {
+	return AuthzService{
+		UserService: UserService{databaseHandler: database},
+		Permissions: model.PermissionMapping{"app": {"admin": {"users:write"}}},
+		cacheTTL:    time.Minute,
+		mutex:       &sync.RWMutex{},
+		cache:       make(map[string]cachedRoles),
+	}
+}
+
+func TestAuthzService_Check(t *testing.T) {
+	service := newMockAuthzService(newMockUserDatabase())
+
+	checks := []struct {
+		check   model.AuthzCheck
+		allowed bool
+	}{
+		{model.AuthzCheck{Subject: testSubject, Application: "app", Role: "admin"}, true},
+		{model.AuthzCheck{Subject: testSubject, Application: "app", Permission: "users:write"}, true},
+		{model.AuthzCheck{Subject: testSubject, Application: "app", Role: "admin", Permission: "users:delete"}, false},
+		{model.AuthzCheck{Subject: testSubject, Application: "other", Role: "admin"}, false},
+		{model.AuthzCheck{Subject: "homer", Application: "app", Role: "admin"}, false},
+		{model.AuthzCheck{Subject: "homer@springfield.com", Application: "app", Role: "admin"}, false},
+		{model.AuthzCheck{Subject: testSubject, Application: "app"}, false},
+	}
+	for _, c := range checks {
+		decision := service.Check(c.check)
+		if decision.Allowed != c.allowed {
+			t.Errorf("%+v: expected allowed %v but got %v (%s)", c.check, c.allowed, decision.Allowed, decision.Reason)
+		}
+		if decision.Reason == "" {
+			t.Errorf("%+v: decision should contain a reason", c.check)
+		}
+	}
+}
+
+func TestAuthzService_Cache(t *testing.T) {
+	database := newMockUserDatabase()
+	service := newMockAuthzService(database)
+	check := model.AuthzCheck{Subject: testSubject, Application: "app", Role: "admin"}
+
+	service.Check(check)
+	service.Check(check)
+	if database.lookups != 1 {
+		t.Errorf("expected 1 lookup but got %d", database.lookups)
+	}
+
+	database.users[0].Applications = nil
+	service.invalidate(UserChange{Type: UserUpdated, User: database.users[0]})
+	if service.Check(check).Allowed {
+		t.Error("cache should be invalidated after user update")
+	}
+}
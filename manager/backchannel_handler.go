@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"user-service/provider"
+)
+
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// BackChannelHandler receives the logout tokens of an upstream OpenID provider (OIDC back-channel logout)
+// and ends the hydra sessions of the user the upstream subject is linked to,
+// hydra then notifies the clients with a back-channel logout uri
+type BackChannelHandler struct {
+	keys              *provider.RemoteKeySet
+	issuer            string
+	audience          string
+	sessionService    SessionService
+	userService       UserService
+	federationService FederationService
+	mutex             *sync.Mutex
+	seenTokens        map[string]time.Time
+}
+
+// backChannelTokenLifespan is how long logout tokens without exp are accepted and their ids are remembered
+const backChannelTokenLifespan = 5 * time.Minute
+
+// NewBackChannelHandler returns nil unless BACKCHANNEL_ISSUER, BACKCHANNEL_JWKS_URI and BACKCHANNEL_AUDIENCE are set
+func NewBackChannelHandler() *BackChannelHandler {
+	issuer := os.Getenv("BACKCHANNEL_ISSUER")
+	jwksURI := os.Getenv("BACKCHANNEL_JWKS_URI")
+	audience := os.Getenv("BACKCHANNEL_AUDIENCE")
+	if issuer == "" || jwksURI == "" || audience == "" {
+		log.Println("BACKCHANNEL_ISSUER, BACKCHANNEL_JWKS_URI or BACKCHANNEL_AUDIENCE is not set, back-channel logout is disabled")
+		return nil
+	}
+	return &BackChannelHandler{
+		keys:              provider.NewRemoteKeySet(jwksURI),
+		issuer:            issuer,
+		audience:          audience,
+		sessionService:    NewSessionService(),
+		userService:       NewUserService(),
+		federationService: NewFederationService(),
+		mutex:             &sync.Mutex{},
+		seenTokens:        make(map[string]time.Time),
+	}
+}
+
+// LogoutHandler ends the sessions of the user the sub of a logout token is linked to. The sessions of the upstream
+// provider are unknown to hydra, so tokens with only a sid are rejected and the sid is not used
+func (h *BackChannelHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method must be POST"))
+		return
+	}
+	claims, err := h.verify(r.PostFormValue("logout_token"))
+	if err != nil {
+		log.Printf("rejected logout token: %v", err)
+		writeBackChannelError(w, err)
+		return
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		log.Println("rejected logout token: sessions of the upstream provider are unknown, sub is required")
+		writeBackChannelError(w, errors.New("sub is required"))
+		return
+	}
+	userID, err := h.federationService.FindUserID(h.issuer, subject)
+	if err != nil {
+		log.Printf("no user is linked to subject %s of %s: %v", subject, h.issuer, err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	user, err := h.userService.FindUser(userID)
+	if err != nil {
+		log.Printf("user %d linked to subject %s of %s was not found", userID, subject, h.issuer)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err := h.sessionService.RevokeUserSessions(r.Context(), user, LogoutReasonBackChannel); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// verify checks a logout token as required by OpenID Connect Back-Channel Logout 1.0 section 2.6
+func (h *BackChannelHandler) verify(token string) (map[string]interface{}, error) {
+	if token == "" {
+		return nil, errors.New("logout_token is missing")
+	}
+	claims, err := h.keys.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if issuer, _ := claims["iss"].(string); issuer != h.issuer {
+		return nil, errors.New("wrong issuer")
+	}
+	if !containsAudience(claims["aud"], h.audience) {
+		return nil, errors.New("wrong audience")
+	}
+	now := time.Now()
+	issuedAt, ok := claims["iat"].(float64)
+	if !ok || time.Unix(int64(issuedAt), 0).After(now.Add(time.Minute)) {
+		return nil, errors.New("iat is missing or in the future")
+	}
+	expires := time.Unix(int64(issuedAt), 0).Add(backChannelTokenLifespan)
+	if exp, ok := claims["exp"].(float64); ok {
+		expires = time.Unix(int64(exp), 0)
+	}
+	if !expires.After(now) {
+		return nil, errors.New("token is expired")
+	}
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[backChannelLogoutEvent]; !ok {
+		return nil, errors.New("back-channel logout event is missing")
+	}
+	if _, ok := claims["nonce"]; ok {
+		return nil, errors.New("logout token must not contain a nonce")
+	}
+	subject, _ := claims["sub"].(string)
+	sessionID, _ := claims["sid"].(string)
+	if subject == "" && sessionID == "" {
+		return nil, errors.New("sub or sid is missing")
+	}
+	tokenID, _ := claims["jti"].(string)
+	if tokenID == "" {
+		return nil, errors.New("jti is missing")
+	}
+	if !h.remember(tokenID, expires) {
+		return nil, errors.New("logout token was replayed")
+	}
+	return claims, nil
+}
+
+// remember stores the id of a token until it expires and reports whether it was unknown
+func (h *BackChannelHandler) remember(tokenID string, expires time.Time) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now := time.Now()
+	for id, seenExpires := range h.seenTokens {
+		if seenExpires.Before(now) {
+			delete(h.seenTokens, id)
+		}
+	}
+	if _, ok := h.seenTokens[tokenID]; ok {
+		return false
+	}
+	h.seenTokens[tokenID] = expires
+	return true
+}
+
+func containsAudience(aud interface{}, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, entry := range value {
+			if entry == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeBackChannelError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request", "error_description": err.Error()})
+}
@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"user-service/adapter"
+	"user-service/adapter/fake"
+	"user-service/model"
+	"user-service/provider"
+
+	"github.com/jinzhu/gorm"
+)
+
+type mockFederationDatabase struct {
+	links []model.FederatedSubject
+}
+
+func (m *mockFederationDatabase) CreateFederatedSubject(link *model.FederatedSubject) error {
+	m.links = append(m.links, *link)
+	return nil
+}
+
+func (m *mockFederationDatabase) FindFederatedSubject(issuer, subject string) (model.FederatedSubject, error) {
+	for _, link := range m.links {
+		if link.Issuer == issuer && link.Subject == subject {
+			return link, nil
+		}
+	}
+	return model.FederatedSubject{}, gorm.ErrRecordNotFound
+}
+
+func (m *mockFederationDatabase) FindFederatedSubjects(userID uint) ([]model.FederatedSubject, error) {
+	return m.links, nil
+}
+
+func (m *mockFederationDatabase) DeleteFederatedSubject(userID uint, issuer, subject string) error {
+	m.links = nil
+	return nil
+}
+
+func (m *mockFederationDatabase) IsNotFoundError(err error) bool {
+	return gorm.IsRecordNotFoundError(err)
+}
+
+// signLogoutToken signs the claims with RS256 and the key id "upstream"
+func signLogoutToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "logout+jwt", "kid": "upstream"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestBackChannelHandler_Logout(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(provider.JSONWebKeySet{Keys: []provider.JSONWebKey{{
+			KeyType: "RSA", Use: "sig", Algorithm: "RS256", KeyID: "upstream",
+			Modulus:  base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			Exponent: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+
+	hydra := fake.NewHydra()
+	hydra.Version = "v2.2.0"
+	hydraServer := httptest.NewServer(hydra)
+	defer hydraServer.Close()
+	os.Setenv("HYDRA_URL", hydraServer.URL)
+	hydraAdapter := adapter.NewHydraAdapter()
+
+	handler := BackChannelHandler{
+		keys:              provider.NewRemoteKeySet(jwks.URL),
+		issuer:            "https://upstream",
+		audience:          "idprovider",
+		sessionService:    newTestSessionService(&hydraAdapter),
+		userService:       UserService{databaseHandler: newMockUserDatabase()},
+		federationService: FederationService{databaseHandler: &mockFederationDatabase{}},
+		mutex:             &sync.Mutex{},
+		seenTokens:        make(map[string]time.Time),
+	}
+	if err := handler.federationService.Link(1, model.FederatedSubjectDTO{Issuer: "https://upstream", Subject: "upstream-homer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.federationService.Link(2, model.FederatedSubjectDTO{Issuer: "https://upstream", Subject: "upstream-homer"}); err == nil {
+		t.Error("upstream subject should not be linked to two users")
+	}
+	tokenCount := 0
+	logoutClaims := func(changes map[string]interface{}) map[string]interface{} {
+		tokenCount++
+		claims := map[string]interface{}{
+			"iss":    "https://upstream",
+			"aud":    []string{"idprovider"},
+			"iat":    time.Now().Unix(),
+			"jti":    strconv.Itoa(tokenCount),
+			"sub":    "upstream-homer",
+			"events": map[string]interface{}{backChannelLogoutEvent: map[string]interface{}{}},
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+
+	valid := signLogoutToken(t, key, logoutClaims(nil))
+	if rec := postForm(handler.LogoutHandler, "/logout/backchannel", url.Values{"logout_token": {valid}}); rec.Code != http.StatusOK {
+		t.Fatalf("valid logout token should be accepted but got %d: %s", rec.Code, rec.Body.String())
+	}
+	if revocations := hydra.Revocations(); len(revocations) == 0 || revocations[0] != (fake.Revocation{Kind: "login", Subject: testSubject}) {
+		t.Error("sessions of the user should be revoked", revocations)
+	}
+	if rec := postForm(handler.LogoutHandler, "/logout/backchannel", url.Values{"logout_token": {valid}}); rec.Code != http.StatusBadRequest {
+		t.Error("replayed logout token should be rejected", rec.Code)
+	}
+
+	for name, changes := range map[string]map[string]interface{}{
+		"wrong issuer":     {"iss": "https://other"},
+		"wrong audience":   {"aud": "other"},
+		"missing event":    {"events": nil},
+		"nonce":            {"nonce": "abc"},
+		"missing jti":      {"jti": nil},
+		"expired":          {"exp": time.Now().Add(-time.Minute).Unix()},
+		"no sub and sid":   {"sub": nil},
+		"issued in future": {"iat": time.Now().Add(time.Hour).Unix()},
+	} {
+		token := signLogoutToken(t, key, logoutClaims(changes))
+		rec := postForm(handler.LogoutHandler, "/logout/backchannel", url.Values{"logout_token": {token}})
+		if rec.Code != http.StatusBadRequest || rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("logout token with %s should be rejected but got %d", name, rec.Code)
+		}
+	}
+
+	revoked := len(hydra.Revocations())
+	sessionOnly := signLogoutToken(t, key, logoutClaims(map[string]interface{}{"sub": nil, "sid": "session-1"}))
+	if rec := postForm(handler.LogoutHandler, "/logout/backchannel", url.Values{"logout_token": {sessionOnly}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("logout token with only the sid of the upstream provider should be rejected but got %d", rec.Code)
+	}
+	for _, subject := range []string{testSubject, "homer", "upstream-bart"} {
+		unlinked := signLogoutToken(t, key, logoutClaims(map[string]interface{}{"sub": subject}))
+		if rec := postForm(handler.LogoutHandler, "/logout/backchannel", url.Values{"logout_token": {unlinked}}); rec.Code != http.StatusOK {
+			t.Errorf("logout token of unlinked subject %s should be ignored but got %d", subject, rec.Code)
+		}
+	}
+	if len(hydra.Revocations()) != revoked {
+		t.Error("no sessions should be revoked for sid only or unlinked subjects", hydra.Revocations())
+	}
+}
@@ -0,0 +1,120 @@
+package manager
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"user-service/model"
+)
+
+// ClaimsService maps the attributes of a user to the claims of the access token and id token
+type ClaimsService struct {
+	config model.ClaimsConfig
+}
+
+// NewClaimsService loads the claim rules from config/claims_config.json
+func NewClaimsService() ClaimsService {
+	pwd, err := os.Getwd()
+	if pwd == "/" {
+		pwd = ""
+	}
+	config, err := readClaimsConfig(pwd + "/config/claims_config.json")
+	if err != nil {
+		log.Println(err)
+	}
+	return ClaimsService{config: config}
+}
+
+// readClaimsConfig reads the claim rules from the file at path
+func readClaimsConfig(path string) (model.ClaimsConfig, error) {
+	var config model.ClaimsConfig
+	claimsFile, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer claimsFile.Close()
+	err = json.NewDecoder(claimsFile).Decode(&config)
+	return config, err
+}
+
+// BuildSession returns the claims of the user for the client and the granted scopes
+func (s *ClaimsService) BuildSession(user model.UserDTO, clientID string, grantedScopes []string) model.SessionInfo {
+	session := model.SessionInfo{
+		AccessToken: make(map[string]interface{}),
+		IDToken:     make(map[string]interface{}),
+	}
+	for _, rule := range s.rules(clientID) {
+		if rule.Scope != "" && !contains(grantedScopes, rule.Scope) {
+			continue
+		}
+		value, ok := claimValue(rule, user, clientID)
+		if !ok {
+			continue
+		}
+		if len(rule.Tokens) == 0 || contains(rule.Tokens, model.AccessTokenClaims) {
+			session.AccessToken[rule.Claim] = value
+		}
+		if len(rule.Tokens) == 0 || contains(rule.Tokens, model.IDTokenClaims) {
+			session.IDToken[rule.Claim] = value
+		}
+	}
+	return session
+}
+
+// rules returns the default rules with the rules of the client replacing those of the same claim
+func (s *ClaimsService) rules(clientID string) []model.ClaimRule {
+	defaults := s.config.Default
+	clientRules := s.config.Clients[clientID]
+	rules := make([]model.ClaimRule, 0, len(defaults)+len(clientRules))
+	for _, rule := range defaults {
+		replaced := false
+		for _, clientRule := range clientRules {
+			replaced = replaced || clientRule.Claim == rule.Claim
+		}
+		if !replaced {
+			rules = append(rules, rule)
+		}
+	}
+	return append(rules, clientRules...)
+}
+
+func claimValue(rule model.ClaimRule, user model.UserDTO, clientID string) (interface{}, bool) {
+	if rule.Attribute == "" {
+		return rule.Value, rule.Value != nil
+	}
+	switch rule.Attribute {
+	case "userName":
+		return user.UserName, user.UserName != ""
+	case "name":
+		return user.Name, user.Name != ""
+	case "lastName":
+		return user.LastName, user.LastName != ""
+	case "fullName":
+		fullName := strings.TrimSpace(user.Name + " " + user.LastName)
+		return fullName, fullName != ""
+	case "email":
+		return user.Email, user.Email != ""
+	case "roles":
+		return rolesFor(user, clientID), true
+	case "applications":
+		applications := make(map[string][]string, len(user.Applications))
+		for _, application := range user.Applications {
+			applications[application.ApplicationName] = append(applications[application.ApplicationName], application.Roles...)
+		}
+		return applications, true
+	}
+	log.Printf("unknown attribute %s of claim %s", rule.Attribute, rule.Claim)
+	return nil, false
+}
+
+// rolesFor returns the roles of the user in the application of the client
+func rolesFor(user model.UserDTO, clientID string) []string {
+	roles := make([]string, 0)
+	for _, application := range user.Applications {
+		if application.ApplicationName == clientID {
+			roles = append(roles, application.Roles...)
+		}
+	}
+	return roles
+}
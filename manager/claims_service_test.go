@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"testing"
+	"user-service/model"
+)
+
+// newTestClaimsService loads the claim rules of the repository config
+func newTestClaimsService(t *testing.T) ClaimsService {
+	config, err := readClaimsConfig("../config/claims_config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ClaimsService{config: config}
+}
+
+func TestClaimsService_BuildSession(t *testing.T) {
+	service := newTestClaimsService(t)
+	service.config.Clients = map[string][]model.ClaimRule{
+		"app": {
+			{Claim: "https://app/roles", Attribute: "roles", Tokens: []string{model.AccessTokenClaims}},
+			{Claim: "roles", Attribute: "roles", Tokens: []string{model.IDTokenClaims}},
+			{Claim: "tenant", Value: "springfield"},
+		},
+	}
+	user := model.UserDTO{
+		UserName: "homer",
+		Name:     "Homer",
+		LastName: "Simpson",
+		Email:    "homer@springfield.com",
+		Applications: []model.ApplicationRoleDTO{
+			{ApplicationName: "app", Roles: []string{"admin"}},
+			{ApplicationName: "other", Roles: []string{"user"}},
+		},
+	}
+
+	session := service.BuildSession(user, "app", []string{"openid", "profile"})
+	if session.IDToken["given_name"] != "Homer" || session.IDToken["family_name"] != "Simpson" || session.IDToken["name"] != "Homer Simpson" {
+		t.Error("profile scope should add the profile claims", session.IDToken)
+	}
+	if _, ok := session.IDToken["email"]; ok {
+		t.Error("email claim requires the email scope", session.IDToken)
+	}
+	if roles, ok := session.AccessToken["https://app/roles"].([]string); !ok || len(roles) != 1 || roles[0] != "admin" {
+		t.Error("access token should contain the namespaced roles of the client", session.AccessToken)
+	}
+	if _, ok := session.AccessToken["roles"]; ok {
+		t.Error("roles of the client rule should only be added to the id token", session.AccessToken)
+	}
+	if session.AccessToken["tenant"] != "springfield" || session.IDToken["tenant"] != "springfield" {
+		t.Error("fixed claims should be added to both tokens", session)
+	}
+
+	session = service.BuildSession(user, "other", []string{"openid", "email"})
+	if session.IDToken["email"] != "homer@springfield.com" || session.IDToken["preferred_username"] != nil {
+		t.Error("email scope should only add the email claim", session.IDToken)
+	}
+	if _, ok := session.AccessToken["tenant"]; ok {
+		t.Error("claims of a client should not be added for other clients", session.AccessToken)
+	}
+}
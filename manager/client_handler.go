@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"encoding/json"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type ClientHandler struct {
+	ClientPath     string
+	clientService  ClientService
+	sessionService SessionService
+}
+
+func NewClientHandler() ClientHandler {
+	configService, err := NewConfigService()
+	if err != nil {
+		log.Print("Could not create config")
+		log.Fatal(err)
+	}
+
+	return ClientHandler{
+		ClientPath:     "/client/",
+		clientService:  NewClientService(configService.AcceptLoginData),
+		sessionService: NewSessionService(),
+	}
+}
+
+// ManageClients reads, overrides and resets the settings of hydra clients and revokes their tokens
+func (h *ClientHandler) ManageClients(w http.ResponseWriter, r *http.Request) {
+	clientID := strings.Trim(strings.TrimPrefix(html.EscapeString(r.URL.Path), strings.TrimSuffix(h.ClientPath, "/")), "/")
+
+	if strings.HasSuffix(clientID, "/tokens") && r.Method == "DELETE" {
+		if err := h.sessionService.RevokeClientTokens(r.Context(), strings.TrimSuffix(clientID, "/tokens")); err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		if clientID != "" {
+			json.NewEncoder(w).Encode(h.clientService.FetchClientSettings(clientID))
+			return
+		}
+		clientSettings, err := h.clientService.FindAllClientSettings()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(clientSettings)
+		return
+	}
+
+	if clientID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("client id must be specified"))
+		return
+	}
+
+	if r.Method == "PUT" {
+		rawSettings, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		settings, err := h.clientService.OverrideClientSettings(clientID, rawSettings)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+		return
+	}
+	if r.Method == "DELETE" {
+		if err := h.clientService.ResetClientSettings(clientID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte("Method must be GET, PUT or DELETE"))
+}
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"user-service/model"
+	"user-service/repository"
+)
+
+type ClientDatabaseHandler interface {
+	FindAllClientSettingsOverrides() ([]model.ClientSettingsOverride, error)
+	FindClientSettingsOverride(string) (model.ClientSettingsOverride, error)
+	SaveClientSettingsOverride(*model.ClientSettingsOverride) error
+	DeleteClientSettingsOverride(string) error
+	IsNotFoundError(error) bool
+}
+
+// ClientService provides the settings of hydra clients from config/client_config.json and the admin api
+type ClientService struct {
+	defaults        model.ClientSettings
+	fileSettings    map[string]model.ClientSettings
+	databaseHandler ClientDatabaseHandler
+}
+
+// NewClientService loads the client settings, acceptLoginData is used as default for clients without settings
+func NewClientService(acceptLoginData model.AcceptLogin) ClientService {
+	databaseHandler, err := repository.NewDatabaseHandler()
+	if err != nil {
+		log.Println("could not create new Service due to database initialization")
+		log.Fatal(err)
+	}
+
+	defaults := model.ClientSettings{
+		LoginRemember:    acceptLoginData.Remember,
+		LoginRememberFor: acceptLoginData.RememberFor,
+		ConsentRemember:  true,
+	}
+
+	pwd, err := os.Getwd()
+	if pwd == "/" {
+		pwd = ""
+	}
+	rawSettings := make(map[string]json.RawMessage)
+	clientFile, err := os.Open(pwd + "/config/client_config.json")
+	if err != nil {
+		log.Println(err)
+	} else {
+		if err = json.NewDecoder(clientFile).Decode(&rawSettings); err != nil {
+			log.Println(err)
+		}
+		clientFile.Close()
+	}
+
+	fileSettings := make(map[string]model.ClientSettings, len(rawSettings))
+	for clientID, raw := range rawSettings {
+		settings := defaults
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			log.Printf("invalid settings for client %s: %v", clientID, err)
+			continue
+		}
+		settings.ClientID = clientID
+		if settings.SubjectType == SubjectTypePairwise && os.Getenv("SUBJECT_SALT") == "" {
+			log.Fatalf("client %s uses pairwise subjects: %v", clientID, errMissingSubjectSalt)
+		}
+		fileSettings[clientID] = settings
+	}
+
+	return ClientService{
+		defaults:        defaults,
+		fileSettings:    fileSettings,
+		databaseHandler: &databaseHandler,
+	}
+}
+
+// FetchClientSettings returns the settings of a client, overrides from the admin api take precedence over the config
+func (s *ClientService) FetchClientSettings(clientID string) model.ClientSettings {
+	override, err := s.databaseHandler.FindClientSettingsOverride(clientID)
+	if err == nil {
+		if settings, err := s.decodeOverride(override); err == nil {
+			return settings
+		}
+	} else if !s.databaseHandler.IsNotFoundError(err) {
+		log.Println(err)
+	}
+	if settings, ok := s.fileSettings[clientID]; ok {
+		return settings
+	}
+	settings := s.defaults
+	settings.ClientID = clientID
+	return settings
+}
+
+// FindAllClientSettings returns the settings of all configured or overridden clients
+func (s *ClientService) FindAllClientSettings() ([]model.ClientSettings, error) {
+	settingsByClient := make(map[string]model.ClientSettings, len(s.fileSettings))
+	for clientID, settings := range s.fileSettings {
+		settingsByClient[clientID] = settings
+	}
+	overrides, err := s.databaseHandler.FindAllClientSettingsOverrides()
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		if settings, err := s.decodeOverride(override); err == nil {
+			settingsByClient[override.ClientID] = settings
+		}
+	}
+
+	clientSettings := make([]model.ClientSettings, 0, len(settingsByClient))
+	for _, settings := range settingsByClient {
+		clientSettings = append(clientSettings, settings)
+	}
+	sort.Slice(clientSettings, func(i, j int) bool { return clientSettings[i].ClientID < clientSettings[j].ClientID })
+	return clientSettings, nil
+}
+
+// OverrideClientSettings replaces the settings of a client, fields missing in rawSettings get the default value
+func (s *ClientService) OverrideClientSettings(clientID string, rawSettings []byte) (model.ClientSettings, error) {
+	if clientID == "" {
+		return model.ClientSettings{}, errors.New("client id must be specified")
+	}
+	settings := s.defaults
+	if err := json.Unmarshal(rawSettings, &settings); err != nil {
+		return model.ClientSettings{}, err
+	}
+	if settings.LoginRememberFor < 0 || settings.ConsentRememberFor < 0 {
+		return model.ClientSettings{}, errors.New("remember durations must not be negative")
+	}
+	if settings.SubjectType != "" && settings.SubjectType != SubjectTypePublic && settings.SubjectType != SubjectTypePairwise {
+		return model.ClientSettings{}, errors.New("subject type must be public or pairwise")
+	}
+	if settings.SubjectType == SubjectTypePairwise && os.Getenv("SUBJECT_SALT") == "" {
+		return model.ClientSettings{}, errMissingSubjectSalt
+	}
+	settings.ClientID = clientID
+	settings.Overridden = false
+
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return model.ClientSettings{}, err
+	}
+	override := model.ClientSettingsOverride{ClientID: clientID, Settings: string(encoded)}
+	if err := s.databaseHandler.SaveClientSettingsOverride(&override); err != nil {
+		return model.ClientSettings{}, err
+	}
+	settings.Overridden = true
+	return settings, nil
+}
+
+// ResetClientSettings removes the override of a client so the settings of the config apply again
+func (s *ClientService) ResetClientSettings(clientID string) error {
+	return s.databaseHandler.DeleteClientSettingsOverride(clientID)
+}
+
+func (s *ClientService) decodeOverride(override model.ClientSettingsOverride) (model.ClientSettings, error) {
+	settings := s.defaults
+	if err := json.Unmarshal([]byte(override.Settings), &settings); err != nil {
+		log.Printf("invalid settings override for client %s: %v", override.ClientID, err)
+		return settings, err
+	}
+	settings.ClientID = override.ClientID
+	settings.Overridden = true
+	return settings, nil
+}
+
+// filterAllowedScopes removes all scopes which are not allowed for the client
+func filterAllowedScopes(settings model.ClientSettings, scopes []string) []string {
+	if len(settings.AllowedScopes) == 0 {
+		return scopes
+	}
+	allowed := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if contains(settings.AllowedScopes, scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+	return allowed
+}
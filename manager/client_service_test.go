@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"os"
+	"testing"
+	"user-service/model"
+
+	"github.com/jinzhu/gorm"
+)
+
+type mockClientDatabase struct {
+	overrides map[string]model.ClientSettingsOverride
+}
+
+func (m *mockClientDatabase) FindAllClientSettingsOverrides() ([]model.ClientSettingsOverride, error) {
+	overrides := make([]model.ClientSettingsOverride, 0, len(m.overrides))
+	for _, override := range m.overrides {
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+func (m *mockClientDatabase) FindClientSettingsOverride(clientID string) (model.ClientSettingsOverride, error) {
+	override, ok := m.overrides[clientID]
+	if !ok {
+		return override, gorm.ErrRecordNotFound
+	}
+	return override, nil
+}
+
+func (m *mockClientDatabase) SaveClientSettingsOverride(override *model.ClientSettingsOverride) error {
+	m.overrides[override.ClientID] = *override
+	return nil
+}
+
+func (m *mockClientDatabase) DeleteClientSettingsOverride(clientID string) error {
+	delete(m.overrides, clientID)
+	return nil
+}
+
+func (m *mockClientDatabase) IsNotFoundError(err error) bool {
+	return gorm.IsRecordNotFoundError(err)
+}
+
+func TestClientService_FetchClientSettings(t *testing.T) {
+	service := ClientService{
+		defaults: model.ClientSettings{ConsentRemember: true},
+		fileSettings: map[string]model.ClientSettings{
+			"configured": {ClientID: "configured", SkipConsent: true, ConsentRemember: true},
+		},
+		databaseHandler: &mockClientDatabase{overrides: make(map[string]model.ClientSettingsOverride)},
+	}
+
+	if settings := service.FetchClientSettings("unknown"); !settings.ConsentRemember || settings.ClientID != "unknown" {
+		t.Error("unknown clients should get the defaults", settings)
+	}
+	if settings := service.FetchClientSettings("configured"); !settings.SkipConsent || settings.Overridden {
+		t.Error("configured clients should get the settings of the config", settings)
+	}
+
+	if _, err := service.OverrideClientSettings("configured", []byte(`{"loginRememberFor": 60}`)); err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	settings := service.FetchClientSettings("configured")
+	if settings.SkipConsent || settings.LoginRememberFor != 60 || !settings.ConsentRemember || !settings.Overridden {
+		t.Error("override should replace the settings and keep defaults for missing fields", settings)
+	}
+
+	if _, err := service.OverrideClientSettings("configured", []byte(`{"loginRememberFor": -1}`)); err == nil {
+		t.Error("negative durations should not be allowed")
+	}
+	os.Unsetenv("SUBJECT_SALT")
+	if _, err := service.OverrideClientSettings("configured", []byte(`{"subjectType": "pairwise"}`)); err != errMissingSubjectSalt {
+		t.Error("pairwise subjects should not be allowed without SUBJECT_SALT", err)
+	}
+
+	service.ResetClientSettings("configured")
+	if settings := service.FetchClientSettings("configured"); !settings.SkipConsent {
+		t.Error("reset should restore the settings of the config", settings)
+	}
+}
+
+func TestFilterAllowedScopes(t *testing.T) {
+	scopes := filterAllowedScopes(model.ClientSettings{AllowedScopes: []string{"openid"}}, []string{"openid", "offline"})
+	if len(scopes) != 1 || scopes[0] != "openid" {
+		t.Error("only allowed scopes should remain", scopes)
+	}
+	if scopes := filterAllowedScopes(model.ClientSettings{}, []string{"openid", "offline"}); len(scopes) != 2 {
+		t.Error("all scopes should be allowed without restriction", scopes)
+	}
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"user-service/adapter"
+	"user-service/model"
+)
+
+// DeviceHandler shows the verification page of the device flow on GET. On POST it accepts the user code the device
+// shows, the device authorization continues with the login and consent pages like a browser login.
+// User codes are short, so the attempts are limited per device challenge and per address
+func (h *Handler) DeviceHandler(w http.ResponseWriter, r *http.Request) {
+	challenge, err := readURLChallangeParams(r, "device")
+	if err != nil {
+		if r.URL.Query().Get("error") != "" {
+			h.ErrorHandler(w, r)
+			return
+		}
+		h.renderRequestError(w, r, err)
+		return
+	}
+
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			h.renderRequestError(w, r, err)
+			return
+		}
+		userCode := strings.TrimSpace(r.Form.Get("user_code"))
+		if !h.userCodeAttempts.Allow(challenge) || !h.userCodeAddresses.Allow(h.PolicyService.remoteIP(r).String()) {
+			log.Printf("too many user codes for device challenge %s", challenge)
+			w.WriteHeader(http.StatusTooManyRequests)
+			loginData := h.ConfigService.FetchDeviceConfig(challenge, userCode, false)
+			loginData.ErrorMessage = loginData.UserCodeLimitMessage
+			h.renderDevice(w, loginData)
+			return
+		}
+		redirectURL, err := h.LoginService.AcceptUserCode(r.Context(), challenge, userCode)
+		if hydraError, ok := adapter.AsHydraError(err); ok && !hydraError.IsServerError() {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			h.renderDevice(w, h.ConfigService.FetchDeviceConfig(challenge, userCode, true))
+			return
+		}
+		if err == errDeviceFlowUnsupported {
+			h.renderRequestError(w, r, err)
+			return
+		}
+		if err != nil {
+			h.renderHydraError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+		return
+	}
+
+	// the verification_uri_complete of the device carries the user code, the user still confirms it
+	h.renderDevice(w, h.ConfigService.FetchDeviceConfig(challenge, r.URL.Query().Get("user_code"), false))
+}
+
+// DeviceDoneHandler shows the page hydra redirects to after the device authorization was granted
+func (h *Handler) DeviceDoneHandler(w http.ResponseWriter, r *http.Request) {
+	loginData := h.ConfigService.FetchDeviceConfig("", "", false)
+	loginData.DeviceDone = true
+	h.renderDevice(w, loginData)
+}
+
+func (h *Handler) renderDevice(w http.ResponseWriter, loginData model.LoginPageData) {
+	templLogin := template.Must(template.ParseFiles(templateDir + "/login.html"))
+	templLogin.Execute(w, loginData)
+}
@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"user-service/model"
+	"user-service/repository"
+)
+
+const trustedDeviceCookie = "idp_trusted_device"
+
+type TrustedDeviceDatabaseHandler interface {
+	CreateTrustedDevice(*model.TrustedDevice) error
+	UpdateTrustedDevice(*model.TrustedDevice) error
+	FindTrustedDeviceByToken(string) (model.TrustedDevice, error)
+	FindTrustedDevices(uint) ([]model.TrustedDevice, error)
+	DeleteTrustedDevices(uint, uint) error
+}
+
+// TrustedDeviceService remembers browsers on which users do not need the second factor for some days
+type TrustedDeviceService struct {
+	databaseHandler TrustedDeviceDatabaseHandler
+	days            int
+	secure          bool
+}
+
+func NewTrustedDeviceService() *TrustedDeviceService {
+	databaseHandler, err := repository.NewDatabaseHandler()
+	if err != nil {
+		log.Println("could not create new Service due to database initialization")
+		log.Fatal(err)
+	}
+	days, err := strconv.Atoi(os.Getenv("TRUSTED_DEVICE_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return &TrustedDeviceService{
+		databaseHandler: &databaseHandler,
+		days:            days,
+		secure:          os.Getenv("LOGIN_SESSION_INSECURE") != "true",
+	}
+}
+
+// Days returns how long a browser is trusted, 0 if browsers cannot be trusted
+func (s *TrustedDeviceService) Days() int {
+	return s.days
+}
+
+// Trust remembers the browser of the request for the user
+func (s *TrustedDeviceService) Trust(w http.ResponseWriter, r *http.Request, userID uint) error {
+	if s.days == 0 {
+		return nil
+	}
+	rawToken := make([]byte, 32)
+	if _, err := rand.Read(rawToken); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(rawToken)
+	expires := time.Now().AddDate(0, 0, s.days)
+	device := model.TrustedDevice{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		Name:      r.UserAgent(),
+		ExpiresAt: expires,
+	}
+	if err := s.databaseHandler.CreateTrustedDevice(&device); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     trustedDeviceCookie,
+		Value:    token,
+		Path:     "/login",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// IsTrusted is true if the user trusts the browser of the request and did not revoke it
+func (s *TrustedDeviceService) IsTrusted(r *http.Request, userID uint) bool {
+	cookie, err := r.Cookie(trustedDeviceCookie)
+	if err != nil || s.days == 0 {
+		return false
+	}
+	device, err := s.databaseHandler.FindTrustedDeviceByToken(hashToken(cookie.Value))
+	if err != nil || device.UserID != userID || time.Now().After(device.ExpiresAt) {
+		return false
+	}
+	now := time.Now()
+	device.LastUsedAt = &now
+	if err := s.databaseHandler.UpdateTrustedDevice(&device); err != nil {
+		log.Println(err)
+	}
+	return true
+}
+
+// FindDevices returns the browsers the user trusts
+func (s *TrustedDeviceService) FindDevices(userID uint) ([]model.TrustedDeviceDTO, error) {
+	devices, err := s.databaseHandler.FindTrustedDevices(userID)
+	if err != nil {
+		return nil, err
+	}
+	deviceDTOs := make([]model.TrustedDeviceDTO, 0, len(devices))
+	for _, device := range devices {
+		deviceDTOs = append(deviceDTOs, model.TrustedDeviceDTO{
+			ID:         device.ID,
+			Name:       device.Name,
+			CreatedAt:  device.CreatedAt,
+			ExpiresAt:  device.ExpiresAt,
+			LastUsedAt: device.LastUsedAt,
+		})
+	}
+	return deviceDTOs, nil
+}
+
+// Revoke forgets a trusted browser of the user, all of them if deviceID is 0
+func (s *TrustedDeviceService) Revoke(userID, deviceID uint) error {
+	return s.databaseHandler.DeleteTrustedDevices(userID, deviceID)
+}
+
+// RevokeOnUserChange forgets the trusted browsers of users whose password or second factor changed
+// or who were disabled or deleted
+func (s *TrustedDeviceService) RevokeOnUserChange(change UserChange) {
+	if change.Type != UserPasswordChanged && change.Type != UserSecondFactorChanged && change.Type != UserDisabled && change.Type != UserDeleted {
+		return
+	}
+	if err := s.Revoke(change.User.ID, 0); err != nil {
+		log.Printf("could not revoke trusted devices of user %d after %s: %v", change.User.ID, change.Type, err)
+	}
+}
+
+// hashToken returns the hash of a token the browser holds, only hashes are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
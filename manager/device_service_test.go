@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-service/model"
+
+	"github.com/jinzhu/gorm"
+)
+
+type mockTrustedDeviceDatabase struct {
+	devices []model.TrustedDevice
+}
+
+func (m *mockTrustedDeviceDatabase) CreateTrustedDevice(device *model.TrustedDevice) error {
+	device.ID = uint(len(m.devices) + 1)
+	device.CreatedAt = time.Now()
+	m.devices = append(m.devices, *device)
+	return nil
+}
+
+func (m *mockTrustedDeviceDatabase) UpdateTrustedDevice(device *model.TrustedDevice) error {
+	for i := range m.devices {
+		if m.devices[i].ID == device.ID {
+			m.devices[i] = *device
+		}
+	}
+	return nil
+}
+
+func (m *mockTrustedDeviceDatabase) FindTrustedDeviceByToken(tokenHash string) (model.TrustedDevice, error) {
+	for _, device := range m.devices {
+		if device.TokenHash == tokenHash {
+			return device, nil
+		}
+	}
+	return model.TrustedDevice{}, gorm.ErrRecordNotFound
+}
+
+func (m *mockTrustedDeviceDatabase) FindTrustedDevices(userID uint) ([]model.TrustedDevice, error) {
+	devices := make([]model.TrustedDevice, 0)
+	for _, device := range m.devices {
+		if device.UserID == userID && device.ExpiresAt.After(time.Now()) {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+func (m *mockTrustedDeviceDatabase) DeleteTrustedDevices(userID, deviceID uint) error {
+	devices := make([]model.TrustedDevice, 0, len(m.devices))
+	for _, device := range m.devices {
+		if device.UserID != userID || (deviceID != 0 && device.ID != deviceID) {
+			devices = append(devices, device)
+		}
+	}
+	m.devices = devices
+	return nil
+}
+
+func newTestTrustedDeviceService() *TrustedDeviceService {
+	return &TrustedDeviceService{databaseHandler: &mockTrustedDeviceDatabase{}, days: 30}
+}
+
+func TestTrustedDeviceService(t *testing.T) {
+	service := newTestTrustedDeviceService()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.Header.Set("User-Agent", "Firefox")
+	if err := service.Trust(rec, req, 1); err != nil {
+		t.Fatal(err)
+	}
+	trusted := httptest.NewRequest("GET", "/login", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		trusted.AddCookie(cookie)
+	}
+
+	if !service.IsTrusted(trusted, 1) {
+		t.Error("browser should be trusted by the user")
+	}
+	if service.IsTrusted(trusted, 2) || service.IsTrusted(httptest.NewRequest("GET", "/login", nil), 1) {
+		t.Error("browser should only be trusted by the user who trusted it")
+	}
+	devices, _ := service.FindDevices(1)
+	if len(devices) != 1 || devices[0].Name != "Firefox" || devices[0].LastUsedAt == nil {
+		t.Error("trusted browser should be listed with its last use", devices)
+	}
+
+	service.RevokeOnUserChange(UserChange{Type: UserUpdated, User: model.User{Model: gorm.Model{ID: 1}}})
+	if !service.IsTrusted(trusted, 1) {
+		t.Error("updates should not revoke trusted browsers")
+	}
+	service.RevokeOnUserChange(UserChange{Type: UserPasswordChanged, User: model.User{Model: gorm.Model{ID: 1}}})
+	if service.IsTrusted(trusted, 1) {
+		t.Error("changed passwords should revoke trusted browsers")
+	}
+
+	rec = httptest.NewRecorder()
+	service.Trust(rec, req, 1)
+	trusted = httptest.NewRequest("GET", "/login", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		trusted.AddCookie(cookie)
+	}
+	service.RevokeOnUserChange(UserChange{Type: UserSecondFactorChanged, User: model.User{Model: gorm.Model{ID: 1}}})
+	if service.IsTrusted(trusted, 1) {
+		t.Error("changed second factors should revoke trusted browsers")
+	}
+}
+
+func TestTrustedDeviceService_Disabled(t *testing.T) {
+	service := newTestTrustedDeviceService()
+	service.days = 0
+	rec := httptest.NewRecorder()
+	service.Trust(rec, httptest.NewRequest("POST", "/login", nil), 1)
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("browsers should not be trusted if TRUSTED_DEVICE_DAYS is 0")
+	}
+	req := httptest.NewRequest("GET", "/login", nil)
+	req.AddCookie(&http.Cookie{Name: trustedDeviceCookie, Value: "token"})
+	if service.IsTrusted(req, 1) {
+		t.Error("unknown browsers should not be trusted")
+	}
+}
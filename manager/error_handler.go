@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"user-service/model"
+)
+
+// renderError logs the error with a correlation id and shows the error page with the same id
+func renderError(w http.ResponseWriter, r *http.Request, statusCode int, errorPageData model.ErrorPage, err error) {
+	errorPageData.CorrelationID = correlationID(r)
+	log.Printf("[%s] %s %s failed with status %d: %v", errorPageData.CorrelationID, r.Method, r.URL.Path, statusCode, err)
+
+	templError, templErr := template.ParseFiles(templateDir + "/error.html")
+	if templErr != nil {
+		log.Println(templErr)
+		http.Error(w, http.StatusText(statusCode)+" ("+errorPageData.CorrelationID+")", statusCode)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	templError.Execute(w, errorPageData)
+}
+
+// correlationID returns the X-Request-ID of the request or a new random id
+func correlationID(r *http.Request) string {
+	if requestID := r.Header.Get("X-Request-ID"); requestID != "" && len(requestID) <= 64 {
+		return requestID
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// renderHydraError shows an error page matching the failed hydra request
+func (h *Handler) renderHydraError(w http.ResponseWriter, r *http.Request, err error) {
+	statusCode, errorPageData := h.ConfigService.FetchHydraErrorConfig(err, r.Header.Get("Accept-Language"))
+	renderError(w, r, statusCode, errorPageData, err)
+}
+
+// renderRequestError shows an error page for an invalid request
+func (h *Handler) renderRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	errorPageData := h.ConfigService.FetchErrorConfig(r.Header.Get("Accept-Language"))
+	errorPageData.ErrorMessage = errorPageData.InvalidRequestMessage
+	renderError(w, r, http.StatusBadRequest, errorPageData, err)
+}
+
+// ErrorHandler shows the errors hydra redirects to its error url or an error parameter of a login, consent or logout redirect
+func (h *Handler) ErrorHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	errorName := query.Get("error")
+	if errorName == "" {
+		h.renderRequestError(w, r, errors.New("error page requested without error parameter"))
+		return
+	}
+	errorPageData := h.ConfigService.FetchRedirectErrorConfig(errorName, r.Header.Get("Accept-Language"))
+	statusCode := http.StatusBadRequest
+	if errorName == "access_denied" || errorName == "consent_required" || errorName == "login_required" {
+		statusCode = http.StatusForbidden
+	}
+	renderError(w, r, statusCode, errorPageData, &redirectError{name: errorName, description: query.Get("error_description"), hint: query.Get("error_hint")})
+}
+
+type redirectError struct {
+	name, description, hint string
+}
+
+func (e *redirectError) Error() string {
+	return "hydra redirected with error " + e.name + ": " + e.description + " " + e.hint
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/model"
+)
+
+func newErrorConfigService() ConfigService {
+	return ConfigService{
+		ErrorData: model.ErrorPage{
+			DefaultLanguage:      "de",
+			HydraErrorTitle:      "Anmeldung nicht möglich",
+			RequestFailedMessage: "Fehlgeschlagen",
+			ErrorMessages:        map[string]string{"access_denied": "Verweigert"},
+		},
+		ErrorPages: map[string]model.ErrorPage{
+			"en": {
+				DefaultLanguage:      "de",
+				HydraErrorTitle:      "Sign in failed",
+				RequestFailedMessage: "Failed",
+				ErrorMessages:        map[string]string{"access_denied": "Denied"},
+			},
+		},
+	}
+}
+
+func TestConfigService_FetchErrorConfig(t *testing.T) {
+	service := newErrorConfigService()
+
+	if errorPage := service.FetchErrorConfig("en-US,en;q=0.9"); errorPage.HydraErrorTitle != "Sign in failed" {
+		t.Error("english page should be used", errorPage)
+	}
+	if errorPage := service.FetchErrorConfig("de-DE,en;q=0.9"); errorPage.HydraErrorTitle != "Anmeldung nicht möglich" {
+		t.Error("default language should be preferred over a later language", errorPage)
+	}
+	if errorPage := service.FetchRedirectErrorConfig("unknown", "fr"); errorPage.ErrorMessage != "Fehlgeschlagen" {
+		t.Error("unknown errors should use the generic message", errorPage)
+	}
+	if errorPage := service.FetchRedirectErrorConfig("access_denied", "en"); errorPage.ErrorMessage != "Denied" {
+		t.Error("known errors should use their message", errorPage)
+	}
+}
+
+func TestHandler_ErrorHandler(t *testing.T) {
+	handler := Handler{ConfigService: newErrorConfigService()}
+
+	req := httptest.NewRequest("GET", "/error?error=access_denied&error_description=denied", nil)
+	req.Header.Set("X-Request-ID", "request-1")
+	rec := httptest.NewRecorder()
+	handler.ErrorHandler(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status %d but got %d", http.StatusForbidden, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "request-1") {
+		t.Error("correlation id should be shown", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.LoginHandler(rec, httptest.NewRequest("GET", "/login?error=invalid_request", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("error redirect to login should show the error page but got %d", rec.Code)
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/error", nil)
+	first, second := correlationID(req), correlationID(req)
+	if len(first) != 16 || first == second {
+		t.Error("correlation ids should be random", first, second)
+	}
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"errors"
+	"log"
+	"user-service/model"
+	"user-service/repository"
+)
+
+type FederationDatabaseHandler interface {
+	CreateFederatedSubject(*model.FederatedSubject) error
+	FindFederatedSubject(string, string) (model.FederatedSubject, error)
+	FindFederatedSubjects(uint) ([]model.FederatedSubject, error)
+	DeleteFederatedSubject(uint, string, string) error
+	IsNotFoundError(error) bool
+}
+
+// FederationService maps the subjects of upstream OpenID providers to users by explicit links
+type FederationService struct {
+	databaseHandler FederationDatabaseHandler
+}
+
+func NewFederationService() FederationService {
+	databaseHandler, err := repository.NewDatabaseHandler()
+	if err != nil {
+		log.Println("could not create new Service due to database initialization")
+		log.Fatal(err)
+	}
+	return FederationService{databaseHandler: &databaseHandler}
+}
+
+// Link links the subject of the upstream provider with the issuer to the user
+func (s *FederationService) Link(userID uint, link model.FederatedSubjectDTO) error {
+	if link.Issuer == "" || link.Subject == "" {
+		return errors.New("issuer and subject must be specified")
+	}
+	existing, err := s.databaseHandler.FindFederatedSubject(link.Issuer, link.Subject)
+	if err == nil {
+		if existing.UserID == userID {
+			return nil
+		}
+		return errors.New("subject is linked to another user")
+	}
+	if !s.databaseHandler.IsNotFoundError(err) {
+		return err
+	}
+	return s.databaseHandler.CreateFederatedSubject(&model.FederatedSubject{UserID: userID, Issuer: link.Issuer, Subject: link.Subject})
+}
+
+// Unlink removes the link of the upstream subject from the user
+func (s *FederationService) Unlink(userID uint, issuer, subject string) error {
+	if issuer == "" || subject == "" {
+		return errors.New("issuer and subject must be specified")
+	}
+	return s.databaseHandler.DeleteFederatedSubject(userID, issuer, subject)
+}
+
+// UnlinkOnUserChange removes the links of deleted users, so the upstream subjects can be linked to other users
+func (s *FederationService) UnlinkOnUserChange(change UserChange) {
+	if change.Type != UserDeleted {
+		return
+	}
+	if err := s.databaseHandler.DeleteFederatedSubject(change.User.ID, "", ""); err != nil {
+		log.Printf("could not remove the federated subjects of user %d: %v", change.User.ID, err)
+	}
+}
+
+// FindLinks returns the upstream subjects linked to the user
+func (s *FederationService) FindLinks(userID uint) ([]model.FederatedSubjectDTO, error) {
+	links, err := s.databaseHandler.FindFederatedSubjects(userID)
+	if err != nil {
+		return nil, err
+	}
+	linkDTOs := make([]model.FederatedSubjectDTO, 0, len(links))
+	for _, link := range links {
+		linkDTOs = append(linkDTOs, model.FederatedSubjectDTO{Issuer: link.Issuer, Subject: link.Subject, CreatedAt: link.CreatedAt})
+	}
+	return linkDTOs, nil
+}
+
+// FindUserID returns the id of the user the upstream subject is linked to
+func (s *FederationService) FindUserID(issuer, subject string) (uint, error) {
+	link, err := s.databaseHandler.FindFederatedSubject(issuer, subject)
+	if err != nil {
+		return 0, err
+	}
+	return link.UserID, nil
+}
@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"user-service/model"
+)
+
+// HookHandler serves the webhooks hydra calls, they are authenticated by the bearer token HOOK_API_KEY
+// or the api_key parameter for hydra versions which cannot send headers to hooks
+type HookHandler struct {
+	apiKey        string
+	userService   UserService
+	claimsService ClaimsService
+	clientService ClientService
+}
+
+func NewHookHandler() HookHandler {
+	apiKey := os.Getenv("HOOK_API_KEY")
+	if apiKey == "" {
+		log.Println("HOOK_API_KEY is not set, all hook requests are rejected")
+	}
+	configService, err := NewConfigService()
+	if err != nil {
+		log.Println(err)
+	}
+	return HookHandler{
+		apiKey:        apiKey,
+		userService:   NewUserService(),
+		claimsService: NewClaimsService(),
+		clientService: NewClientService(configService.AcceptLoginData),
+	}
+}
+
+// RefreshHandler recomputes the claims of refreshed tokens from the current user,
+// the refresh is denied for disabled or deleted users and users who lost the required membership
+func (h *HookHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method must be POST"))
+		return
+	}
+	if !h.authenticate(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var request model.RefreshHookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	session, err := h.Refresh(request)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.RefreshHookResponse{Session: session})
+}
+
+// Refresh recomputes the session of a refreshed grant, it is used by the hook of hydra and the embedded provider
+func (h *HookHandler) Refresh(request model.RefreshHookRequest) (model.SessionInfo, error) {
+	clientID := request.ClientID
+	if clientID == "" {
+		clientID = request.Requester.ClientID
+	}
+	grantedScopes := request.GrantedScopes
+	if len(grantedScopes) == 0 {
+		grantedScopes = request.Requester.GrantedScopes
+	}
+
+	user, err := h.userService.FindUserBySubject(request.Subject)
+	if err != nil {
+		log.Printf("refresh of subject %s for client %s denied: %v", request.Subject, clientID, err)
+		return model.SessionInfo{}, err
+	}
+	if user.Disabled != nil && *user.Disabled {
+		log.Printf("refresh of user %d for client %s denied: user is disabled", user.ID, clientID)
+		return model.SessionInfo{}, errors.New("user is disabled")
+	}
+	if h.clientService.FetchClientSettings(clientID).RequireMembership && len(rolesFor(user, clientID)) == 0 {
+		log.Printf("refresh of user %d for client %s denied: user has no roles for the client", user.ID, clientID)
+		return model.SessionInfo{}, errors.New("user has no roles for the client")
+	}
+	return h.claimsService.BuildSession(user, clientID, grantedScopes), nil
+}
+
+func (h *HookHandler) authenticate(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("api_key")
+	}
+	return h.apiKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.apiKey)) == 1
+}
@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/adapter/fake"
+	"user-service/model"
+)
+
+const testSubject = "5b2c7c3e-4f0e-4c6a-9d1e-7a8b9c0d1e2f"
+
+func newHookTest(t *testing.T) (*fake.Hydra, *mockUserDatabase) {
+	database := newMockUserDatabase()
+	handler := HookHandler{
+		apiKey:        "hook-key",
+		userService:   UserService{databaseHandler: database},
+		claimsService: newTestClaimsService(t),
+		clientService: ClientService{
+			fileSettings:    map[string]model.ClientSettings{"members-only": {ClientID: "members-only", RequireMembership: true}},
+			databaseHandler: &mockClientDatabase{overrides: make(map[string]model.ClientSettingsOverride)},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler.RefreshHandler))
+	t.Cleanup(srv.Close)
+
+	hydra := fake.NewHydra()
+	hydra.RefreshHookURL = srv.URL
+	hydra.HookAPIKey = "hook-key"
+	return hydra, database
+}
+
+func TestHookHandler_Refresh(t *testing.T) {
+	hydra, database := newHookTest(t)
+
+	session, allowed, err := hydra.Refresh(testSubject, "app", []string{"openid", "profile"})
+	if err != nil || !allowed {
+		t.Fatal("refresh should be allowed", err)
+	}
+	roles, _ := session.AccessToken["roles"].([]interface{})
+	if len(roles) != 1 || roles[0] != "admin" || session.IDToken["preferred_username"] != "homer" {
+		t.Error("refresh should return the current claims", session)
+	}
+
+	database.users[0].Applications = nil
+	session, allowed, err = hydra.Refresh(testSubject, "app", []string{"openid"})
+	if err != nil || !allowed {
+		t.Fatal("refresh should be allowed", err)
+	}
+	if roles, _ := session.AccessToken["roles"].([]interface{}); len(roles) != 0 {
+		t.Error("revoked role should be removed from the refreshed token", session)
+	}
+	if _, allowed, _ := hydra.Refresh(testSubject, "members-only", []string{"openid"}); allowed {
+		t.Error("refresh should be denied without the required membership")
+	}
+
+	database.users[0].Disabled = true
+	if _, allowed, _ := hydra.Refresh(testSubject, "app", []string{"openid"}); allowed {
+		t.Error("refresh of a disabled user should be denied")
+	}
+	if _, allowed, _ := hydra.Refresh("deleted-user", "app", []string{"openid"}); allowed {
+		t.Error("refresh of an unknown user should be denied")
+	}
+}
+
+func TestHookHandler_Authentication(t *testing.T) {
+	hydra, _ := newHookTest(t)
+
+	hydra.HookAPIKey = "wrong"
+	if _, allowed, err := hydra.Refresh(testSubject, "app", []string{"openid"}); allowed || err == nil {
+		t.Error("hook should reject requests with a wrong key", err)
+	}
+	hydra.HookAPIKey = ""
+	if _, allowed, err := hydra.Refresh(testSubject, "app", []string{"openid"}); allowed || err == nil {
+		t.Error("hook should reject requests without key", err)
+	}
+	hydra.RefreshHookURL += "?api_key=hook-key"
+	if _, allowed, err := hydra.Refresh(testSubject, "app", []string{"openid"}); !allowed || err != nil {
+		t.Error("hook should accept the key as parameter", err)
+	}
+}
@@ -0,0 +1,571 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"user-service/adapter"
+	"user-service/adapter/fake"
+	"user-service/model"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newFlowHandler creates a login handler talking to a fake hydra and a mock database with homer/secret
+func newFlowHandler(t *testing.T) (Handler, *fake.Hydra) {
+	hydra := fake.NewHydra()
+	hydra.ConsentURL = "http://127.0.0.1:3000/consent"
+	srv := httptest.NewServer(hydra)
+	t.Cleanup(srv.Close)
+	os.Setenv("HYDRA_URL", srv.URL)
+	hydraAdapter := adapter.NewHydraAdapter()
+
+	database := newMockUserDatabase()
+	password, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.users[0].Password = password
+
+	return Handler{
+		LoginService: LoginService{UserService: UserService{databaseHandler: database}, HydraAdapter: &hydraAdapter, ClaimsService: newTestClaimsService(t)},
+		ClientService: ClientService{
+			defaults:        model.ClientSettings{ConsentRemember: true},
+			databaseHandler: &mockClientDatabase{overrides: make(map[string]model.ClientSettingsOverride)},
+		},
+		LoginSession:         LoginSession{secret: []byte("secret"), lifetime: time.Hour},
+		secondFactorAttempts: newRateLimiter(secondFactorAttemptLimit, pendingLoginTimeout),
+		secondFactorLockouts: newRateLimiter(secondFactorUserLimit, secondFactorLockout),
+		userCodeAttempts:     newRateLimiter(userCodeAttemptLimit, userCodeWindow),
+		userCodeAddresses:    newRateLimiter(userCodeAddressLimit, userCodeWindow),
+	}, hydra
+}
+
+func postForm(handler http.HandlerFunc, target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestLoginFlow(t *testing.T) {
+	handler, hydra := newFlowHandler(t)
+	loginChallenge := hydra.StartLogin(model.Client{ClientID: "app"}, []string{"openid", "profile"}, "http://app/callback")
+
+	rec := postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge},
+	})
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login should redirect but got %d: %s", rec.Code, rec.Body.String())
+	}
+	consentURL, _ := url.Parse(rec.Header().Get("Location"))
+	consentChallenge := consentURL.Query().Get("consent_challenge")
+	if consentChallenge == "" {
+		t.Fatal("login should redirect to the consent page", consentURL)
+	}
+
+	rec = postForm(handler.AcceptConsentHandler, "/acceptConsent", url.Values{
+		"challenge": {consentChallenge}, "scope": {"openid", "profile"}, "accesToken": {"http://other-api"},
+	})
+	if rec.Code != http.StatusFound {
+		t.Fatalf("consent should redirect but got %d: %s", rec.Code, rec.Body.String())
+	}
+	if location := rec.Header().Get("Location"); !strings.HasPrefix(location, "http://app/callback?code=") {
+		t.Error("consent should redirect to the client with a code", location)
+	}
+
+	decisions := hydra.Decisions()
+	if len(decisions) != 2 || decisions[0].Kind != fake.Login || decisions[1].Kind != fake.Consent {
+		t.Fatal("login and consent should be accepted", decisions)
+	}
+	var acceptLogin model.AcceptLogin
+	json.Unmarshal(decisions[0].Body, &acceptLogin)
+	if acceptLogin.Subject != testSubject {
+		t.Error("login should be accepted for homer", acceptLogin)
+	}
+	var acceptConsent model.AcceptConsent
+	json.Unmarshal(decisions[1].Body, &acceptConsent)
+	roles, _ := acceptConsent.Session.IDToken["roles"].([]interface{})
+	if len(acceptConsent.GrantScope) != 2 || len(roles) != 1 || roles[0] != "admin" {
+		t.Error("consent should grant the scopes and roles", acceptConsent)
+	}
+	if len(acceptConsent.GrantAccessTokenAudience) != 0 {
+		t.Error("audiences the client did not request should not be granted", acceptConsent.GrantAccessTokenAudience)
+	}
+}
+
+func TestLoginFlow_DenyConsent(t *testing.T) {
+	handler, hydra := newFlowHandler(t)
+	consentChallenge := hydra.AddRequest(fake.Consent, model.LoginChallenge{
+		Subject: "homer", Client: model.Client{ClientID: "app"}, RequestedScope: []string{"openid"},
+	}, "http://app/callback")
+
+	rec := postForm(handler.AcceptConsentHandler, "/acceptConsent", url.Values{"challenge": {consentChallenge}, "action": {"deny"}})
+	if location := rec.Header().Get("Location"); rec.Code != http.StatusFound || !strings.Contains(location, "error=access_denied") {
+		t.Errorf("denied consent should redirect to the client with an error but got %d %s", rec.Code, location)
+	}
+
+	rec = postForm(handler.AcceptConsentHandler, "/acceptConsent", url.Values{"challenge": {consentChallenge}, "action": {"deny"}})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("handled consent should show the expired page but got %d", rec.Code)
+	}
+}
+
+func TestLoginFlow_RememberAndTrustedDevice(t *testing.T) {
+	useRepositoryTemplates(t)
+	handler, hydra := newFlowHandler(t)
+	handler.ClientService.fileSettings = map[string]model.ClientSettings{"app": {ClientID: "app", LoginRemember: true, LoginRememberFor: 3600}}
+	handler.TrustedDeviceService = newTestTrustedDeviceService()
+	handler.LoginService.UserService.databaseHandler.(*mockUserDatabase).users[0].TOTPSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	newChallenge := func() string {
+		return hydra.AddRequest(fake.Login, model.LoginChallenge{
+			Client: model.Client{ClientID: "app"}, RequestURL: "/oauth2/auth?client_id=app",
+			OidcContext: model.OidcContext{AcrValues: []string{model.AcrMFA}},
+		}, "http://app/callback")
+	}
+
+	loginChallenge := newChallenge()
+	rec := postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge}, "remember": {"true"},
+	})
+	pending := regexp.MustCompile(`name="pending" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	if pending == nil || !strings.Contains(rec.Body.String(), `name="trust"`) {
+		t.Fatalf("second factor page should offer to trust the browser: %s", rec.Body.String())
+	}
+	rec = postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+		"challenge": {loginChallenge}, "pending": {pending[1]}, "trust": {"true"},
+		"code": {totpCode([]byte("12345678901234567890"), time.Now().Unix()/totpPeriod)},
+	})
+	var acceptLogin model.AcceptLogin
+	json.Unmarshal(hydra.Decisions()[0].Body, &acceptLogin)
+	if rec.Code != http.StatusFound || !acceptLogin.Remember || acceptLogin.RememberFor != 3600 {
+		t.Fatal("login should be remembered for the maximum of the client", rec.Code, acceptLogin)
+	}
+	var trustCookie *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == trustedDeviceCookie {
+			trustCookie = cookie
+		}
+	}
+
+	// a new password login on the trusted browser does not ask for the code, without the checkbox it is not remembered
+	loginChallenge = newChallenge()
+	req := httptest.NewRequest("POST", "/login?login_challenge="+loginChallenge, strings.NewReader(url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	handler.LoginHandler(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("trusted browser should skip the second factor but got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.Unmarshal(hydra.Decisions()[1].Body, &acceptLogin)
+	if acceptLogin.Acr != model.AcrMFA || acceptLogin.Remember {
+		t.Error("login on a trusted browser should reach the second factor acr and not be remembered", acceptLogin)
+	}
+
+	// a login hydra skipped does not reach the second factor acr with the trusted browser alone
+	loginChallenge = hydra.AddRequest(fake.Login, model.LoginChallenge{
+		Skip: true, Subject: testSubject, Client: model.Client{ClientID: "app"}, RequestURL: "/oauth2/auth?client_id=app",
+		OidcContext: model.OidcContext{AcrValues: []string{model.AcrMFA}},
+	}, "http://app/callback")
+	req = httptest.NewRequest("GET", "/login?login_challenge="+loginChallenge, nil)
+	req.AddCookie(trustCookie)
+	rec = httptest.NewRecorder()
+	handler.LoginHandler(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `name="pending"`) || len(hydra.Decisions()) != 2 {
+		t.Errorf("skipped login on a trusted browser should ask for the code but got %d", rec.Code)
+	}
+}
+
+func TestLoginFlow_MagicLink(t *testing.T) {
+	useRepositoryTemplates(t)
+	handler, hydra := newFlowHandler(t)
+	handler.ClientService.fileSettings = map[string]model.ClientSettings{"app": {ClientID: "app", MagicLinkLogin: true}}
+	magicLinkService, dir := newTestMagicLinkService(t, handler.LoginService.UserService.databaseHandler)
+	handler.MagicLinkService = magicLinkService
+	loginChallenge := hydra.StartLogin(model.Client{ClientID: "app"}, []string{"openid"}, "http://app/callback")
+
+	rec := postForm(handler.MagicLinkHandler, "/login/magic", url.Values{"email": {"homer@springfield.com"}, "challenge": {loginChallenge}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login link should be sent but got %d: %s", rec.Code, rec.Body.String())
+	}
+	token := readMagicLink(t, dir)
+
+	// opening the link only asks to confirm the login, so mail scanners following it do not use it
+	rec = httptest.NewRecorder()
+	handler.MagicLinkHandler(rec, httptest.NewRequest("GET", "/login/magic?token="+url.QueryEscape(token), nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `name="token" value="`+token+`"`) || len(hydra.Decisions()) != 0 {
+		t.Fatalf("login link should show the confirmation but got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = postForm(handler.MagicLinkHandler, "/login/magic", url.Values{"token": {token}})
+	if rec.Code != http.StatusFound {
+		t.Fatalf("confirmed login link should redirect but got %d: %s", rec.Code, rec.Body.String())
+	}
+	var acceptLogin model.AcceptLogin
+	json.Unmarshal(hydra.Decisions()[0].Body, &acceptLogin)
+	if acceptLogin.Subject != testSubject || acceptLogin.Acr != model.AcrEmail {
+		t.Error("login link should log in homer with the email acr", acceptLogin)
+	}
+
+	if rec = postForm(handler.MagicLinkHandler, "/login/magic", url.Values{"token": {token}}); rec.Code == http.StatusFound {
+		t.Error("login link should only be used once")
+	}
+
+	handler.ClientService.fileSettings = map[string]model.ClientSettings{"app": {ClientID: "app"}}
+	loginChallenge = hydra.StartLogin(model.Client{ClientID: "app"}, []string{"openid"}, "http://app/callback")
+	rec = postForm(handler.MagicLinkHandler, "/login/magic", url.Values{"email": {"homer@springfield.com"}, "challenge": {loginChallenge}})
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.eml")); rec.Code == http.StatusOK || len(files) != 0 {
+		t.Errorf("clients without login links should not send mails but got %d", rec.Code)
+	}
+}
+
+func TestLoginFlow_Device(t *testing.T) {
+	useRepositoryTemplates(t)
+
+	// hydra v1 has no device flow, the user code is not sent to it
+	v1Handler, v1Hydra := newFlowHandler(t)
+	v1Challenge, v1UserCode := v1Hydra.StartDevice(model.Client{ClientID: "app"}, []string{"openid"})
+	rec := postForm(v1Handler.DeviceHandler, "/device?device_challenge="+v1Challenge, url.Values{"user_code": {v1UserCode}})
+	if rec.Code == http.StatusFound || len(v1Hydra.Decisions()) != 0 {
+		t.Errorf("device flow should be unsupported with hydra v1 but got %d", rec.Code)
+	}
+
+	handler, hydra := newFlowHandler(t)
+	hydra.Version = "v2.3.0"
+	hydra.LoginURL = "http://127.0.0.1:3000/login"
+	hydra.DeviceSuccessURL = "http://127.0.0.1:3000/device/done"
+	handler.AssuranceService = AssuranceService{config: model.AssuranceConfig{Scopes: map[string]string{"payments": model.AcrMFA}}}
+	deviceChallenge, userCode := hydra.StartDevice(model.Client{ClientID: "app"}, []string{"openid", "profile"})
+	target := "/device?device_challenge=" + deviceChallenge
+
+	rec = httptest.NewRecorder()
+	handler.DeviceHandler(rec, httptest.NewRequest("GET", target+"&user_code="+userCode, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="`+userCode+`"`) {
+		t.Fatalf("verification page should show the user code of the link but got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec = postForm(handler.DeviceHandler, target, url.Values{"user_code": {"WRONGCODE"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid user code should show the verification page again but got %d", rec.Code)
+	}
+
+	rec = postForm(handler.DeviceHandler, target, url.Values{"user_code": {" " + userCode + " "}})
+	loginURL, _ := url.Parse(rec.Header().Get("Location"))
+	loginChallenge := loginURL.Query().Get("login_challenge")
+	if rec.Code != http.StatusFound || loginChallenge == "" {
+		t.Fatalf("user code should redirect to the login but got %d %s", rec.Code, loginURL)
+	}
+	rec = postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge},
+	})
+	consentURL, _ := url.Parse(rec.Header().Get("Location"))
+	rec = postForm(handler.AcceptConsentHandler, "/acceptConsent", url.Values{
+		"challenge": {consentURL.Query().Get("consent_challenge")}, "scope": {"openid", "profile"}, "userName": {"homer"}, "clientName": {"app"},
+	})
+	if location := rec.Header().Get("Location"); rec.Code != http.StatusFound || location != hydra.DeviceSuccessURL {
+		t.Fatalf("consent should finish the device authorization but got %d %s", rec.Code, location)
+	}
+	decisions := hydra.Decisions()
+	var acceptConsent model.AcceptConsent
+	json.Unmarshal(decisions[len(decisions)-1].Body, &acceptConsent)
+	if roles, _ := acceptConsent.Session.IDToken["roles"].([]interface{}); len(roles) != 1 || roles[0] != "admin" {
+		t.Error("device should get the claims of a browser login", acceptConsent)
+	}
+
+	// the consent of a device cannot restart the authorization, the login asks for the second factor
+	deviceChallenge, userCode = hydra.StartDevice(model.Client{ClientID: "app"}, []string{"openid", "payments"})
+	rec = postForm(handler.DeviceHandler, "/device?device_challenge="+deviceChallenge, url.Values{"user_code": {userCode}})
+	loginURL, _ = url.Parse(rec.Header().Get("Location"))
+	loginChallenge = loginURL.Query().Get("login_challenge")
+	rec = postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge},
+	})
+	if location := rec.Header().Get("Location"); !strings.Contains(location, "error=unmet_authentication_requirements") {
+		t.Errorf("device login without the second factor for payments should be rejected but got %d %s", rec.Code, location)
+	}
+
+	// user codes are limited per device challenge and per address
+	deviceChallenge, userCode = hydra.StartDevice(model.Client{ClientID: "app"}, []string{"openid"})
+	target = "/device?device_challenge=" + deviceChallenge
+	for attempt := 0; attempt < userCodeAttemptLimit; attempt++ {
+		postForm(handler.DeviceHandler, target, url.Values{"user_code": {"WRONGCODE"}})
+	}
+	if rec = postForm(handler.DeviceHandler, target, url.Values{"user_code": {userCode}}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("user code should be rejected after too many codes for the device challenge but got %d", rec.Code)
+	}
+	handler.userCodeAddresses = newRateLimiter(1, userCodeWindow)
+	firstChallenge, _ := hydra.StartDevice(model.Client{ClientID: "app"}, []string{"openid"})
+	postForm(handler.DeviceHandler, "/device?device_challenge="+firstChallenge, url.Values{"user_code": {"WRONGCODE"}})
+	deviceChallenge, userCode = hydra.StartDevice(model.Client{ClientID: "app"}, []string{"openid"})
+	if rec = postForm(handler.DeviceHandler, "/device?device_challenge="+deviceChallenge, url.Values{"user_code": {userCode}}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("user code should be rejected after too many codes from the address but got %d", rec.Code)
+	}
+}
+
+func TestConsentFlow_StepUp(t *testing.T) {
+	handler, hydra := newFlowHandler(t)
+	handler.ClientService.fileSettings = map[string]model.ClientSettings{"app": {ClientID: "app", SkipConsent: true}}
+	handler.AssuranceService = AssuranceService{config: model.AssuranceConfig{Scopes: map[string]string{"payments": model.AcrMFA}}}
+
+	newChallenge := func(requestURL, acr string, scopes ...string) string {
+		return hydra.AddRequest(fake.Consent, model.LoginChallenge{
+			Subject: testSubject, Client: model.Client{ClientID: "app"}, RequestedScope: scopes, RequestURL: requestURL, Acr: acr,
+		}, "http://app/callback")
+	}
+	consent := func(challenge string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ConsentHandler(rec, httptest.NewRequest("GET", "/consent?consent_challenge="+challenge, nil))
+		return rec
+	}
+
+	rec := consent(newChallenge("http://hydra/oauth2/auth?client_id=app&state=abc", model.AcrPassword, "openid", "payments"))
+	stepUp, _ := url.Parse(rec.Header().Get("Location"))
+	if rec.Code != http.StatusFound || stepUp.Path != "/oauth2/auth" || stepUp.Query().Get("acr_values") != model.AcrMFA || stepUp.Query().Get("state") != "abc" {
+		t.Errorf("payments with a password login should restart the authorization with the required acr but got %d %s", rec.Code, stepUp)
+	}
+
+	rec = consent(newChallenge(stepUp.String(), model.AcrPassword, "openid", "payments"))
+	if location := rec.Header().Get("Location"); !strings.Contains(location, "error=unmet_authentication_requirements") {
+		t.Errorf("step-up which did not reach the acr should be rejected but got %d %s", rec.Code, location)
+	}
+
+	for _, challenge := range []string{newChallenge(stepUp.String(), model.AcrMFA, "openid", "payments"), newChallenge("http://hydra/oauth2/auth", model.AcrPassword, "openid")} {
+		if location := consent(challenge).Header().Get("Location"); !strings.HasPrefix(location, "http://app/callback?code=") {
+			t.Error("consent which meets the required acr should be accepted", location)
+		}
+	}
+}
+
+// useRepositoryTemplates renders the pages from the templates of the repository
+func useRepositoryTemplates(t *testing.T) {
+	dir := templateDir
+	templateDir = "../templates"
+	t.Cleanup(func() { templateDir = dir })
+}
+
+func TestLoginFlow_Prompt(t *testing.T) {
+	useRepositoryTemplates(t)
+	handler, hydra := newFlowHandler(t)
+
+	loginChallenge := hydra.AddRequest(fake.Login, model.LoginChallenge{
+		Client: model.Client{ClientID: "app"}, RequestURL: "/oauth2/auth?client_id=app&prompt=none",
+	}, "http://app/callback")
+	rec := httptest.NewRecorder()
+	handler.LoginHandler(rec, httptest.NewRequest("GET", "/login?login_challenge="+loginChallenge, nil))
+	if location := rec.Header().Get("Location"); rec.Code != http.StatusFound || !strings.Contains(location, "error=login_required") {
+		t.Errorf("prompt=none without session should be rejected with login_required but got %d %s", rec.Code, location)
+	}
+
+	loginChallenge = hydra.AddRequest(fake.Login, model.LoginChallenge{
+		Skip: true, Subject: testSubject, Client: model.Client{ClientID: "app"},
+		RequestURL:  "/oauth2/auth?client_id=app&prompt=login",
+		OidcContext: model.OidcContext{LoginHint: "homer@springfield.com"},
+	}, "http://app/callback")
+	rec = httptest.NewRecorder()
+	handler.LoginHandler(rec, httptest.NewRequest("GET", "/login?login_challenge="+loginChallenge, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="homer@springfield.com"`) {
+		t.Errorf("prompt=login should show the login page with the login hint but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	loginChallenge = hydra.AddRequest(fake.Login, model.LoginChallenge{
+		Skip: true, Subject: testSubject, Client: model.Client{ClientID: "app"}, RequestURL: "/oauth2/auth?client_id=app&max_age=60",
+	}, "http://app/callback")
+	rec = httptest.NewRecorder()
+	handler.LoginHandler(rec, httptest.NewRequest("GET", "/login?login_challenge="+loginChallenge, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("max_age without known login time should require a new login but got %d", rec.Code)
+	}
+	if decisions := hydra.Decisions(); len(decisions) != 1 || decisions[0].Action != "reject" {
+		t.Error("only the prompt=none request should be decided", decisions)
+	}
+
+	loginChallenge = hydra.AddRequest(fake.Login, model.LoginChallenge{
+		Skip: true, Subject: "another-subject", Client: model.Client{ClientID: "app"}, RequestURL: "/oauth2/auth?client_id=app&prompt=login",
+	}, "http://app/callback")
+	rec = postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge},
+	})
+	if location := rec.Header().Get("Location"); !strings.Contains(location, "error=access_denied") {
+		t.Errorf("re-login as another user than the session's should be rejected but got %d %s", rec.Code, location)
+	}
+
+	loginChallenge = hydra.AddRequest(fake.Login, model.LoginChallenge{
+		Skip: true, Subject: "homer@springfield.com", Client: model.Client{ClientID: "app"}, RequestURL: "/oauth2/auth?client_id=app",
+	}, "http://app/callback")
+	rec = httptest.NewRecorder()
+	handler.LoginHandler(rec, httptest.NewRequest("GET", "/login?login_challenge="+loginChallenge, nil))
+	if location := rec.Header().Get("Location"); !strings.Contains(location, "error=login_required") {
+		t.Errorf("session of an email subject should not be continued but got %d %s", rec.Code, location)
+	}
+}
+
+func TestLoginFlow_SecondFactor(t *testing.T) {
+	useRepositoryTemplates(t)
+	handler, hydra := newFlowHandler(t)
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	newChallenge := func(requestURL string, skip bool) string {
+		return hydra.AddRequest(fake.Login, model.LoginChallenge{
+			Skip: skip, Subject: testSubject, Client: model.Client{ClientID: "app"}, RequestURL: requestURL,
+			OidcContext: model.OidcContext{AcrValues: []string{model.AcrMFA}},
+		}, "http://app/callback")
+	}
+
+	loginChallenge := newChallenge("/oauth2/auth?client_id=app", false)
+	rec := postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge},
+	})
+	if location := rec.Header().Get("Location"); !strings.Contains(location, "error=unmet_authentication_requirements") {
+		t.Errorf("users without second factor should be rejected but got %d %s", rec.Code, location)
+	}
+
+	handler.LoginService.UserService.databaseHandler.(*mockUserDatabase).users[0].TOTPSecret = secret
+	loginChallenge = newChallenge("/oauth2/auth?client_id=app", false)
+	rec = postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge},
+	})
+	pending := regexp.MustCompile(`name="pending" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || pending == nil {
+		t.Fatalf("password login should ask for the second factor but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	form := url.Values{"challenge": {loginChallenge}, "pending": {pending[1]}, "code": {"000000"}}
+	if rec = postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, form); rec.Code != http.StatusForbidden {
+		t.Errorf("wrong code should be rejected but got %d", rec.Code)
+	}
+	form.Set("code", totpCode([]byte("12345678901234567890"), time.Now().Unix()/totpPeriod))
+	rec = postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, form)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("valid code should accept the login but got %d: %s", rec.Code, rec.Body.String())
+	}
+	var acceptLogin model.AcceptLogin
+	json.Unmarshal(hydra.Decisions()[1].Body, &acceptLogin)
+	if acceptLogin.Acr != model.AcrMFA || !contains(acceptLogin.Amr, model.AmrPassword) || !contains(acceptLogin.Amr, model.AmrOTP) {
+		t.Error("login should be accepted with the achieved acr and amr", acceptLogin)
+	}
+	accepted := rec
+
+	// an accepted code cannot be used again and a pending login is rejected after too many codes
+	replayChallenge := newChallenge("/oauth2/auth?client_id=app", false)
+	rec = postForm(handler.LoginHandler, "/login?login_challenge="+replayChallenge, url.Values{
+		"username": {"homer"}, "password": {"secret"}, "challenge": {replayChallenge},
+	})
+	replayPending := regexp.MustCompile(`name="pending" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	replayForm := url.Values{"challenge": {replayChallenge}, "pending": {replayPending[1]}, "code": {form.Get("code")}}
+	if rec = postForm(handler.LoginHandler, "/login?login_challenge="+replayChallenge, replayForm); rec.Code != http.StatusForbidden {
+		t.Errorf("used code should be rejected but got %d", rec.Code)
+	}
+	replayForm.Set("code", "000000")
+	for attempt := 2; attempt <= secondFactorAttemptLimit; attempt++ {
+		postForm(handler.LoginHandler, "/login?login_challenge="+replayChallenge, replayForm)
+	}
+	rec = postForm(handler.LoginHandler, "/login?login_challenge="+replayChallenge, replayForm)
+	if location := rec.Header().Get("Location"); !strings.Contains(location, "error=access_denied") {
+		t.Errorf("login should be rejected after too many codes but got %d %s", rec.Code, location)
+	}
+	rec = accepted
+
+	// the remembered login satisfies max_age and acr_values without asking again
+	loginChallenge = newChallenge("/oauth2/auth?client_id=app&max_age=3600", true)
+	req := httptest.NewRequest("GET", "/login?login_challenge="+loginChallenge, nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	handler.LoginHandler(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("remembered second factor login should be accepted but got %d: %s", rec.Code, rec.Body.String())
+	}
+	decisions := hydra.Decisions()
+	acceptLogin = model.AcceptLogin{}
+	json.Unmarshal(decisions[len(decisions)-1].Body, &acceptLogin)
+	if acceptLogin.Acr != model.AcrMFA {
+		t.Error("skipped login should report the remembered acr", acceptLogin)
+	}
+}
+
+func TestLoginFlow_SecondFactorLockout(t *testing.T) {
+	useRepositoryTemplates(t)
+	handler, hydra := newFlowHandler(t)
+	handler.LoginService.UserService.databaseHandler.(*mockUserDatabase).users[0].TOTPSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	// every password login starts a new pending login, the codes are counted for the user
+	secondFactorForm := func() url.Values {
+		loginChallenge := hydra.AddRequest(fake.Login, model.LoginChallenge{
+			Subject: testSubject, Client: model.Client{ClientID: "app"}, RequestURL: "/oauth2/auth?client_id=app",
+			OidcContext: model.OidcContext{AcrValues: []string{model.AcrMFA}},
+		}, "http://app/callback")
+		rec := postForm(handler.LoginHandler, "/login?login_challenge="+loginChallenge, url.Values{
+			"username": {"homer"}, "password": {"secret"}, "challenge": {loginChallenge},
+		})
+		pending := regexp.MustCompile(`name="pending" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+		if pending == nil {
+			t.Fatalf("password login should ask for the second factor but got %d", rec.Code)
+		}
+		return url.Values{"challenge": {loginChallenge}, "pending": {pending[1]}, "code": {"000000"}}
+	}
+	for attempt := 0; attempt < secondFactorUserLimit; attempt += 2 {
+		form := secondFactorForm()
+		postForm(handler.LoginHandler, "/login?login_challenge="+form.Get("challenge"), form)
+		if rec := postForm(handler.LoginHandler, "/login?login_challenge="+form.Get("challenge"), form); rec.Code != http.StatusForbidden {
+			t.Fatalf("wrong code should be rejected but got %d", rec.Code)
+		}
+	}
+	form := secondFactorForm()
+	form.Set("code", totpCode([]byte("12345678901234567890"), time.Now().Unix()/totpPeriod))
+	rec := postForm(handler.LoginHandler, "/login?login_challenge="+form.Get("challenge"), form)
+	if location := rec.Header().Get("Location"); !strings.Contains(location, "error=access_denied") {
+		t.Errorf("user should be locked out after too many codes even with a valid code but got %d %s", rec.Code, location)
+	}
+}
+
+func TestLogoutFlow_FrontChannel(t *testing.T) {
+	// the logout page is rendered from the templates of the repository root
+	useRepositoryTemplates(t)
+
+	handler, hydra := newFlowHandler(t)
+	handler.ClientService.fileSettings = map[string]model.ClientSettings{
+		"app":     {ClientID: "app", FrontChannelLogoutURI: "http://app/frontchannel-logout"},
+		"session": {ClientID: "session", FrontChannelLogoutURI: "http://session/logout?tenant=1", FrontChannelLogoutSessionRequired: true},
+	}
+	handler.Issuer = "http://hydra"
+
+	logoutChallenge := hydra.StartLogout(testSubject, false, "http://app/logged-out")
+	rec := httptest.NewRecorder()
+	handler.LogoutHandler(rec, httptest.NewRequest("GET", "/logout?logout_challenge="+logoutChallenge, nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "http://app/logged-out" {
+		t.Errorf("logout without front-channel clients should redirect but got %d", rec.Code)
+	}
+
+	hydra.AddConsentSession(testSubject, model.ConsentSession{ConsentRequest: model.LoginChallenge{Client: model.Client{ClientID: "app", ClientName: "App"}}})
+	hydra.AddConsentSession(testSubject, model.ConsentSession{ConsentRequest: model.LoginChallenge{Client: model.Client{ClientID: "other"}}})
+	hydra.AddConsentSession(testSubject, model.ConsentSession{ConsentRequest: model.LoginChallenge{Client: model.Client{ClientID: "session"}}})
+	logoutChallenge = hydra.StartLogout(testSubject, true, "http://app/logged-out")
+	logoutRequest, _ := hydra.Request(logoutChallenge)
+	rec = postForm(handler.LogoutHandler, "/logout?logout_challenge="+logoutChallenge, url.Values{"challenge": {logoutChallenge}, "accept": {"true"}})
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || strings.Count(body, "<iframe") != 2 || !strings.Contains(body, `src="http://app/frontchannel-logout"`) {
+		t.Fatalf("logout page should load the front-channel logout uri of the client but got %d: %s", rec.Code, body)
+	}
+	sessionURI := "http://session/logout?iss=" + url.QueryEscape("http://hydra") + "&amp;sid=" + logoutRequest.Body.SessionID + "&amp;tenant=1"
+	if !strings.Contains(body, `src="`+sessionURI+`"`) {
+		t.Error("clients requiring the session should get iss and sid", body)
+	}
+	if !strings.Contains(body, `href="http://app/logged-out"`) {
+		t.Error("logout page should continue with the redirect of hydra", body)
+	}
+	if decisions := hydra.Decisions(); len(decisions) != 2 || decisions[1].Action != "accept" {
+		t.Error("logout should be accepted", decisions)
+	}
+}
@@ -6,15 +6,45 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"time"
 
 	"user-service/model"
 )
 
 type Handler struct {
-	LoginService  LoginService
-	ConfigService ConfigService
+	LoginService         LoginService
+	ConfigService        ConfigService
+	PolicyService        PolicyService
+	ClientService        ClientService
+	LoginSession         LoginSession
+	AssuranceService     AssuranceService
+	TrustedDeviceService *TrustedDeviceService
+	MagicLinkService     *MagicLinkService
+	Issuer               string
+	secondFactorAttempts *rateLimiter
+	secondFactorLockouts *rateLimiter
+	userCodeAttempts     *rateLimiter
+	userCodeAddresses    *rateLimiter
 }
 
+// secondFactorAttemptLimit is how many codes may be entered for a pending login before it is rejected,
+// secondFactorUserLimit how many codes of a user are checked within secondFactorLockout over all pending logins
+const (
+	secondFactorAttemptLimit = 5
+	secondFactorUserLimit    = 10
+	secondFactorLockout      = 15 * time.Minute
+)
+
+// userCodeAttemptLimit is how many user codes may be entered for a device challenge within userCodeWindow,
+// userCodeAddressLimit how many from one address
+const (
+	userCodeAttemptLimit = 5
+	userCodeAddressLimit = 20
+	userCodeWindow       = 15 * time.Minute
+)
+
 func NewLoginHandler() Handler {
 	configService, err := NewConfigService()
 	if err != nil {
@@ -24,8 +54,19 @@ func NewLoginHandler() Handler {
 	loginService := NewLoginService()
 
 	return Handler{
-		ConfigService: configService,
-		LoginService:  loginService,
+		ConfigService:        configService,
+		LoginService:         loginService,
+		PolicyService:        NewPolicyService(),
+		ClientService:        NewClientService(configService.AcceptLoginData),
+		LoginSession:         NewLoginSession(),
+		AssuranceService:     NewAssuranceService(),
+		TrustedDeviceService: NewTrustedDeviceService(),
+		MagicLinkService:     NewMagicLinkService(),
+		Issuer:               os.Getenv("HYDRA_ISSUER"),
+		secondFactorAttempts: newRateLimiter(secondFactorAttemptLimit, pendingLoginTimeout),
+		secondFactorLockouts: newRateLimiter(secondFactorUserLimit, secondFactorLockout),
+		userCodeAttempts:     newRateLimiter(userCodeAttemptLimit, userCodeWindow),
+		userCodeAddresses:    newRateLimiter(userCodeAddressLimit, userCodeWindow),
 	}
 
 }
@@ -42,69 +83,361 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	challenge, err := readURLChallangeParams(r, "login")
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+		if r.URL.Query().Get("error") != "" {
+			h.ErrorHandler(w, r)
+			return
+		}
+		h.renderRequestError(w, r, err)
 		return
 	}
 
 	if r.Method == "POST" {
 		if r.Form == nil {
 			if err := r.ParseForm(); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				h.renderRequestError(w, r, err)
 				return
 			}
 		}
+		if r.Form.Get("pending") != "" {
+			h.completeSecondFactor(w, r)
+			return
+		}
 		userName := r.Form.Get("username")
 		password := r.Form.Get("password")
 		loginChallenge := r.Form.Get("challenge")
+		remember := r.Form.Get("remember") == "true"
 		pass, err := h.LoginService.CheckPasswords(userName, password)
 		if err != nil {
 			log.Println(err)
 		}
 
 		if pass {
-
-			acceptLoginBody := h.ConfigService.FetchAcceptLoginConfig(userName)
-			rawJson, err := json.Marshal(acceptLoginBody)
-
-			redirectURL, err := h.LoginService.SendAcceptBody("login", loginChallenge, rawJson)
+			challengeBody, err := h.LoginService.ReadChallenge(r.Context(), loginChallenge, "login")
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Fatal(err)
+				h.renderHydraError(w, r, err)
+				return
 			}
-			http.Redirect(w, r, redirectURL, http.StatusFound)
+			user, err := h.LoginService.UserService.FindUserByEmailOrUserName(userName)
+			if err != nil {
+				h.renderRequestError(w, r, err)
+				return
+			}
+			if h.rejectOtherSubject(w, r, loginChallenge, challengeBody, user.Subject) ||
+				h.rejectWithoutMembership(w, r, StageLogin, loginChallenge, challengeBody, user.Subject) || h.rejectByPolicy(w, r, StageLogin, loginChallenge, challengeBody, user.Subject) {
+				return
+			}
+
+			authentication := model.Authentication{
+				Subject:  user.Subject,
+				AuthTime: time.Now().Unix(),
+				Acr:      model.AcrPassword,
+				Amr:      []string{model.AmrPassword},
+			}
+			h.continueLogin(w, r, loginChallenge, challengeBody, user, authentication, remember, true)
+			return
 		}
 
+		challengeBody, err := h.LoginService.ReadChallenge(r.Context(), challenge, "login")
+		if err != nil {
+			h.renderHydraError(w, r, err)
+			return
+		}
 		w.WriteHeader(http.StatusForbidden)
-		templLogin := template.Must(template.ParseFiles("templates/login.html"))
-		loginData := h.ConfigService.FetchLoginConfig(challenge, true)
+		templLogin := template.Must(template.ParseFiles(templateDir + "/login.html"))
+		loginData := h.loginPageData(challenge, challengeBody.Client, true)
+		loginData.LoginHint = userName
 		templLogin.Execute(w, loginData)
 	} else {
-		challengeBody, err := h.LoginService.ReadChallenge(challenge, "login")
-
+		challengeBody, err := h.LoginService.ReadChallenge(r.Context(), challenge, "login")
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Print(err)
+			h.renderHydraError(w, r, err)
+			return
 		}
 
-		if !challengeBody.Skip {
-			templLogin := template.Must(template.ParseFiles("templates/login.html"))
-			loginData := h.ConfigService.FetchLoginConfig(challenge, false)
+		clientSettings := h.ClientService.FetchClientSettings(challengeBody.Client.ClientID)
+		loginRequest := parseLoginRequest(challengeBody)
+		authentication, known := h.LoginSession.Read(r, challengeBody.Subject)
+		if !challengeBody.Skip || clientSettings.ForceReauthentication || loginRequest.requiresReauthentication(authentication, known, time.Now()) {
+			if loginRequest.hasPrompt("none") {
+				h.rejectLogin(w, r, challenge, "login_required", "The user has to log in")
+				return
+			}
+			templLogin := template.Must(template.ParseFiles(templateDir + "/login.html"))
+			loginData := h.loginPageData(challenge, challengeBody.Client, false)
+			loginData.LoginHint = loginRequest.loginHint
 			templLogin.Execute(w, loginData)
 		} else {
+			user, err := h.LoginService.UserService.FindUserBySubject(challengeBody.Subject)
+			if h.LoginService.UserService.databaseHandler.IsNotFoundError(err) {
+				// the session of a subject which is no user (anymore) cannot be continued, the user has to log in again
+				if err := h.LoginService.HydraAdapter.RevokeLoginSessions(r.Context(), challengeBody.Subject); err != nil {
+					log.Println(err)
+				}
+				h.rejectLogin(w, r, challenge, "login_required", "The user has to log in again")
+				return
+			}
+			if err != nil {
+				h.renderRequestError(w, r, err)
+				return
+			}
+			if h.rejectWithoutMembership(w, r, StageLogin, challenge, challengeBody, challengeBody.Subject) || h.rejectByPolicy(w, r, StageLogin, challenge, challengeBody, challengeBody.Subject) {
+				return
+			}
 
-			acceptLoginBody := h.ConfigService.FetchAcceptLoginConfig(challengeBody.Subject)
-			rawJson, err := json.Marshal(acceptLoginBody)
+			if !known {
+				// hydra remembered a login this browser has no login session of
+				authentication = model.Authentication{Subject: challengeBody.Subject, Acr: model.AcrPassword, Amr: []string{model.AmrPassword}}
+			}
+			if loginRequest.hasPrompt("none") && !satisfiesAcr(authentication, loginRequest.requiredAcr()) {
+				h.rejectLogin(w, r, challenge, "login_required", "The user has to log in with a second factor")
+				return
+			}
+			h.continueLogin(w, r, challenge, challengeBody, user, authentication, false, false)
+		}
+	}
+}
 
-			redirectURL, err := h.LoginService.SendAcceptBody("login", challenge, rawJson)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Fatal(err)
+// MagicLinkHandler mails a login link for the challenge on POST. A clicked link only shows a confirmation on GET,
+// so mail scanners following links do not use it, the login is accepted on the POST of the confirmation
+func (h *Handler) MagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if h.MagicLinkService == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == "GET" {
+		templLogin := template.Must(template.ParseFiles(templateDir + "/login.html"))
+		templLogin.Execute(w, h.ConfigService.FetchMagicLinkConfirmConfig(r.URL.Query().Get("token")))
+		return
+	}
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			h.renderRequestError(w, r, err)
+			return
+		}
+		if token := r.Form.Get("token"); token != "" {
+			h.redeemMagicLink(w, r, token)
+			return
+		}
+		challenge := r.Form.Get("challenge")
+		challengeBody, err := h.LoginService.ReadChallenge(r.Context(), challenge, "login")
+		if err != nil {
+			h.renderHydraError(w, r, err)
+			return
+		}
+		loginData := h.loginPageData(challenge, challengeBody.Client, false)
+		if !loginData.MagicLinkAllowed {
+			h.renderRequestError(w, r, errors.New("client "+challengeBody.Client.ClientID+" does not allow login links"))
+			return
+		}
+
+		err = h.MagicLinkService.Send(r.Form.Get("email"), challenge, challengeBody.Client.DisplayName(), h.PolicyService.remoteIP(r).String())
+		switch {
+		case err == errMagicLinkRateLimited:
+			w.WriteHeader(http.StatusTooManyRequests)
+			loginData.ErrorMessage = loginData.MagicLinkLimitMessage
+		case err != nil:
+			log.Println(err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			loginData.ErrorMessage = loginData.MagicLinkErrorMessage
+		default:
+			loginData.InfoMessage = loginData.MagicLinkSentMessage
+		}
+		templLogin := template.Must(template.ParseFiles(templateDir + "/login.html"))
+		templLogin.Execute(w, loginData)
+		return
+	}
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Write([]byte("Method must be GET or POST"))
+}
+
+// redeemMagicLink accepts the login of the challenge the login link was sent for
+func (h *Handler) redeemMagicLink(w http.ResponseWriter, r *http.Request, token string) {
+	link, user, err := h.MagicLinkService.Redeem(token)
+	if err != nil {
+		h.renderRequestError(w, r, err)
+		return
+	}
+	challengeBody, err := h.LoginService.ReadChallenge(r.Context(), link.Challenge, "login")
+	if err != nil {
+		h.renderHydraError(w, r, err)
+		return
+	}
+	if !h.ClientService.FetchClientSettings(challengeBody.Client.ClientID).MagicLinkLogin {
+		h.renderRequestError(w, r, errors.New("client "+challengeBody.Client.ClientID+" does not allow login links"))
+		return
+	}
+	if h.rejectOtherSubject(w, r, link.Challenge, challengeBody, user.Subject) ||
+		h.rejectWithoutMembership(w, r, StageLogin, link.Challenge, challengeBody, user.Subject) || h.rejectByPolicy(w, r, StageLogin, link.Challenge, challengeBody, user.Subject) {
+		return
+	}
+
+	authentication := model.Authentication{
+		Subject:  user.Subject,
+		AuthTime: time.Now().Unix(),
+		Acr:      model.AcrEmail,
+		Amr:      []string{model.AmrEmail},
+	}
+	h.continueLogin(w, r, link.Challenge, challengeBody, user, authentication, false, false)
+}
+
+// rejectOtherSubject rejects the login if hydra already knows the user of the browser and somebody else logged in again,
+// e.g. after prompt=login, max_age or ForceReauthentication
+func (h *Handler) rejectOtherSubject(w http.ResponseWriter, r *http.Request, challenge string, challengeBody model.LoginChallenge, subject string) bool {
+	if !challengeBody.Skip || challengeBody.Subject == subject {
+		return false
+	}
+	h.rejectLogin(w, r, challenge, "access_denied", "The user has to log in as the user of the existing session")
+	return true
+}
+
+// loginPageData returns the login page with the options the client allows
+func (h *Handler) loginPageData(challenge string, client model.Client, withError bool) model.LoginPageData {
+	clientSettings := h.ClientService.FetchClientSettings(client.ClientID)
+	loginData := h.ConfigService.FetchLoginConfig(challenge, client, withError)
+	loginData.RememberAllowed = clientSettings.LoginRemember
+	loginData.MagicLinkAllowed = clientSettings.MagicLinkLogin && h.MagicLinkService != nil
+	return loginData
+}
+
+// continueLogin asks for the second factor if the client requires a higher acr than the user achieved and accepts the login otherwise,
+// browsers the user trusts count as second factor only together with the password entered in this request
+func (h *Handler) continueLogin(w http.ResponseWriter, r *http.Request, challenge string, challengeBody model.LoginChallenge, user model.UserDTO, authentication model.Authentication, remember, passwordEntered bool) {
+	if satisfiesAcr(authentication, h.requiredAcr(challengeBody)) {
+		h.acceptLogin(w, r, challenge, authentication, challengeBody.Client.ClientID, remember)
+		return
+	}
+	if !user.SecondFactor {
+		h.rejectLogin(w, r, challenge, "unmet_authentication_requirements", "The user has no second factor")
+		return
+	}
+	if passwordEntered && h.TrustedDeviceService != nil && h.TrustedDeviceService.IsTrusted(r, user.ID) {
+		h.acceptLogin(w, r, challenge, withSecondFactor(authentication, model.AmrMFA), challengeBody.Client.ClientID, remember)
+		return
+	}
+	h.renderSecondFactor(w, challenge, challengeBody.Client, h.LoginSession.CreatePending(authentication, challenge, remember), false)
+}
+
+// requiredAcr returns the acr the client asked for. Device authorizations cannot be restarted with acr_values at the
+// consent, so they need the acr of the client and the requested scopes at the login already
+func (h *Handler) requiredAcr(challengeBody model.LoginChallenge) string {
+	requiredAcr := parseLoginRequest(challengeBody).requiredAcr()
+	if challengeBody.DeviceChallengeID == "" {
+		return requiredAcr
+	}
+	if deviceAcr := h.AssuranceService.RequiredAcr(challengeBody.Client.ClientID, challengeBody.RequestedScope); model.AcrLevel(deviceAcr) > model.AcrLevel(requiredAcr) {
+		return deviceAcr
+	}
+	return requiredAcr
+}
+
+// completeSecondFactor accepts the pending login of the challenge if the code of the authenticator app is valid,
+// the login is rejected after secondFactorAttemptLimit codes for the same pending login. Entering the password again
+// starts a new pending login, so the codes of the user are limited as well and the user is locked out for a while
+func (h *Handler) completeSecondFactor(w http.ResponseWriter, r *http.Request) {
+	loginChallenge := r.Form.Get("challenge")
+	pending := r.Form.Get("pending")
+	authentication, remember, err := h.LoginSession.ReadPending(pending, loginChallenge)
+	if err != nil {
+		h.renderRequestError(w, r, err)
+		return
+	}
+	challengeBody, err := h.LoginService.ReadChallenge(r.Context(), loginChallenge, "login")
+	if err != nil {
+		h.renderHydraError(w, r, err)
+		return
+	}
+
+	if !h.secondFactorAttempts.Allow(pending) || !h.secondFactorLockouts.Allow(authentication.Subject) {
+		log.Printf("too many codes of the second factor for subject %s", authentication.Subject)
+		h.rejectLogin(w, r, loginChallenge, "access_denied", "Too many invalid codes of the second factor")
+		return
+	}
+	valid, err := h.LoginService.UserService.VerifySecondFactor(authentication.Subject, r.Form.Get("code"))
+	if err != nil {
+		log.Println(err)
+	}
+	if !valid {
+		w.WriteHeader(http.StatusForbidden)
+		h.renderSecondFactor(w, loginChallenge, challengeBody.Client, pending, true)
+		return
+	}
+
+	if r.Form.Get("trust") == "true" && h.TrustedDeviceService != nil {
+		if user, err := h.LoginService.UserService.FindUserBySubject(authentication.Subject); err == nil {
+			if err := h.TrustedDeviceService.Trust(w, r, user.ID); err != nil {
+				log.Println(err)
 			}
-			http.Redirect(w, r, redirectURL, http.StatusFound)
+		}
+	}
+	// the user authenticated again by entering the code
+	authentication.AuthTime = time.Now().Unix()
+	h.acceptLogin(w, r, loginChallenge, withSecondFactor(authentication, model.AmrOTP, model.AmrMFA), challengeBody.Client.ClientID, remember)
+}
 
+// withSecondFactor returns the authentication completed by a second factor, the auth time is kept
+func withSecondFactor(authentication model.Authentication, amrs ...string) model.Authentication {
+	authentication.Acr = model.AcrMFA
+	authentication.Amr = append(make([]string, 0, len(authentication.Amr)+len(amrs)), authentication.Amr...)
+	for _, amr := range amrs {
+		if !contains(authentication.Amr, amr) {
+			authentication.Amr = append(authentication.Amr, amr)
 		}
 	}
+	return authentication
+}
+
+// acceptLogin accepts the login with the achieved acr and amr and remembers new authentications of the browser.
+// Hydra remembers the login if the user wants to stay signed in and the client allows it, at most for its LoginRememberFor
+func (h *Handler) acceptLogin(w http.ResponseWriter, r *http.Request, challenge string, authentication model.Authentication, clientID string, remember bool) {
+	clientSettings := h.ClientService.FetchClientSettings(clientID)
+	acceptLoginBody, err := h.ConfigService.FetchAcceptLoginConfig(authentication.Subject, clientSettings)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, h.ConfigService.FetchErrorConfig(r.Header.Get("Accept-Language")), err)
+		return
+	}
+	acceptLoginBody.Remember = acceptLoginBody.Remember && remember
+	acceptLoginBody.Acr = authentication.Acr
+	acceptLoginBody.Amr = authentication.Amr
+	rawJson, err := json.Marshal(acceptLoginBody)
+	if err != nil {
+		h.renderRequestError(w, r, err)
+		return
+	}
+
+	redirectURL, err := h.LoginService.SendAcceptBody(r.Context(), "login", challenge, rawJson)
+	if err != nil {
+		h.renderHydraError(w, r, err)
+		return
+	}
+	if authentication.AuthTime != 0 {
+		h.LoginSession.Create(w, authentication)
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// rejectLogin rejects the login request, hydra redirects back to the client with the error
+func (h *Handler) rejectLogin(w http.ResponseWriter, r *http.Request, challenge, name, description string) {
+	rawJson, err := json.Marshal(model.RejectRequest{Error: name, ErrorDescription: description})
+	if err != nil {
+		h.renderRequestError(w, r, err)
+		return
+	}
+	redirectURL, err := h.LoginService.SendRejectBody(r.Context(), "login", challenge, rawJson)
+	if err != nil {
+		h.renderHydraError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// renderSecondFactor shows the login page asking for the code of the authenticator app
+func (h *Handler) renderSecondFactor(w http.ResponseWriter, challenge string, client model.Client, pending string, withError bool) {
+	templLogin := template.Must(template.ParseFiles(templateDir + "/login.html"))
+	loginData := h.ConfigService.FetchSecondFactorConfig(challenge, client, pending, withError)
+	if h.TrustedDeviceService != nil {
+		loginData.TrustDeviceDays = h.TrustedDeviceService.Days()
+	}
+	templLogin.Execute(w, loginData)
 }
 
 // LogoutHandler handles logout requests
@@ -112,97 +445,167 @@ func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 
 	challenge, err := readURLChallangeParams(r, "logout")
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+		if r.URL.Query().Get("error") != "" {
+			h.ErrorHandler(w, r)
+			return
+		}
+		h.renderRequestError(w, r, err)
 		return
 	}
 
 	if r.Method == "POST" {
-		var err error
 		if r.Form == nil {
 			if err := r.ParseForm(); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				h.renderRequestError(w, r, err)
 				return
 			}
 		}
 		accept := r.Form.Get("accept")
 		logoutChallenge := r.Form.Get("challenge")
-		var redirectURL string
 
 		if accept == "true" {
-			redirectURL, err = h.LoginService.SendAcceptBody("logout", logoutChallenge, nil)
-
-		} else {
-			redirectURL, err = h.LoginService.SendRejectBody("logout", logoutChallenge, nil)
+			challengeBody, err := h.LoginService.ReadChallenge(r.Context(), logoutChallenge, "logout")
+			if err != nil {
+				h.renderHydraError(w, r, err)
+				return
+			}
+			h.acceptLogout(w, r, logoutChallenge, challengeBody)
+			return
 		}
+		redirectURL, err := h.LoginService.SendRejectBody(r.Context(), "logout", logoutChallenge, nil)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Fatal(err)
+			h.renderHydraError(w, r, err)
+			return
 		}
 
 		http.Redirect(w, r, redirectURL, http.StatusFound)
 	} else {
 
-		challengeBody, err := h.LoginService.ReadChallenge(challenge, "logout")
+		challengeBody, err := h.LoginService.ReadChallenge(r.Context(), challenge, "logout")
 		if err != nil {
-			log.Println(err)
+			h.renderHydraError(w, r, err)
+			return
 		}
 
 		if challengeBody.RpInitiated {
-			templLogout := template.Must(template.ParseFiles("templates/logout.html"))
-			logoutData := h.ConfigService.FetchLogoutConfig(challenge, challengeBody.Subject)
+			templLogout := template.Must(template.ParseFiles(templateDir + "/logout.html"))
+			displayName := challengeBody.Subject
+			if user, err := h.LoginService.UserService.FindUserBySubject(challengeBody.Subject); err == nil {
+				displayName = user.UserName
+			}
+			logoutData := h.ConfigService.FetchLogoutConfig(challenge, displayName)
 			templLogout.Execute(w, logoutData)
 		} else {
-			redirectURL, err := h.LoginService.SendAcceptBody("logout", challenge, nil)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Fatal(err)
-			}
+			h.acceptLogout(w, r, challenge, challengeBody)
+		}
+	}
 
-			http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// acceptLogout accepts the logout, hydra notifies the clients with a back-channel logout uri and clients with a front-channel logout uri
+// are logged out by the logout page before the browser follows the redirect of hydra
+func (h *Handler) acceptLogout(w http.ResponseWriter, r *http.Request, challenge string, challengeBody model.LoginChallenge) {
+	frontChannelClients := h.frontChannelClients(r, challengeBody)
+	redirectURL, err := h.LoginService.SendAcceptBody(r.Context(), "logout", challenge, nil)
+	if err != nil {
+		h.renderHydraError(w, r, err)
+		return
+	}
+
+	if len(frontChannelClients) == 0 {
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+		return
+	}
+	templLogout := template.Must(template.ParseFiles(templateDir + "/logout.html"))
+	templLogout.Execute(w, h.ConfigService.FetchFrontChannelLogoutConfig(redirectURL, frontChannelClients))
+}
+
+// frontChannelClients returns the clients the subject consented to which have a front-channel logout uri
+func (h *Handler) frontChannelClients(r *http.Request, logoutRequest model.LoginChallenge) []model.FrontChannelClient {
+	clients := make([]model.FrontChannelClient, 0)
+	if logoutRequest.Subject == "" {
+		return clients
+	}
+	consentSessions, err := h.LoginService.HydraAdapter.ListConsentSessions(r.Context(), logoutRequest.Subject)
+	if err != nil {
+		log.Println(err)
+		return clients
+	}
+	for _, consentSession := range consentSessions {
+		client := consentSession.ConsentRequest.Client
+		settings := h.ClientService.FetchClientSettings(client.ClientID)
+		if settings.FrontChannelLogoutURI == "" || containsFrontChannelClient(clients, client.ClientID) {
+			continue
+		}
+		uri := settings.FrontChannelLogoutURI
+		if settings.FrontChannelLogoutSessionRequired {
+			uri = h.withLogoutSession(uri, logoutRequest.SessionID)
 		}
+		clients = append(clients, model.FrontChannelClient{ClientID: client.ClientID, Name: client.DisplayName(), URI: uri})
 	}
+	return clients
+}
 
+// withLogoutSession adds the issuer and the session id of the logout to a front-channel logout uri
+func (h *Handler) withLogoutSession(uri, sessionID string) string {
+	logoutURI, err := url.Parse(uri)
+	if err != nil || h.Issuer == "" || sessionID == "" {
+		log.Printf("front-channel logout uri %s is loaded without iss and sid", uri)
+		return uri
+	}
+	query := logoutURI.Query()
+	query.Set("iss", h.Issuer)
+	query.Set("sid", sessionID)
+	logoutURI.RawQuery = query.Encode()
+	return logoutURI.String()
+}
+
+func containsFrontChannelClient(clients []model.FrontChannelClient, clientID string) bool {
+	for _, client := range clients {
+		if client.ClientID == clientID {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Handler) ConsentHandler(w http.ResponseWriter, r *http.Request) {
 
 	challenge, err := readURLChallangeParams(r, "consent")
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+		if r.URL.Query().Get("error") != "" {
+			h.ErrorHandler(w, r)
+			return
+		}
+		h.renderRequestError(w, r, err)
 		return
 	}
 
-	challengeBody, err := h.LoginService.ReadChallenge(challenge, "consent")
-
+	challengeBody, err := h.LoginService.ReadChallenge(r.Context(), challenge, "consent")
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.renderHydraError(w, r, err)
 		return
 	}
 
-	requestedScopes := make([]model.ReqestScope, 0, len(challengeBody.RequestedScope))
-	for _, scope := range challengeBody.RequestedScope {
-		requestedScopes = append(requestedScopes, model.ReqestScope{ScopeValue: scope, ScopeName: scope})
+	if h.rejectWithoutMembership(w, r, StageConsent, challenge, challengeBody, challengeBody.Subject) || h.rejectByPolicy(w, r, StageConsent, challenge, challengeBody, challengeBody.Subject) {
+		return
 	}
 
-	grantedAccesToken := make([]model.ReqestScope, 0, len(challengeBody.RequestedAccessToken))
-	for _, accessToken := range challengeBody.RequestedAccessToken {
-		grantedAccesToken = append(grantedAccesToken, model.ReqestScope{ScopeName: accessToken, ScopeValue: "true"}) // hier könnten die tokens gefiltert werden
+	clientSettings := h.ClientService.FetchClientSettings(challengeBody.Client.ClientID)
+	allowedScopes := filterAllowedScopes(clientSettings, challengeBody.RequestedScope)
+	if h.requireStepUp(w, r, challenge, challengeBody, allowedScopes) {
+		return
 	}
-	if !challengeBody.Skip {
-		consentData := h.ConfigService.FetchConsentConfig(challengeBody.Client.ClientID, challenge, challengeBody.Subject, requestedScopes, grantedAccesToken)
-		templConsent := template.Must(template.ParseFiles("templates/consent.html"))
 
-		templConsent.Execute(w, consentData)
+	if !challengeBody.Skip && !clientSettings.SkipConsent {
+		h.renderConsent(w, r, challenge, challengeBody, allowedScopes, "")
 	} else {
 
-		redirectURL, err := h.LoginService.RedirectFromConsent(challengeBody.RequestedScope, challengeBody.RequestedAccessToken, challenge, challengeBody.Subject, challengeBody.Client.ClientID)
+		redirectURL, err := h.LoginService.RedirectFromConsent(r.Context(), allowedScopes, challengeBody.RequestedAccessToken, challenge, challengeBody.Subject, challengeBody.Client.ClientID, clientSettings)
 
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Fatal(err)
+			h.renderHydraError(w, r, err)
+			return
 		}
 		http.Redirect(w, r, redirectURL, http.StatusFound)
 
@@ -214,7 +617,7 @@ func (h *Handler) AcceptConsentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
 		if r.Form == nil {
 			if err := r.ParseForm(); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				h.renderRequestError(w, r, err)
 				return
 			}
 		}
@@ -223,18 +626,178 @@ func (h *Handler) AcceptConsentHandler(w http.ResponseWriter, r *http.Request) {
 		allowedScopes := r.PostForm["scope"]
 		allowedAccessToken := r.PostForm["accesToken"]
 		consentChallenge := r.Form.Get("challenge")
-		userName := r.Form.Get("userName")
-		clientName := r.Form.Get("clientName")
-		redirectURL, err := h.LoginService.RedirectFromConsent(allowedScopes, allowedAccessToken, consentChallenge, userName, clientName)
 
+		if r.Form.Get("action") == "deny" {
+			rawJson, err := json.Marshal(model.RejectRequest{
+				Error:            "access_denied",
+				ErrorDescription: "The resource owner denied the request",
+				StatusCode:       http.StatusForbidden,
+			})
+			redirectURL, err := h.LoginService.SendRejectBody(r.Context(), "consent", consentChallenge, rawJson)
+			if err != nil {
+				h.renderHydraError(w, r, err)
+				return
+			}
+			http.Redirect(w, r, redirectURL, http.StatusFound)
+			return
+		}
+
+		challengeBody, err := h.LoginService.ReadChallenge(r.Context(), consentChallenge, "consent")
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Fatal(err)
+			h.renderHydraError(w, r, err)
+			return
+		}
+		if h.rejectWithoutMembership(w, r, StageConsent, consentChallenge, challengeBody, challengeBody.Subject) || h.rejectByPolicy(w, r, StageConsent, consentChallenge, challengeBody, challengeBody.Subject) {
+			return
+		}
+
+		clientSettings := h.ClientService.FetchClientSettings(challengeBody.Client.ClientID)
+		requestedScopes := filterAllowedScopes(clientSettings, challengeBody.RequestedScope)
+		allowedScopes = intersect(allowedScopes, requestedScopes)
+		allowedAccessToken = intersect(allowedAccessToken, challengeBody.RequestedAccessToken)
+		if errorMessage := h.ConfigService.ValidateGrantedScopes(requestedScopes, allowedScopes); errorMessage != "" {
+			h.renderConsent(w, r, consentChallenge, challengeBody, requestedScopes, errorMessage)
+			return
+		}
+		if h.requireStepUp(w, r, consentChallenge, challengeBody, allowedScopes) {
+			return
+		}
+
+		redirectURL, err := h.LoginService.RedirectFromConsent(r.Context(), allowedScopes, allowedAccessToken, consentChallenge, challengeBody.Subject, challengeBody.Client.ClientID, clientSettings)
+
+		if err != nil {
+			h.renderHydraError(w, r, err)
+			return
 		}
 		http.Redirect(w, r, redirectURL, http.StatusFound)
 	} else {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.renderRequestError(w, r, errors.New("consent must be accepted with POST"))
+	}
+}
+
+// renderConsent shows the consent page for the requested scopes, required scopes cannot be unchecked
+func (h *Handler) renderConsent(w http.ResponseWriter, r *http.Request, challenge string, challengeBody model.LoginChallenge, scopes []string, errorMessage string) {
+	requestedScopes := h.ConfigService.FetchScopeDescriptions(scopes, r.Header.Get("Accept-Language"))
+
+	grantedAccesToken := make([]model.ReqestScope, 0, len(challengeBody.RequestedAccessToken))
+	for _, accessToken := range challengeBody.RequestedAccessToken {
+		grantedAccesToken = append(grantedAccesToken, model.ReqestScope{ScopeName: accessToken, ScopeValue: "true"}) // hier könnten die tokens gefiltert werden
+	}
+
+	consentData := h.ConfigService.FetchConsentConfig(challengeBody.Client, challenge, requestedScopes, grantedAccesToken)
+	consentData.ErrorMessage = errorMessage
+	for _, scope := range requestedScopes {
+		consentData.HasRequiredScopes = consentData.HasRequiredScopes || scope.Required
+		consentData.HasOptionalScopes = consentData.HasOptionalScopes || !scope.Required
+	}
+	roles, err := h.LoginService.FindRoles(challengeBody.Subject, challengeBody.Client.ClientID)
+	if err != nil {
+		log.Println(err)
+	}
+	consentData.Roles = roles
+	if errorMessage != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	templConsent := template.Must(template.ParseFiles(templateDir + "/consent.html"))
+	templConsent.Execute(w, consentData)
+}
+
+// requireStepUp sends the user through a login with a second factor if the client or the scopes need a higher acr
+// than the login of the consent achieved, it returns true if the request was handled
+func (h *Handler) requireStepUp(w http.ResponseWriter, r *http.Request, challenge string, challengeBody model.LoginChallenge, scopes []string) bool {
+	requiredAcr := h.AssuranceService.RequiredAcr(challengeBody.Client.ClientID, scopes)
+	if model.AcrLevel(challengeBody.Acr) >= model.AcrLevel(requiredAcr) {
+		return false
+	}
+
+	var redirectURL string
+	var err error
+	if challengeBody.DeviceChallengeID != "" {
+		// device authorizations cannot be restarted, their login already asked for the acr
+		err = errors.New("device authorization did not reach the acr " + requiredAcr)
+	} else {
+		redirectURL, err = stepUpURL(challengeBody.RequestURL, requiredAcr)
+	}
+	if err != nil {
+		log.Println(err)
+		rawJson, err := json.Marshal(model.RejectRequest{
+			Error:            "unmet_authentication_requirements",
+			ErrorDescription: "The requested scopes require a login with a second factor",
+			StatusCode:       http.StatusForbidden,
+		})
+		redirectURL, err = h.LoginService.SendRejectBody(r.Context(), "consent", challenge, rawJson)
+		if err != nil {
+			h.renderHydraError(w, r, err)
+			return true
+		}
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+	return true
+}
+
+// rejectWithoutMembership rejects the challenge and shows an error page if the client requires roles the user does not have
+func (h *Handler) rejectWithoutMembership(w http.ResponseWriter, r *http.Request, stage, challenge string, challengeBody model.LoginChallenge, subject string) bool {
+	if !h.ClientService.FetchClientSettings(challengeBody.Client.ClientID).RequireMembership {
+		return false
+	}
+	member, err := h.LoginService.HasMembership(subject, challengeBody.Client.ClientID)
+	if err != nil {
+		log.Println(err)
+	}
+	if member {
+		return false
+	}
+
+	rawJson, err := json.Marshal(model.RejectRequest{
+		Error:            "access_denied",
+		ErrorDescription: "The user has no roles for this client",
+		StatusCode:       http.StatusForbidden,
+	})
+	if _, err := h.LoginService.SendRejectBody(r.Context(), stage, challenge, rawJson); err != nil {
+		log.Println(err)
+	}
+
+	errorPageData := h.ConfigService.FetchAccessDeniedConfig(challengeBody.Client.DisplayName(), r.Header.Get("Accept-Language"))
+	renderError(w, r, http.StatusForbidden, errorPageData, errors.New("user "+subject+" has no roles for client "+challengeBody.Client.ClientID))
+	return true
+}
+
+// rejectByPolicy rejects the challenge and redirects back to the client if an access policy denies the request
+func (h *Handler) rejectByPolicy(w http.ResponseWriter, r *http.Request, stage, challenge string, challengeBody model.LoginChallenge, subject string) bool {
+	if len(h.PolicyService.Policies) == 0 {
+		return false
+	}
+	user, err := h.LoginService.UserService.FindUserBySubject(subject)
+	if err != nil {
+		log.Println(err)
+	}
+	decision := h.PolicyService.Evaluate(h.PolicyService.NewPolicyContext(r, stage, user, challengeBody))
+	if decision.Allowed {
+		return false
+	}
+
+	rawJson, err := json.Marshal(model.RejectRequest{
+		Error:            "access_denied",
+		ErrorDescription: decision.ErrorDescription,
+		StatusCode:       http.StatusForbidden,
+	})
+	redirectURL, err := h.LoginService.SendRejectBody(r.Context(), stage, challenge, rawJson)
+	if err != nil {
+		h.renderHydraError(w, r, err)
+		return true
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+	return true
+}
+
+func intersect(values, allowed []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if contains(allowed, value) && !contains(result, value) {
+			result = append(result, value)
+		}
 	}
+	return result
 }
 
 func readURLChallangeParams(r *http.Request, challengeMethod string) (string, error) {
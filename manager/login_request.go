@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"user-service/model"
+)
+
+// loginRequest are the parameters of the authorization request which change how the user has to log in
+type loginRequest struct {
+	prompt    []string
+	maxAge    int
+	loginHint string
+	acrValues []string
+}
+
+// parseLoginRequest reads the oidc context of hydra and falls back to the query of the authorization request,
+// prompt and max_age are only part of the query. maxAge is -1 if the client did not send it
+func parseLoginRequest(challengeBody model.LoginChallenge) loginRequest {
+	query := url.Values{}
+	if requestURL, err := url.Parse(challengeBody.RequestURL); err == nil {
+		query = requestURL.Query()
+	}
+
+	request := loginRequest{
+		prompt:    strings.Fields(query.Get("prompt")),
+		maxAge:    -1,
+		loginHint: challengeBody.OidcContext.LoginHint,
+		acrValues: challengeBody.OidcContext.AcrValues,
+	}
+	if maxAge, err := strconv.Atoi(query.Get("max_age")); err == nil && maxAge >= 0 {
+		request.maxAge = maxAge
+	}
+	if request.loginHint == "" {
+		request.loginHint = query.Get("login_hint")
+	}
+	if len(request.acrValues) == 0 {
+		request.acrValues = strings.Fields(query.Get("acr_values"))
+	}
+	return request
+}
+
+func (l loginRequest) hasPrompt(prompt string) bool {
+	return contains(l.prompt, prompt)
+}
+
+// requiredAcr returns the lowest known acr the client accepts, acr_values is a list of alternatives
+func (l loginRequest) requiredAcr() string {
+	required := ""
+	for _, acr := range l.acrValues {
+		level := model.AcrLevel(acr)
+		if level > 0 && (required == "" || level < model.AcrLevel(required)) {
+			required = acr
+		}
+	}
+	return required
+}
+
+// requiresReauthentication is true if the client asks for a new login or the last login is older than max_age
+func (l loginRequest) requiresReauthentication(authentication model.Authentication, known bool, now time.Time) bool {
+	if l.hasPrompt("login") {
+		return true
+	}
+	if l.maxAge < 0 {
+		return false
+	}
+	return !known || now.Unix()-authentication.AuthTime > int64(l.maxAge)
+}
+
+// satisfiesAcr is true if the authentication meets the acr the client asked for
+func satisfiesAcr(authentication model.Authentication, requiredAcr string) bool {
+	return model.AcrLevel(authentication.Acr) >= model.AcrLevel(requiredAcr)
+}
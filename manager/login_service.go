@@ -1,52 +1,104 @@
 package manager
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"user-service/adapter"
 	"user-service/model"
+	"user-service/provider"
 )
 
 type LoginAdapter interface {
-	ReadChallenge(string, string) (model.LoginChallenge, error)
-	SendRejectBody(string, string, []byte) (string, error)
-	SendAcceptBody(string, string, []byte) (string, error)
+	ReadChallenge(context.Context, string, string) (model.LoginChallenge, error)
+	SendRejectBody(context.Context, string, string, []byte) (string, error)
+	SendAcceptBody(context.Context, string, string, []byte) (string, error)
+	ListConsentSessions(context.Context, string) ([]model.ConsentSession, error)
+	RevokeConsentSessions(context.Context, string, string) error
+	RevokeLoginSessions(context.Context, string) error
+	RevokeLoginSession(context.Context, string) error
+	RevokeClientTokens(context.Context, string) error
 }
 
-type LoginService struct {
-	UserService  UserService
-	HydraAdapter LoginAdapter
+// DeviceAdapter accepts the user codes of the device flow, only hydra supports it
+type DeviceAdapter interface {
+	AcceptUserCode(context.Context, string, string) (string, error)
 }
 
-func NewLoginService() LoginService {
+var errDeviceFlowUnsupported = errors.New("the device flow needs hydra")
 
-	loginAdapter := adapter.NewHydraAdapter()
+type LoginService struct {
+	UserService   UserService
+	HydraAdapter  LoginAdapter
+	ClaimsService ClaimsService
+}
 
+func NewLoginService() LoginService {
 	return LoginService{
-		UserService:  NewUserService(),
-		HydraAdapter: &loginAdapter,
+		UserService:   NewUserService(),
+		HydraAdapter:  newLoginAdapter(),
+		ClaimsService: NewClaimsService(),
 	}
 }
 
+// newLoginAdapter returns the embedded provider in standalone mode and the hydra adapter otherwise
+func newLoginAdapter() LoginAdapter {
+	if provider.IsStandalone() {
+		return provider.Default()
+	}
+	hydraAdapter := adapter.NewHydraAdapter()
+	return &hydraAdapter
+}
+
 func (s *LoginService) CheckPasswords(userName, password string) (bool, error) {
 	return s.UserService.CheckPassword(userName, password)
 }
 
 // ReadChallenge fetch data from Challgnge
-func (s *LoginService) ReadChallenge(loginChallenge, challengeMethod string) (challengeBody model.LoginChallenge, err error) {
-	return s.HydraAdapter.ReadChallenge(loginChallenge, challengeMethod)
+func (s *LoginService) ReadChallenge(ctx context.Context, loginChallenge, challengeMethod string) (challengeBody model.LoginChallenge, err error) {
+	return s.HydraAdapter.ReadChallenge(ctx, loginChallenge, challengeMethod)
 }
 
 // SendRejectBody used to reqject requests for login, logout or consent
-func (s *LoginService) SendRejectBody(method, challenge string, rawJson []byte) (redirectUrl string, err error) {
-	return s.HydraAdapter.SendRejectBody(method, challenge, rawJson)
+func (s *LoginService) SendRejectBody(ctx context.Context, method, challenge string, rawJson []byte) (redirectUrl string, err error) {
+	return s.HydraAdapter.SendRejectBody(ctx, method, challenge, rawJson)
 }
 
 // SendAcceptBody used to accept requests
-func (s *LoginService) SendAcceptBody(method, challenge string, rawJson []byte) (redirectUrl string, err error) {
-	return s.HydraAdapter.SendAcceptBody(method, challenge, rawJson)
+func (s *LoginService) SendAcceptBody(ctx context.Context, method, challenge string, rawJson []byte) (redirectUrl string, err error) {
+	return s.HydraAdapter.SendAcceptBody(ctx, method, challenge, rawJson)
+}
+
+// AcceptUserCode accepts the user code of a device challenge and returns the redirect to the login of the device
+func (s *LoginService) AcceptUserCode(ctx context.Context, deviceChallenge, userCode string) (redirectUrl string, err error) {
+	deviceAdapter, ok := s.HydraAdapter.(DeviceAdapter)
+	if !ok {
+		return "", errDeviceFlowUnsupported
+	}
+	redirectUrl, err = deviceAdapter.AcceptUserCode(ctx, deviceChallenge, userCode)
+	if err == adapter.ErrUnsupportedVersion {
+		return "", errDeviceFlowUnsupported
+	}
+	return
+}
+
+// HasMembership returns true if the user has at least one role for the client
+func (s *LoginService) HasMembership(subject, clientID string) (bool, error) {
+	roles, err := s.FindRoles(subject, clientID)
+	return len(roles) != 0, err
 }
 
-func (s *LoginService) RedirectFromConsent(allowedScopes, allowedAccessToken []string, consentChallenge, userName, clientName string) (redirectUrl string, err error) {
+// FindRoles returns the roles of the user which are sent to the client
+func (s *LoginService) FindRoles(subject, clientID string) ([]string, error) {
+	user, err := s.UserService.FindUserBySubject(subject)
+	if err != nil {
+		return nil, err
+	}
+	return rolesFor(user, clientID), nil
+}
+
+func (s *LoginService) RedirectFromConsent(ctx context.Context, allowedScopes, allowedAccessToken []string, consentChallenge, subject, clientName string, clientSettings model.ClientSettings) (redirectUrl string, err error) {
+	allowedScopes = filterAllowedScopes(clientSettings, allowedScopes)
 	scope := make([]string, 0, len(allowedScopes))
 	for _, allowedScope := range allowedScopes {
 		scope = append(scope, string(allowedScope))
@@ -56,37 +108,22 @@ func (s *LoginService) RedirectFromConsent(allowedScopes, allowedAccessToken []s
 		accesToken = append(accesToken, string(allowedToken))
 	}
 
-	user, err := s.UserService.FindUserByEmailOrUserName(userName)
+	user, err := s.UserService.FindUserBySubject(subject)
 	if err != nil {
 		return
 	}
-	roles := make([]string, 0, len(user.Applications))
-
-	for _, application := range user.Applications {
-		if application.ApplicationName == clientName {
-			roles = append(roles, application.Roles...)
-		}
+	if user.Disabled != nil && *user.Disabled {
+		return "", errors.New("user is disabled")
 	}
-
-	userInfoToken := model.UserInfoToken{
-		EMail:    user.Email,
-		LastName: user.LastName,
-		UserName: user.UserName,
-		Roles:    roles,
-	}
-
 	acceptConsentBody := model.AcceptConsent{
 		GrantScope:               scope,
 		GrantAccessTokenAudience: accesToken,
-		Remember:                 true,
-		RememberFor:              0,
-		Session: model.SessionInfo{
-			AccessToken: userInfoToken,
-			IDToken:     userInfoToken,
-		},
+		Remember:                 clientSettings.ConsentRemember,
+		RememberFor:              clientSettings.ConsentRememberFor,
+		Session:                  s.ClaimsService.BuildSession(user, clientName, scope),
 	}
 
 	rawJson, err := json.Marshal(acceptConsentBody)
 
-	return s.HydraAdapter.SendAcceptBody("consent", consentChallenge, rawJson)
+	return s.HydraAdapter.SendAcceptBody(ctx, "consent", consentChallenge, rawJson)
 }
@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"user-service/model"
+)
+
+const (
+	loginSessionCookie  = "idp_login_session"
+	pendingLoginTimeout = 5 * time.Minute
+)
+
+// LoginSession remembers how the user of the browser authenticated, as hydra does not tell the login page
+type LoginSession struct {
+	secret   []byte
+	lifetime time.Duration
+	secure   bool
+}
+
+// pendingLogin is a login which waits for the second factor
+type pendingLogin struct {
+	Authentication model.Authentication `json:"authentication"`
+	Challenge      string               `json:"challenge"`
+	Remember       bool                 `json:"remember"`
+	Expires        int64                `json:"expires"`
+}
+
+func NewLoginSession() LoginSession {
+	secret := []byte(os.Getenv("LOGIN_SESSION_SECRET"))
+	if len(secret) == 0 {
+		log.Println("LOGIN_SESSION_SECRET is not set, remembered logins do not survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal(err)
+		}
+	}
+	lifetime, err := time.ParseDuration(os.Getenv("LOGIN_SESSION_LIFETIME"))
+	if err != nil {
+		lifetime = 720 * time.Hour
+	}
+	return LoginSession{
+		secret:   secret,
+		lifetime: lifetime,
+		secure:   os.Getenv("LOGIN_SESSION_INSECURE") != "true",
+	}
+}
+
+// Create remembers the authentication in the session cookie
+func (s *LoginSession) Create(w http.ResponseWriter, authentication model.Authentication) {
+	value, err := s.encode(authentication)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginSessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  time.Now().Add(s.lifetime),
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Read returns the authentication of the subject, ok is false if the browser has none
+func (s *LoginSession) Read(r *http.Request, subject string) (authentication model.Authentication, ok bool) {
+	cookie, err := r.Cookie(loginSessionCookie)
+	if err != nil {
+		return authentication, false
+	}
+	if err := s.decode(cookie.Value, &authentication); err != nil {
+		log.Println(err)
+		return authentication, false
+	}
+	if authentication.Subject != subject || time.Since(time.Unix(authentication.AuthTime, 0)) > s.lifetime {
+		return authentication, false
+	}
+	return authentication, true
+}
+
+// CreatePending signs an authentication which is completed by a second factor for the login challenge
+func (s *LoginSession) CreatePending(authentication model.Authentication, challenge string, remember bool) string {
+	value, err := s.encode(pendingLogin{
+		Authentication: authentication,
+		Challenge:      challenge,
+		Remember:       remember,
+		Expires:        time.Now().Add(pendingLoginTimeout).Unix(),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	return value
+}
+
+// ReadPending returns the authentication waiting for the second factor of the login challenge
+// and whether the user wants to stay signed in
+func (s *LoginSession) ReadPending(value, challenge string) (authentication model.Authentication, remember bool, err error) {
+	var pending pendingLogin
+	if err := s.decode(value, &pending); err != nil {
+		return authentication, false, err
+	}
+	if pending.Challenge != challenge {
+		return authentication, false, errors.New("pending login belongs to another challenge")
+	}
+	if time.Now().Unix() > pending.Expires {
+		return authentication, false, errors.New("pending login expired")
+	}
+	return pending.Authentication, pending.Remember, nil
+}
+
+func (s *LoginSession) encode(value interface{}) (string, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + s.sign(encodedPayload), nil
+}
+
+func (s *LoginSession) decode(value string, target interface{}) error {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return errors.New("malformed login session")
+	}
+	if !hmac.Equal([]byte(s.sign(parts[0])), []byte(parts[1])) {
+		return errors.New("invalid login session signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, target)
+}
+
+func (s *LoginSession) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
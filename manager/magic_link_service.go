@@ -0,0 +1,175 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"user-service/model"
+	"user-service/repository"
+)
+
+const magicLinkRateWindow = 15 * time.Minute
+
+var errMagicLinkRateLimited = errors.New("too many login links requested")
+
+type MagicLinkDatabaseHandler interface {
+	CreateMagicLink(*model.MagicLink) error
+	FindMagicLinkByToken(string) (model.MagicLink, error)
+	UseMagicLink(*model.MagicLink) error
+}
+
+// MagicLinkService mails single-use login links bound to a login challenge
+type MagicLinkService struct {
+	UserService       UserService
+	databaseHandler   MagicLinkDatabaseHandler
+	mailSender        MailSender
+	mailConfig        model.MailConfig
+	baseURL           string
+	lifetime          time.Duration
+	addressLimiter    *rateLimiter
+	remoteAddrLimiter *rateLimiter
+}
+
+// NewMagicLinkService returns nil if no mails can be sent, login links are disabled then
+func NewMagicLinkService() *MagicLinkService {
+	mailSender := newMailSender()
+	if mailSender == nil {
+		log.Println("SMTP_HOST or MAIL_DIR is not set, login links are disabled")
+		return nil
+	}
+	databaseHandler, err := repository.NewDatabaseHandler()
+	if err != nil {
+		log.Println("could not create new Service due to database initialization")
+		log.Fatal(err)
+	}
+
+	pwd, err := os.Getwd()
+	if pwd == "/" {
+		pwd = ""
+	}
+	var mailConfig model.MailConfig
+	mailFile, err := os.Open(pwd + "/config/mail_config.json")
+	if err != nil {
+		log.Println(err)
+	} else {
+		if err = json.NewDecoder(mailFile).Decode(&mailConfig); err != nil {
+			log.Println(err)
+		}
+		mailFile.Close()
+	}
+
+	baseURL := os.Getenv("PUBLIC_URL")
+	if baseURL == "" {
+		baseURL = "http://127.0.0.1:3000"
+	}
+	lifetime, err := time.ParseDuration(os.Getenv("MAGIC_LINK_LIFETIME"))
+	if err != nil {
+		lifetime = 10 * time.Minute
+	}
+	addressLimit, err := strconv.Atoi(os.Getenv("MAGIC_LINK_LIMIT_ADDRESS"))
+	if err != nil || addressLimit < 1 {
+		addressLimit = 3
+	}
+	remoteAddrLimit, err := strconv.Atoi(os.Getenv("MAGIC_LINK_LIMIT_IP"))
+	if err != nil || remoteAddrLimit < 1 {
+		remoteAddrLimit = 10
+	}
+
+	return &MagicLinkService{
+		UserService:       NewUserService(),
+		databaseHandler:   &databaseHandler,
+		mailSender:        mailSender,
+		mailConfig:        mailConfig,
+		baseURL:           strings.TrimSuffix(baseURL, "/"),
+		lifetime:          lifetime,
+		addressLimiter:    newRateLimiter(addressLimit, magicLinkRateWindow),
+		remoteAddrLimiter: newRateLimiter(remoteAddrLimit, magicLinkRateWindow),
+	}
+}
+
+// Send mails a login link for the challenge to the user with the email. Unknown and disabled addresses are not
+// reported, so addresses cannot be probed, but count for the rate limit as well
+func (s *MagicLinkService) Send(email, challenge, clientName, remoteAddr string) error {
+	email = strings.TrimSpace(email)
+	if !s.remoteAddrLimiter.Allow(remoteAddr) || !s.addressLimiter.Allow(strings.ToLower(email)) {
+		return errMagicLinkRateLimited
+	}
+	user, err := s.UserService.databaseHandler.FindByEmail(email)
+	if err != nil || user.Disabled {
+		if err != nil && !s.UserService.databaseHandler.IsNotFoundError(err) {
+			log.Println(err)
+		}
+		return nil
+	}
+
+	rawToken := make([]byte, 32)
+	if _, err := rand.Read(rawToken); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(rawToken)
+	link := model.MagicLink{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(s.lifetime),
+	}
+	if err := s.databaseHandler.CreateMagicLink(&link); err != nil {
+		return err
+	}
+
+	mail, err := s.buildMail(user, s.baseURL+"/login/magic?"+url.Values{"token": {token}}.Encode(), clientName)
+	if err != nil {
+		return err
+	}
+	return s.mailSender.Send(mail)
+}
+
+// Redeem returns the login link of the token and the user it was sent to, a link can only be redeemed once
+func (s *MagicLinkService) Redeem(token string) (model.MagicLink, model.UserDTO, error) {
+	link, err := s.databaseHandler.FindMagicLinkByToken(hashToken(token))
+	if err != nil {
+		return model.MagicLink{}, model.UserDTO{}, errors.New("unknown login link")
+	}
+	if link.UsedAt != nil || time.Now().After(link.ExpiresAt) {
+		return model.MagicLink{}, model.UserDTO{}, errors.New("login link expired")
+	}
+	if err := s.databaseHandler.UseMagicLink(&link); err != nil {
+		return model.MagicLink{}, model.UserDTO{}, err
+	}
+	user, err := s.UserService.FindUser(link.UserID)
+	if err != nil {
+		return model.MagicLink{}, model.UserDTO{}, err
+	}
+	if user.Disabled != nil && *user.Disabled {
+		return model.MagicLink{}, model.UserDTO{}, errors.New("user is disabled")
+	}
+	return link, user, nil
+}
+
+func (s *MagicLinkService) buildMail(user model.User, link, clientName string) (model.Mail, error) {
+	body, err := template.New("magic_link").Parse(s.mailConfig.MagicLinkBody)
+	if err != nil {
+		return model.Mail{}, err
+	}
+	var text bytes.Buffer
+	err = body.Execute(&text, map[string]interface{}{
+		"Name":       user.Name,
+		"UserName":   user.UserName,
+		"ClientName": clientName,
+		"Link":       link,
+		"Minutes":    int(s.lifetime.Minutes()),
+	})
+	if err != nil {
+		return model.Mail{}, err
+	}
+	return model.Mail{To: user.Email, Subject: s.mailConfig.MagicLinkSubject, Body: text.String()}, nil
+}
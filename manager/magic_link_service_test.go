@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+	"user-service/adapter"
+	"user-service/model"
+
+	"github.com/jinzhu/gorm"
+)
+
+type mockMagicLinkDatabase struct {
+	links []model.MagicLink
+}
+
+func (m *mockMagicLinkDatabase) CreateMagicLink(link *model.MagicLink) error {
+	link.ID = uint(len(m.links) + 1)
+	m.links = append(m.links, *link)
+	return nil
+}
+
+func (m *mockMagicLinkDatabase) FindMagicLinkByToken(tokenHash string) (model.MagicLink, error) {
+	for _, link := range m.links {
+		if link.TokenHash == tokenHash {
+			return link, nil
+		}
+	}
+	return model.MagicLink{}, gorm.ErrRecordNotFound
+}
+
+func (m *mockMagicLinkDatabase) UseMagicLink(link *model.MagicLink) error {
+	for i := range m.links {
+		if m.links[i].ID == link.ID {
+			if m.links[i].UsedAt != nil {
+				return errors.New("login link was already used")
+			}
+			now := time.Now()
+			m.links[i].UsedAt = &now
+			link.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+// newTestMagicLinkService writes the mails to a temporary directory
+func newTestMagicLinkService(t *testing.T, database DatabaseHandler) (*MagicLinkService, string) {
+	dir, err := ioutil.TempDir("", "mails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	mailSender := adapter.NewFileSender(dir)
+	return &MagicLinkService{
+		UserService:       UserService{databaseHandler: database},
+		databaseHandler:   &mockMagicLinkDatabase{},
+		mailSender:        &mailSender,
+		mailConfig:        model.MailConfig{MagicLinkSubject: "Login", MagicLinkBody: "{{.ClientName}}: {{.Link}}"},
+		baseURL:           "http://idp",
+		lifetime:          time.Minute,
+		addressLimiter:    newRateLimiter(2, time.Minute),
+		remoteAddrLimiter: newRateLimiter(3, time.Minute),
+	}, dir
+}
+
+// readMagicLink returns the token of the only mail of the directory
+func readMagicLink(t *testing.T, dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatal("one mail should be sent", files)
+	}
+	content, _ := ioutil.ReadFile(files[0])
+	os.Remove(files[0])
+	match := regexp.MustCompile(`http://idp/login/magic\?token=(\S+)`).FindStringSubmatch(string(content))
+	if match == nil {
+		t.Fatal("mail should contain the login link", string(content))
+	}
+	return match[1]
+}
+
+func TestMagicLinkService(t *testing.T) {
+	service, dir := newTestMagicLinkService(t, newMockUserDatabase())
+
+	if err := service.Send("homer@springfield.com", "challenge", "App", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	token := readMagicLink(t, dir)
+	link, user, err := service.Redeem(token)
+	if err != nil || link.Challenge != "challenge" || user.UserName != "homer" {
+		t.Fatal("link should log in homer for the challenge", link, user, err)
+	}
+	if _, _, err := service.Redeem(token); err == nil {
+		t.Error("link should only be used once")
+	}
+
+	service.Send("homer@springfield.com", "challenge", "App", "10.0.0.1")
+	token = readMagicLink(t, dir)
+	service.databaseHandler.(*mockMagicLinkDatabase).links[1].ExpiresAt = time.Now().Add(-time.Second)
+	if _, _, err := service.Redeem(token); err == nil {
+		t.Error("expired link should be rejected")
+	}
+}
+
+func TestMagicLinkService_RateLimit(t *testing.T) {
+	service, dir := newTestMagicLinkService(t, newMockUserDatabase())
+
+	if err := service.Send("nobody@springfield.com", "challenge", "App", "10.0.0.1"); err != nil {
+		t.Error("unknown addresses should not be reported", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.eml")); len(files) != 0 {
+		t.Error("no mail should be sent to unknown addresses", files)
+	}
+
+	service.Send("homer@springfield.com", "challenge", "App", "10.0.0.1")
+	service.Send("homer@springfield.com", "challenge", "App", "10.0.0.2")
+	if err := service.Send("Homer@springfield.com", "challenge", "App", "10.0.0.3"); err != errMagicLinkRateLimited {
+		t.Error("third link to the address should be rate limited", err)
+	}
+	if err := service.Send("marge@springfield.com", "challenge", "App", "10.0.0.1"); err != nil {
+		t.Error("third link from the address should be sent", err)
+	}
+	if err := service.Send("marge@springfield.com", "challenge", "App", "10.0.0.1"); err != errMagicLinkRateLimited {
+		t.Error("fourth link from the address should be rate limited", err)
+	}
+}
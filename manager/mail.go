@@ -0,0 +1,26 @@
+package manager
+
+import (
+	"os"
+	"user-service/adapter"
+	"user-service/model"
+)
+
+// MailSender delivers the mails of the login flows
+type MailSender interface {
+	Send(model.Mail) error
+}
+
+// newMailSender sends through SMTP_HOST or writes the mails to MAIL_DIR for development,
+// it returns nil if neither is configured
+func newMailSender() MailSender {
+	if os.Getenv("SMTP_HOST") != "" {
+		smtpSender := adapter.NewSMTPSender()
+		return &smtpSender
+	}
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		fileSender := adapter.NewFileSender(dir)
+		return &fileSender
+	}
+	return nil
+}
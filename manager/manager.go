@@ -4,16 +4,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"user-service/adapter"
 	"user-service/model"
 )
 
+// templateDir is the directory the pages are rendered from, relative to the working directory
+var templateDir = "templates"
+
 // Service Handler for Config and Services
 type ConfigService struct {
 	LoginData       model.LoginPageData
 	LogoutData      model.LogoutPage
 	ConsentData     model.ConsentData
 	AcceptLoginData model.AcceptLogin
+	ErrorData       model.ErrorPage
+	ErrorPages      map[string]model.ErrorPage
+	ScopeCatalog    model.ScopeCatalog
+	AccountLogin    model.AccountLoginPage
+	AccountConsents model.AccountConsentsPage
+	AccountDevices  model.AccountDevicesPage
 }
 
 // NewService creates new instance of a Service
@@ -65,20 +78,95 @@ func NewConfigService() (manager ConfigService, err error) {
 		log.Println(err)
 	}
 
+	var errorPageData model.ErrorPage
+	errorFile, err := os.Open(pwd + "/config/error_config.json")
+	if err != nil {
+		log.Println(err)
+	}
+	decoder = json.NewDecoder(errorFile)
+	err = decoder.Decode(&errorPageData)
+	if err != nil {
+		log.Println(err)
+	}
+	errorPages := make(map[string]model.ErrorPage, len(errorPageData.Translations))
+	for language, translation := range errorPageData.Translations {
+		errorPage := errorPageData
+		errorPage.ErrorMessages = make(map[string]string, len(errorPageData.ErrorMessages))
+		for errorName, message := range errorPageData.ErrorMessages {
+			errorPage.ErrorMessages[errorName] = message
+		}
+		if err := json.Unmarshal(translation, &errorPage); err != nil {
+			log.Println(err)
+			continue
+		}
+		errorPages[strings.ToLower(language)] = errorPage
+	}
+
+	var scopeCatalog model.ScopeCatalog
+	scopeFile, err := os.Open(pwd + "/config/scope_config.json")
+	if err != nil {
+		log.Println(err)
+	}
+	decoder = json.NewDecoder(scopeFile)
+	err = decoder.Decode(&scopeCatalog)
+	if err != nil {
+		log.Println(err)
+	}
+
+	var accountLoginData model.AccountLoginPage
+	accountLoginFile, err := os.Open(pwd + "/config/account_login_config.json")
+	if err != nil {
+		log.Println(err)
+	}
+	decoder = json.NewDecoder(accountLoginFile)
+	err = decoder.Decode(&accountLoginData)
+	if err != nil {
+		log.Println(err)
+	}
+
+	var accountConsentsData model.AccountConsentsPage
+	accountConsentsFile, err := os.Open(pwd + "/config/account_consents_config.json")
+	if err != nil {
+		log.Println(err)
+	}
+	decoder = json.NewDecoder(accountConsentsFile)
+	err = decoder.Decode(&accountConsentsData)
+	if err != nil {
+		log.Println(err)
+	}
+
+	var accountDevicesData model.AccountDevicesPage
+	accountDevicesFile, err := os.Open(pwd + "/config/account_devices_config.json")
+	if err != nil {
+		log.Println(err)
+	}
+	decoder = json.NewDecoder(accountDevicesFile)
+	err = decoder.Decode(&accountDevicesData)
+	if err != nil {
+		log.Println(err)
+	}
+
 	manager = ConfigService{
 		LoginData:       loginPageData,
 		LogoutData:      logoutPageData,
 		ConsentData:     consentPageData,
 		AcceptLoginData: acceptLoginData,
+		ErrorData:       errorPageData,
+		ErrorPages:      errorPages,
+		ScopeCatalog:    scopeCatalog,
+		AccountLogin:    accountLoginData,
+		AccountConsents: accountConsentsData,
+		AccountDevices:  accountDevicesData,
 	}
 	return
 }
 
 // FetchLoginConfig returns prepared Login Page Data
-func (s *ConfigService) FetchLoginConfig(challenge string, withError bool) (loginPageData model.LoginPageData) {
+func (s *ConfigService) FetchLoginConfig(challenge string, client model.Client, withError bool) (loginPageData model.LoginPageData) {
 
 	loginPageData = s.LoginData
 	loginPageData.Challenge = challenge
+	loginPageData.Client = client
 	if withError {
 		loginPageData.ErrorMessage = "Benutzername oder Passwort falsch"
 	}
@@ -86,6 +174,36 @@ func (s *ConfigService) FetchLoginConfig(challenge string, withError bool) (logi
 	return
 }
 
+// FetchSecondFactorConfig returns prepared Login Page Data asking for the second factor of a pending login
+func (s *ConfigService) FetchSecondFactorConfig(challenge string, client model.Client, pendingLogin string, withError bool) (loginPageData model.LoginPageData) {
+	loginPageData = s.FetchLoginConfig(challenge, client, false)
+	loginPageData.SecondFactor = true
+	loginPageData.PendingLogin = pendingLogin
+	if withError {
+		loginPageData.ErrorMessage = loginPageData.SecondFactorErrorMessage
+	}
+	return
+}
+
+// FetchMagicLinkConfirmConfig returns prepared Login Page Data asking to log in with the token of a login link
+func (s *ConfigService) FetchMagicLinkConfirmConfig(token string) (loginPageData model.LoginPageData) {
+	loginPageData = s.LoginData
+	loginPageData.MagicLinkToken = token
+	return
+}
+
+// FetchDeviceConfig returns prepared Login Page Data asking for the user code of a device challenge
+func (s *ConfigService) FetchDeviceConfig(deviceChallenge, userCode string, withError bool) (loginPageData model.LoginPageData) {
+	loginPageData = s.LoginData
+	loginPageData.DeviceVerification = true
+	loginPageData.Challenge = deviceChallenge
+	loginPageData.UserCode = userCode
+	if withError {
+		loginPageData.ErrorMessage = loginPageData.UserCodeErrorMessage
+	}
+	return
+}
+
 // FetchLogoutConfig returns prepared Logout Page Data
 func (s *ConfigService) FetchLogoutConfig(challenge, subject string) (logoutPageData model.LogoutPage) {
 	logoutPageData = s.LogoutData
@@ -94,12 +212,22 @@ func (s *ConfigService) FetchLogoutConfig(challenge, subject string) (logoutPage
 	return
 }
 
+// FetchFrontChannelLogoutConfig returns prepared Logout Page Data which logs out the clients and continues with redirectURL
+func (s *ConfigService) FetchFrontChannelLogoutConfig(redirectURL string, clients []model.FrontChannelClient) (logoutPageData model.LogoutPage) {
+	logoutPageData = s.LogoutData
+	logoutPageData.RedirectURL = redirectURL
+	logoutPageData.FrontChannelClients = clients
+	if logoutPageData.FrontChannelTimeout <= 0 {
+		logoutPageData.FrontChannelTimeout = 5
+	}
+	return
+}
+
 // FetchConsentConfig returns prepared Consent Page Data
-func (s *ConfigService) FetchConsentConfig(clientID, challenge, userName string, requestedScopes, grantedAccesToken []model.ReqestScope) (consentPageData model.ConsentData) {
+func (s *ConfigService) FetchConsentConfig(client model.Client, challenge string, requestedScopes, grantedAccesToken []model.ReqestScope) (consentPageData model.ConsentData) {
 	consentPageData = s.ConsentData
-	consentPageData.UserName = userName
-	consentPageData.ClientName = clientID
-	consentPageData.RequestMessage = fmt.Sprintf(s.ConsentData.RequestMessage, clientID)
+	consentPageData.RequestMessage = fmt.Sprintf(s.ConsentData.RequestMessage, client.DisplayName())
+	consentPageData.Client = client
 	consentPageData.Challenge = challenge
 	consentPageData.ReqestScopes = requestedScopes
 	consentPageData.GrantedAccessToken = grantedAccesToken
@@ -107,10 +235,142 @@ func (s *ConfigService) FetchConsentConfig(clientID, challenge, userName string,
 
 }
 
-// FetchAcceptLoginConfig returns prepared Accept Login Data
-func (s *ConfigService) FetchAcceptLoginConfig(userName string) (acceptLoginData model.AcceptLogin) {
+// IsRequiredScope returns true if the scope cannot be unchecked on the consent page
+func (s *ConfigService) IsRequiredScope(scope string) bool {
+	return s.ScopeCatalog.Scopes[scope].Required
+}
+
+// FetchScopeDescriptions returns the scopes with texts in the preferred language of the Accept-Language header
+func (s *ConfigService) FetchScopeDescriptions(scopes []string, acceptLanguage string) []model.ReqestScope {
+	requestScopes := make([]model.ReqestScope, 0, len(scopes))
+	for _, scope := range scopes {
+		description, ok := s.ScopeCatalog.Scopes[scope]
+		requestScope := model.ReqestScope{ScopeName: scope, ScopeValue: scope}
+		if ok {
+			language := s.preferredLanguage(acceptLanguage, description.DisplayName)
+			if displayName := description.DisplayName[language]; displayName != "" {
+				requestScope.ScopeName = displayName
+			}
+			requestScope.Description = description.Description[language]
+			requestScope.Icon = description.Icon
+			requestScope.Sensitivity = description.Sensitivity
+			requestScope.Required = description.Required
+		}
+		requestScopes = append(requestScopes, requestScope)
+	}
+	sort.SliceStable(requestScopes, func(i, j int) bool { return requestScopes[i].Required && !requestScopes[j].Required })
+	return requestScopes
+}
+
+func (s *ConfigService) preferredLanguage(acceptLanguage string, texts map[string]string) string {
+	language := matchLanguage(acceptLanguage, func(language string) bool {
+		_, ok := texts[language]
+		return ok
+	})
+	if language == "" {
+		return s.ScopeCatalog.DefaultLanguage
+	}
+	return language
+}
+
+// matchLanguage returns the first language of the Accept-Language header which is available or an empty string
+func matchLanguage(acceptLanguage string, available func(string) bool) string {
+	for _, tag := range strings.Split(acceptLanguage, ",") {
+		language := strings.ToLower(strings.TrimSpace(strings.Split(tag, ";")[0]))
+		if available(language) {
+			return language
+		}
+		language = strings.Split(language, "-")[0]
+		if available(language) {
+			return language
+		}
+	}
+	return ""
+}
+
+// FetchErrorConfig returns the Error Page Data in the preferred language of the Accept-Language header
+func (s *ConfigService) FetchErrorConfig(acceptLanguage string) model.ErrorPage {
+	language := matchLanguage(acceptLanguage, func(language string) bool {
+		if language == strings.ToLower(s.ErrorData.DefaultLanguage) {
+			return true
+		}
+		_, ok := s.ErrorPages[language]
+		return ok
+	})
+	if errorPage, ok := s.ErrorPages[language]; ok {
+		return errorPage
+	}
+	return s.ErrorData
+}
+
+// ValidateGrantedScopes returns an error message if nothing or not all required scopes were granted
+func (s *ConfigService) ValidateGrantedScopes(requestedScopes, grantedScopes []string) string {
+	for _, scope := range requestedScopes {
+		if s.IsRequiredScope(scope) && !contains(grantedScopes, scope) {
+			return fmt.Sprintf(s.ConsentData.RequiredScopeMessage, scope)
+		}
+	}
+	if len(requestedScopes) != 0 && len(grantedScopes) == 0 {
+		return s.ConsentData.NothingGrantedMessage
+	}
+	return ""
+}
+
+// FetchAcceptLoginConfig returns prepared Accept Login Data with the remember and subject settings of the client
+func (s *ConfigService) FetchAcceptLoginConfig(subject string, clientSettings model.ClientSettings) (acceptLoginData model.AcceptLogin, err error) {
 	acceptLoginData = s.AcceptLoginData
-	acceptLoginData.Subject = userName
+	acceptLoginData.Subject = subject
+	if clientSettings.SubjectType == SubjectTypePairwise {
+		if acceptLoginData.ForceSubjectIdentifier, err = pairwiseSubject(subject, clientSettings.ClientID); err != nil {
+			return
+		}
+	}
+	acceptLoginData.Remember = clientSettings.LoginRemember
+	acceptLoginData.RememberFor = clientSettings.LoginRememberFor
 	return
 
 }
+
+// FetchHydraErrorConfig returns the status code and prepared Error Page Data for a failed hydra request
+func (s *ConfigService) FetchHydraErrorConfig(err error, acceptLanguage string) (statusCode int, errorPageData model.ErrorPage) {
+	errorPageData = s.FetchErrorConfig(acceptLanguage)
+	errorPageData.ErrorTitle = errorPageData.HydraErrorTitle
+	hydraError, ok := adapter.AsHydraError(err)
+	switch {
+	case !ok:
+		statusCode = http.StatusServiceUnavailable
+		errorPageData.ErrorMessage = errorPageData.UnavailableMessage
+	case hydraError.IsNotFound():
+		statusCode = http.StatusNotFound
+		errorPageData.ErrorMessage = errorPageData.ExpiredRequestMessage
+	case hydraError.IsServerError():
+		statusCode = http.StatusBadGateway
+		errorPageData.ErrorMessage = errorPageData.UnavailableMessage
+	default:
+		statusCode = http.StatusBadRequest
+		errorPageData.ErrorMessage = errorPageData.RequestFailedMessage
+		if hydraError.Description != "" {
+			errorPageData.ErrorMessage += " " + hydraError.Description
+		}
+	}
+	return
+}
+
+// FetchRedirectErrorConfig returns prepared Error Page Data for an error hydra redirected to the error url,
+// only configured messages are shown as the error parameters are not trustworthy
+func (s *ConfigService) FetchRedirectErrorConfig(errorName, acceptLanguage string) (errorPageData model.ErrorPage) {
+	errorPageData = s.FetchErrorConfig(acceptLanguage)
+	errorPageData.ErrorTitle = errorPageData.HydraErrorTitle
+	errorPageData.ErrorMessage = errorPageData.RequestFailedMessage
+	if message, ok := errorPageData.ErrorMessages[errorName]; ok {
+		errorPageData.ErrorMessage = message
+	}
+	return
+}
+
+// FetchAccessDeniedConfig returns prepared Error Page Data for a client the user has no access to
+func (s *ConfigService) FetchAccessDeniedConfig(clientName, acceptLanguage string) (errorPageData model.ErrorPage) {
+	errorPageData = s.FetchErrorConfig(acceptLanguage)
+	errorPageData.ErrorMessage = fmt.Sprintf(errorPageData.AccessDeniedMessage, clientName)
+	return
+}
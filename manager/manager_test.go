@@ -0,0 +1,63 @@
+package manager
+
+import (
+	"net/http"
+	"testing"
+	"user-service/adapter"
+	"user-service/model"
+)
+
+func TestConfigService_FetchScopeDescriptions(t *testing.T) {
+	service := ConfigService{ScopeCatalog: model.ScopeCatalog{
+		DefaultLanguage: "de",
+		Scopes: map[string]model.ScopeDescription{
+			"openid":  {DisplayName: map[string]string{"de": "Anmeldung", "en": "Sign in"}, Required: true},
+			"offline": {DisplayName: map[string]string{"de": "Dauerhafter Zugriff", "en": "Offline access"}, Sensitivity: "medium"},
+		},
+	}}
+
+	scopes := service.FetchScopeDescriptions([]string{"offline", "custom", "openid"}, "en-US,en;q=0.9")
+	if len(scopes) != 3 {
+		t.Fatalf("expected 3 scopes but got %d", len(scopes))
+	}
+	if scopes[0].ScopeValue != "openid" || !scopes[0].Required || scopes[0].ScopeName != "Sign in" {
+		t.Error("required scopes should come first in the preferred language", scopes[0])
+	}
+	if scopes[1].ScopeName != "Offline access" || scopes[1].Sensitivity != "medium" {
+		t.Error("optional scope should be described", scopes[1])
+	}
+	if scopes[2].ScopeName != "custom" {
+		t.Error("unknown scope should keep its name", scopes[2])
+	}
+
+	if scopes := service.FetchScopeDescriptions([]string{"openid"}, "fr"); scopes[0].ScopeName != "Anmeldung" {
+		t.Error("unknown language should fall back to the default language", scopes[0])
+	}
+}
+
+func TestConfigService_FetchHydraErrorConfig(t *testing.T) {
+	service := ConfigService{ErrorData: model.ErrorPage{
+		HydraErrorTitle:       "failed",
+		ExpiredRequestMessage: "expired",
+		UnavailableMessage:    "unavailable",
+		RequestFailedMessage:  "invalid",
+	}}
+
+	errs := []struct {
+		err        error
+		statusCode int
+		message    string
+	}{
+		{&adapter.HydraError{StatusCode: http.StatusNotFound, Name: "Not Found"}, http.StatusNotFound, "expired"},
+		{&adapter.HydraError{StatusCode: http.StatusGone, Name: "request_was_handled"}, http.StatusNotFound, "expired"},
+		{&adapter.HydraError{StatusCode: http.StatusBadRequest, Name: "invalid_request", Description: "bad body"}, http.StatusBadRequest, "invalid bad body"},
+		{&adapter.HydraError{StatusCode: http.StatusInternalServerError, Name: "error"}, http.StatusBadGateway, "unavailable"},
+		{adapter.ErrCircuitOpen, http.StatusServiceUnavailable, "unavailable"},
+	}
+	for _, e := range errs {
+		statusCode, errorPageData := service.FetchHydraErrorConfig(e.err, "")
+		if statusCode != e.statusCode || errorPageData.ErrorMessage != e.message || errorPageData.ErrorTitle != "failed" {
+			t.Errorf("%v: unexpected error page %d %+v", e.err, statusCode, errorPageData)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"user-service/model"
+)
+
+const (
+	StageLogin   = "login"
+	StageConsent = "consent"
+)
+
+// PolicyContext contains everything a policy can be evaluated against
+type PolicyContext struct {
+	Stage    string
+	User     model.UserDTO
+	ClientID string
+	Scopes   []string
+	RemoteIP net.IP
+	Time     time.Time
+}
+
+// PolicyService evaluates the declarative access policies from config/policy_config.json
+type PolicyService struct {
+	Policies         []model.AccessPolicy
+	trustForwardedIP bool
+}
+
+func NewPolicyService() PolicyService {
+	pwd, err := os.Getwd()
+	if pwd == "/" {
+		pwd = ""
+	}
+	var policyConfig model.PolicyConfig
+	policyFile, err := os.Open(pwd + "/config/policy_config.json")
+	if err != nil {
+		log.Println(err)
+	} else {
+		if err = json.NewDecoder(policyFile).Decode(&policyConfig); err != nil {
+			log.Println(err)
+		}
+		policyFile.Close()
+	}
+
+	return PolicyService{
+		Policies:         policyConfig.Policies,
+		trustForwardedIP: os.Getenv("POLICY_TRUST_FORWARDED_FOR") == "true",
+	}
+}
+
+// NewPolicyContext prepares the context of the current request
+func (s *PolicyService) NewPolicyContext(r *http.Request, stage string, user model.UserDTO, challenge model.LoginChallenge) PolicyContext {
+	return PolicyContext{
+		Stage:    stage,
+		User:     user,
+		ClientID: challenge.Client.ClientID,
+		Scopes:   challenge.RequestedScope,
+		RemoteIP: s.remoteIP(r),
+		Time:     time.Now(),
+	}
+}
+
+// Evaluate denies the request as soon as one matching policy is violated
+func (s *PolicyService) Evaluate(ctx PolicyContext) model.PolicyDecision {
+	for _, policy := range s.Policies {
+		if !policyApplies(policy, ctx) {
+			continue
+		}
+		if reason := violation(policy, ctx); reason != "" {
+			log.Printf("policy %s denies %s of %s to client %s: %s", policy.Name, ctx.Stage, ctx.User.UserName, ctx.ClientID, reason)
+			description := policy.ErrorDescription
+			if description == "" {
+				description = reason
+			}
+			return model.PolicyDecision{Allowed: false, Policy: policy.Name, ErrorDescription: description}
+		}
+	}
+	return model.PolicyDecision{Allowed: true}
+}
+
+func policyApplies(policy model.AccessPolicy, ctx PolicyContext) bool {
+	if len(policy.Clients) != 0 && !contains(policy.Clients, ctx.ClientID) {
+		return false
+	}
+	return len(policy.Stages) == 0 || contains(policy.Stages, ctx.Stage)
+}
+
+func violation(policy model.AccessPolicy, ctx PolicyContext) string {
+	for applicationName, roles := range policy.RequireRoles {
+		if !hasAnyRole(ctx.User, applicationName, roles) {
+			return fmt.Sprintf("user requires one of the roles %s in application %s", strings.Join(roles, ", "), applicationName)
+		}
+	}
+	for _, scope := range ctx.Scopes {
+		if contains(policy.DeniedScopes, scope) {
+			return fmt.Sprintf("scope %s is not allowed", scope)
+		}
+	}
+	if len(policy.AllowedCIDRs) != 0 && !inNetworks(ctx.RemoteIP, policy.AllowedCIDRs) {
+		return "access is not allowed from this network"
+	}
+	if policy.BusinessHours != nil && !inTimeWindow(ctx.Time, *policy.BusinessHours) {
+		return "access is only allowed during business hours"
+	}
+	return ""
+}
+
+func hasAnyRole(user model.UserDTO, applicationName string, roles []string) bool {
+	for _, application := range user.Applications {
+		if application.ApplicationName != applicationName {
+			continue
+		}
+		for _, role := range application.Roles {
+			if contains(roles, role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inNetworks(ip net.IP, cidrs []string) bool {
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("invalid cidr %s in policy config", cidr)
+			continue
+		}
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func inTimeWindow(now time.Time, window model.TimeWindow) bool {
+	if window.Location != "" {
+		location, err := time.LoadLocation(window.Location)
+		if err != nil {
+			log.Printf("invalid location %s in policy config", window.Location)
+			return false
+		}
+		now = now.In(location)
+	}
+	if len(window.Days) != 0 && !contains(window.Days, now.Weekday().String()[:3]) {
+		return false
+	}
+	minutes := now.Hour()*60 + now.Minute()
+	from, err := parseClock(window.From, 0)
+	if err != nil {
+		return false
+	}
+	to, err := parseClock(window.To, 24*60)
+	if err != nil {
+		return false
+	}
+	return minutes >= from && minutes < to
+}
+
+func parseClock(clock string, fallback int) (int, error) {
+	if clock == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		log.Printf("invalid time %s in policy config", clock)
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (s *PolicyService) remoteIP(r *http.Request) net.IP {
+	if s.trustForwardedIP {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return net.ParseIP(strings.TrimSpace(strings.Split(forwarded, ",")[0]))
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
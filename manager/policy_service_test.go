@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"net"
+	"testing"
+	"time"
+	"user-service/model"
+)
+
+func TestPolicyService_Evaluate(t *testing.T) {
+	service := PolicyService{Policies: []model.AccessPolicy{
+		{Name: "admins", Clients: []string{"admin-client"}, RequireRoles: map[string][]string{"admin-client": {"admin"}}},
+		{Name: "office", Clients: []string{"payroll"}, Stages: []string{StageLogin}, AllowedCIDRs: []string{"10.0.0.0/8"},
+			BusinessHours: &model.TimeWindow{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, From: "08:00", To: "18:00", Location: "UTC"}},
+	}}
+	admin := model.UserDTO{UserName: "homer", Applications: []model.ApplicationRoleDTO{{ApplicationName: "admin-client", Roles: []string{"admin"}}}}
+	user := model.UserDTO{UserName: "bart"}
+	monday := time.Date(2020, 5, 4, 10, 0, 0, 0, time.UTC)
+	sunday := time.Date(2020, 5, 3, 10, 0, 0, 0, time.UTC)
+	office := net.ParseIP("10.1.2.3")
+	home := net.ParseIP("8.8.8.8")
+
+	cases := []struct {
+		name    string
+		ctx     PolicyContext
+		allowed bool
+	}{
+		{"admin may login", PolicyContext{Stage: StageLogin, User: admin, ClientID: "admin-client"}, true},
+		{"user may not login", PolicyContext{Stage: StageLogin, User: user, ClientID: "admin-client"}, false},
+		{"user may not consent", PolicyContext{Stage: StageConsent, User: user, ClientID: "admin-client"}, false},
+		{"other clients are not affected", PolicyContext{Stage: StageLogin, User: user, ClientID: "other"}, true},
+		{"office during business hours", PolicyContext{Stage: StageLogin, User: user, ClientID: "payroll", RemoteIP: office, Time: monday}, true},
+		{"office on sunday", PolicyContext{Stage: StageLogin, User: user, ClientID: "payroll", RemoteIP: office, Time: sunday}, false},
+		{"home during business hours", PolicyContext{Stage: StageLogin, User: user, ClientID: "payroll", RemoteIP: home, Time: monday}, false},
+		{"consent is not restricted by office policy", PolicyContext{Stage: StageConsent, User: user, ClientID: "payroll", RemoteIP: home, Time: sunday}, true},
+	}
+	for _, c := range cases {
+		decision := service.Evaluate(c.ctx)
+		if decision.Allowed != c.allowed {
+			t.Errorf("%s: expected allowed %v but got %v", c.name, c.allowed, decision.Allowed)
+		}
+		if !decision.Allowed && decision.ErrorDescription == "" {
+			t.Errorf("%s: denied decision should have an error description", c.name)
+		}
+	}
+}
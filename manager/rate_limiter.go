@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows a number of events per key within a sliding window
+type rateLimiter struct {
+	mutex  *sync.Mutex
+	limit  int
+	window time.Duration
+	events map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		mutex:  &sync.Mutex{},
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event of the key and returns false if the key reached the limit
+func (l *rateLimiter) Allow(key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	for k, events := range l.events {
+		if len(events) > 0 && now.Sub(events[len(events)-1]) > l.window {
+			delete(l.events, k)
+		}
+	}
+
+	recent := make([]time.Time, 0, l.limit)
+	for _, event := range l.events[key] {
+		if now.Sub(event) <= l.window {
+			recent = append(recent, event)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.events[key] = recent
+		return false
+	}
+	l.events[key] = append(recent, now)
+	return true
+}
@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"user-service/model"
+)
+
+type ReviewHandler struct {
+	ReviewPath    string
+	reviewService ReviewService
+}
+
+func NewReviewHandler() ReviewHandler {
+	return ReviewHandler{
+		ReviewPath:    "/review/",
+		reviewService: NewReviewService(),
+	}
+}
+
+// ManageReviews handles /review/{id}, /review/{id}/items/{itemId}, /review/{id}/close and /review/{id}/report
+func (h *ReviewHandler) ManageReviews(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(html.EscapeString(r.URL.Path), strings.TrimSuffix(h.ReviewPath, "/")), "/")
+	if path == "" {
+		h.manageCampaigns(w, r)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	campaignID, err := strconv.ParseUint(parts[0], 10, 64)
+	if campaignID == 0 || err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Id of campaign must be specified"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		campaign, err := h.reviewService.FindCampaign(uint(campaignID), r.URL.Query().Get("reviewer"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(campaign)
+	case len(parts) == 3 && parts[1] == "items" && r.Method == "PUT":
+		itemID, err := strconv.ParseUint(parts[2], 10, 64)
+		if itemID == 0 || err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Id of item must be specified"))
+			return
+		}
+		var decision model.ReviewDecisionDTO
+		if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := h.reviewService.Decide(uint(campaignID), uint(itemID), decision); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "close" && r.Method == "POST":
+		var closeDTO model.CloseCampaignDTO
+		json.NewDecoder(r.Body).Decode(&closeDTO)
+		campaign, err := h.reviewService.CloseCampaign(uint(campaignID), closeDTO.ClosedBy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(campaign)
+	case len(parts) == 2 && parts[1] == "report" && r.Method == "GET":
+		campaign, err := h.reviewService.FindCampaign(uint(campaignID), "")
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("format") == "csv" {
+			writeCampaignReport(w, campaign)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(campaign)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("unsupported review request"))
+	}
+}
+
+func (h *ReviewHandler) manageCampaigns(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		var campaignDTO model.ReviewCampaignDTO
+		if err := json.NewDecoder(r.Body).Decode(&campaignDTO); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		campaign, err := h.reviewService.StartCampaign(campaignDTO)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(campaign)
+		return
+	}
+	if r.Method == "GET" {
+		campaigns, err := h.reviewService.FindAllCampaigns()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(campaigns)
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte("Method must be GET or POST"))
+}
+
+func writeCampaignReport(w http.ResponseWriter, campaign model.ReviewCampaignDTO) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=campaign-"+strconv.FormatUint(uint64(campaign.ID), 10)+".csv")
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"campaign", "user", "application", "role", "reviewer", "decision", "decided_by", "decided_at", "comment", "applied"})
+	for _, item := range campaign.Items {
+		decidedAt := ""
+		if item.DecidedAt != nil {
+			decidedAt = item.DecidedAt.Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			campaign.Name,
+			item.UserName,
+			item.ApplicationName,
+			item.Role,
+			item.Reviewer,
+			item.Decision,
+			item.DecidedBy,
+			decidedAt,
+			item.Comment,
+			strconv.FormatBool(item.Applied),
+		})
+	}
+	writer.Flush()
+}
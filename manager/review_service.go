@@ -0,0 +1,260 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"user-service/model"
+	"user-service/repository"
+)
+
+type ReviewDatabaseHandler interface {
+	FindByID(uint) (model.User, error)
+	UpdateUser(*model.User) error
+	FindUsersFromApplication(string) ([]model.User, error)
+	CreateCampaign(*model.ReviewCampaign) error
+	FindAllCampaigns() ([]model.ReviewCampaign, error)
+	FindCampaignByID(uint) (model.ReviewCampaign, error)
+	UpdateCampaign(*model.ReviewCampaign) error
+	UpdateReviewItem(*model.ReviewItem) error
+	IsNotFoundError(error) bool
+}
+
+// ReviewService Business Logic for access review campaigns
+type ReviewService struct {
+	databaseHandler ReviewDatabaseHandler
+}
+
+func NewReviewService() ReviewService {
+	databaseHandler, err := repository.NewDatabaseHandler()
+	if err != nil {
+		log.Println("could not create new Service due to database initialization")
+		log.Fatal(err)
+	}
+
+	return ReviewService{
+		databaseHandler: &databaseHandler,
+	}
+}
+
+// StartCampaign snapshots all role assignments of the given applications and distributes them to the reviewers
+func (s *ReviewService) StartCampaign(campaignDTO model.ReviewCampaignDTO) (model.ReviewCampaignDTO, error) {
+	if campaignDTO.Name == "" {
+		return model.ReviewCampaignDTO{}, errors.New("A campaign must have a name")
+	}
+	if len(campaignDTO.Applications) == 0 {
+		return model.ReviewCampaignDTO{}, errors.New("A campaign must contain at least one application")
+	}
+	if len(campaignDTO.Reviewers) == 0 {
+		return model.ReviewCampaignDTO{}, errors.New("A campaign must have at least one reviewer")
+	}
+
+	items := make([]model.ReviewItem, 0)
+	for _, applicationName := range campaignDTO.Applications {
+		users, err := s.databaseHandler.FindUsersFromApplication(applicationName)
+		if err != nil {
+			return model.ReviewCampaignDTO{}, err
+		}
+		for _, user := range users {
+			for _, application := range user.Applications {
+				if application.ApplicationName != applicationName {
+					continue
+				}
+				for _, role := range application.Roles {
+					items = append(items, model.ReviewItem{
+						UserID:          user.ID,
+						UserName:        user.UserName,
+						ApplicationName: applicationName,
+						Role:            role,
+						Reviewer:        campaignDTO.Reviewers[len(items)%len(campaignDTO.Reviewers)],
+						Decision:        model.DecisionPending,
+					})
+				}
+			}
+		}
+	}
+
+	campaign := model.ReviewCampaign{
+		Name:         campaignDTO.Name,
+		Applications: campaignDTO.Applications,
+		Reviewers:    campaignDTO.Reviewers,
+		Status:       model.CampaignStatusOpen,
+		CreatedBy:    campaignDTO.CreatedBy,
+		Items:        items,
+	}
+	if err := s.databaseHandler.CreateCampaign(&campaign); err != nil {
+		return model.ReviewCampaignDTO{}, err
+	}
+	return mapCampaignToDTO(campaign, true), nil
+}
+
+// FindAllCampaigns returns all campaigns without items
+func (s *ReviewService) FindAllCampaigns() ([]model.ReviewCampaignDTO, error) {
+	campaigns, err := s.databaseHandler.FindAllCampaigns()
+	if err != nil {
+		log.Println(err)
+		return []model.ReviewCampaignDTO{}, err
+	}
+	campaignDTOs := make([]model.ReviewCampaignDTO, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		campaignDTOs = append(campaignDTOs, mapCampaignToDTO(campaign, false))
+	}
+	return campaignDTOs, nil
+}
+
+// FindCampaign returns a campaign with its items, optionally only the items of one reviewer
+func (s *ReviewService) FindCampaign(campaignID uint, reviewer string) (model.ReviewCampaignDTO, error) {
+	campaign, err := s.databaseHandler.FindCampaignByID(campaignID)
+	if err != nil {
+		return model.ReviewCampaignDTO{}, err
+	}
+	if reviewer != "" {
+		items := make([]model.ReviewItem, 0, len(campaign.Items))
+		for _, item := range campaign.Items {
+			if item.Reviewer == reviewer {
+				items = append(items, item)
+			}
+		}
+		campaign.Items = items
+	}
+	return mapCampaignToDTO(campaign, true), nil
+}
+
+// Decide records a keep or revoke decision of the assigned reviewer
+func (s *ReviewService) Decide(campaignID, itemID uint, decision model.ReviewDecisionDTO) error {
+	if decision.Decision != model.DecisionKeep && decision.Decision != model.DecisionRevoke {
+		return fmt.Errorf("decision must be %s or %s", model.DecisionKeep, model.DecisionRevoke)
+	}
+	campaign, err := s.databaseHandler.FindCampaignByID(campaignID)
+	if err != nil {
+		return err
+	}
+	if campaign.Status != model.CampaignStatusOpen {
+		return errors.New("campaign is already closed")
+	}
+	for _, item := range campaign.Items {
+		if item.ID != itemID {
+			continue
+		}
+		if item.Reviewer != decision.Reviewer {
+			return errors.New("item is assigned to another reviewer")
+		}
+		now := time.Now()
+		item.Decision = decision.Decision
+		item.DecidedBy = decision.Reviewer
+		item.DecidedAt = &now
+		item.Comment = decision.Comment
+		return s.databaseHandler.UpdateReviewItem(&item)
+	}
+	return errors.New("item does not belong to this campaign")
+}
+
+// CloseCampaign closes the campaign and removes all revoked roles from the users
+func (s *ReviewService) CloseCampaign(campaignID uint, closedBy string) (model.ReviewCampaignDTO, error) {
+	campaign, err := s.databaseHandler.FindCampaignByID(campaignID)
+	if err != nil {
+		return model.ReviewCampaignDTO{}, err
+	}
+	if campaign.Status != model.CampaignStatusOpen {
+		return model.ReviewCampaignDTO{}, errors.New("campaign is already closed")
+	}
+
+	revocations := make(map[uint][]model.ReviewItem)
+	for _, item := range campaign.Items {
+		if item.Decision == model.DecisionRevoke {
+			revocations[item.UserID] = append(revocations[item.UserID], item)
+		}
+	}
+
+	for userID, items := range revocations {
+		user, err := s.databaseHandler.FindByID(userID)
+		if s.databaseHandler.IsNotFoundError(err) {
+			log.Printf("user %d of campaign %d does not exist anymore", userID, campaignID)
+			continue
+		}
+		if err != nil {
+			return model.ReviewCampaignDTO{}, err
+		}
+		user.Applications = revokeRoles(user.Applications, items)
+		if err := s.databaseHandler.UpdateUser(&user); err != nil {
+			return model.ReviewCampaignDTO{}, err
+		}
+		notifyUserChange(UserUpdated, user)
+		for i := range items {
+			items[i].Applied = true
+			if err := s.databaseHandler.UpdateReviewItem(&items[i]); err != nil {
+				return model.ReviewCampaignDTO{}, err
+			}
+		}
+	}
+
+	now := time.Now()
+	campaign.Status = model.CampaignStatusClosed
+	campaign.ClosedAt = &now
+	campaign.ClosedBy = closedBy
+	if err := s.databaseHandler.UpdateCampaign(&campaign); err != nil {
+		return model.ReviewCampaignDTO{}, err
+	}
+	return s.FindCampaign(campaignID, "")
+}
+
+func revokeRoles(applications []model.Application, items []model.ReviewItem) []model.Application {
+	remaining := make([]model.Application, 0, len(applications))
+	for _, application := range applications {
+		roles := make([]string, 0, len(application.Roles))
+		for _, role := range application.Roles {
+			if !isRevoked(application.ApplicationName, role, items) {
+				roles = append(roles, role)
+			}
+		}
+		if len(roles) != 0 {
+			application.Roles = roles
+			remaining = append(remaining, application)
+		}
+	}
+	return remaining
+}
+
+func isRevoked(applicationName, role string, items []model.ReviewItem) bool {
+	for _, item := range items {
+		if item.ApplicationName == applicationName && item.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+func mapCampaignToDTO(campaign model.ReviewCampaign, withItems bool) model.ReviewCampaignDTO {
+	campaignDTO := model.ReviewCampaignDTO{
+		ID:           campaign.ID,
+		Name:         campaign.Name,
+		Applications: campaign.Applications,
+		Reviewers:    campaign.Reviewers,
+		Status:       campaign.Status,
+		CreatedBy:    campaign.CreatedBy,
+		CreatedAt:    campaign.CreatedAt,
+		ClosedAt:     campaign.ClosedAt,
+		ClosedBy:     campaign.ClosedBy,
+	}
+	if !withItems {
+		return campaignDTO
+	}
+	campaignDTO.Items = make([]model.ReviewItemDTO, 0, len(campaign.Items))
+	for _, item := range campaign.Items {
+		campaignDTO.Items = append(campaignDTO.Items, model.ReviewItemDTO{
+			ID:              item.ID,
+			UserID:          item.UserID,
+			UserName:        item.UserName,
+			ApplicationName: item.ApplicationName,
+			Role:            item.Role,
+			Reviewer:        item.Reviewer,
+			Decision:        item.Decision,
+			DecidedBy:       item.DecidedBy,
+			DecidedAt:       item.DecidedAt,
+			Comment:         item.Comment,
+			Applied:         item.Applied,
+		})
+	}
+	return campaignDTO
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"user-service/model"
+
+	"github.com/jinzhu/gorm"
+)
+
+type mockReviewDatabase struct {
+	users    map[uint]model.User
+	campaign model.ReviewCampaign
+}
+
+func (m *mockReviewDatabase) FindByID(id uint) (model.User, error) {
+	user, ok := m.users[id]
+	if !ok {
+		return user, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (m *mockReviewDatabase) UpdateUser(user *model.User) error {
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *mockReviewDatabase) FindUsersFromApplication(applicationName string) ([]model.User, error) {
+	users := make([]model.User, 0)
+	for id := uint(1); id <= uint(len(m.users)); id++ {
+		users = append(users, m.users[id])
+	}
+	return users, nil
+}
+
+func (m *mockReviewDatabase) CreateCampaign(campaign *model.ReviewCampaign) error {
+	campaign.ID = 1
+	for i := range campaign.Items {
+		campaign.Items[i].ID = uint(i + 1)
+	}
+	m.campaign = *campaign
+	return nil
+}
+
+func (m *mockReviewDatabase) FindAllCampaigns() ([]model.ReviewCampaign, error) {
+	return []model.ReviewCampaign{m.campaign}, nil
+}
+
+func (m *mockReviewDatabase) FindCampaignByID(id uint) (model.ReviewCampaign, error) {
+	if id != m.campaign.ID {
+		return model.ReviewCampaign{}, errors.New("not found")
+	}
+	return m.campaign, nil
+}
+
+func (m *mockReviewDatabase) UpdateCampaign(campaign *model.ReviewCampaign) error {
+	items := m.campaign.Items
+	m.campaign = *campaign
+	m.campaign.Items = items
+	return nil
+}
+
+func (m *mockReviewDatabase) UpdateReviewItem(item *model.ReviewItem) error {
+	for i := range m.campaign.Items {
+		if m.campaign.Items[i].ID == item.ID {
+			m.campaign.Items[i] = *item
+		}
+	}
+	return nil
+}
+
+func (m *mockReviewDatabase) IsNotFoundError(err error) bool {
+	return gorm.IsRecordNotFoundError(err)
+}
+
+func newMockReviewService() (ReviewService, *mockReviewDatabase) {
+	database := &mockReviewDatabase{users: map[uint]model.User{
+		1: {Model: gorm.Model{ID: 1}, UserName: "homer", Applications: []model.Application{
+			{ApplicationName: "app", Roles: []string{"user", "admin"}},
+		}},
+		2: {Model: gorm.Model{ID: 2}, UserName: "marge", Applications: []model.Application{
+			{ApplicationName: "app", Roles: []string{"user"}},
+		}},
+	}}
+	return ReviewService{databaseHandler: database}, database
+}
+
+func TestReviewService_StartCampaign(t *testing.T) {
+	service, _ := newMockReviewService()
+
+	campaign, err := service.StartCampaign(model.ReviewCampaignDTO{Name: "Q1", Applications: []string{"app"}, Reviewers: []string{"r1", "r2"}})
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if len(campaign.Items) != 3 {
+		t.Fatalf("expected 3 items but got %d", len(campaign.Items))
+	}
+	if campaign.Items[0].Reviewer != "r1" || campaign.Items[1].Reviewer != "r2" {
+		t.Error("items should be distributed to the reviewers")
+	}
+	for _, item := range campaign.Items {
+		if item.Decision != model.DecisionPending {
+			t.Error("new items should be pending")
+		}
+	}
+}
+
+func TestReviewService_CloseCampaign(t *testing.T) {
+	service, database := newMockReviewService()
+
+	campaign, _ := service.StartCampaign(model.ReviewCampaignDTO{Name: "Q1", Applications: []string{"app"}, Reviewers: []string{"r1"}})
+	for _, item := range campaign.Items {
+		decision := model.DecisionKeep
+		if item.UserName == "homer" && item.Role == "admin" || item.UserName == "marge" {
+			decision = model.DecisionRevoke
+		}
+		if err := service.Decide(campaign.ID, item.ID, model.ReviewDecisionDTO{Reviewer: "r1", Decision: decision}); err != nil {
+			t.Fatal("error should be nil", err)
+		}
+	}
+
+	closed, err := service.CloseCampaign(campaign.ID, "auditor")
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if closed.Status != model.CampaignStatusClosed || closed.ClosedBy != "auditor" {
+		t.Error("campaign should be closed by auditor")
+	}
+	if roles := database.users[1].Applications[0].Roles; len(roles) != 1 || roles[0] != "user" {
+		t.Error("admin role should be revoked", roles)
+	}
+	if len(database.users[2].Applications) != 0 {
+		t.Error("application without roles should be removed")
+	}
+	if err := service.Decide(campaign.ID, 1, model.ReviewDecisionDTO{Reviewer: "r1", Decision: model.DecisionKeep}); err == nil {
+		t.Error("closed campaign should not accept decisions")
+	}
+}
+
+func TestReviewService_Decide_WrongReviewer(t *testing.T) {
+	service, _ := newMockReviewService()
+
+	campaign, _ := service.StartCampaign(model.ReviewCampaignDTO{Name: "Q1", Applications: []string{"app"}, Reviewers: []string{"r1"}})
+	if err := service.Decide(campaign.ID, campaign.Items[0].ID, model.ReviewDecisionDTO{Reviewer: "r2", Decision: model.DecisionKeep}); err == nil {
+		t.Error("only the assigned reviewer should decide")
+	}
+}
@@ -0,0 +1,212 @@
+package manager
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"user-service/adapter"
+	"user-service/model"
+	"user-service/repository"
+)
+
+// Reasons of a logout everywhere besides the user change types
+const (
+	LogoutReasonAdmin       = "admin"
+	LogoutReasonBackChannel = "backchannel"
+)
+
+type SessionDatabaseHandler interface {
+	CreateSessionRevocation(*model.SessionRevocation) error
+	UpdateSessionRevocation(*model.SessionRevocation) error
+	FindSessionRevocations(uint) ([]model.SessionRevocation, error)
+}
+
+// SessionService revokes hydra sessions and tokens, the revocations of a logout everywhere are recorded and retried
+type SessionService struct {
+	HydraAdapter    LoginAdapter
+	databaseHandler SessionDatabaseHandler
+	maxAttempts     int
+	retryWait       time.Duration
+	retries         *sync.WaitGroup
+}
+
+func NewSessionService() SessionService {
+	databaseHandler, err := repository.NewDatabaseHandler()
+	if err != nil {
+		log.Println("could not create new Service due to database initialization")
+		log.Fatal(err)
+	}
+	maxAttempts, err := strconv.Atoi(os.Getenv("LOGOUT_ATTEMPTS"))
+	if err != nil || maxAttempts < 1 {
+		maxAttempts = 5
+	}
+	retryWait, err := time.ParseDuration(os.Getenv("LOGOUT_RETRY_WAIT"))
+	if err != nil {
+		retryWait = 10 * time.Second
+	}
+	return SessionService{
+		HydraAdapter:    newLoginAdapter(),
+		databaseHandler: &databaseHandler,
+		maxAttempts:     maxAttempts,
+		retryWait:       retryWait,
+		retries:         &sync.WaitGroup{},
+	}
+}
+
+// RevokeUserSessions ends all login sessions of the user and revokes all consents including the issued tokens.
+// The login sessions of the remembered consents are ended one by one first, so hydra sends the back-channel logout
+// tokens of these sessions to the clients. Every revocation is recorded, failed ones are retried in the background
+func (s *SessionService) RevokeUserSessions(ctx context.Context, user model.UserDTO, reason string) error {
+	log.Printf("revoking all sessions of user %d: %s", user.ID, reason)
+	revocations, err := s.prepareRevocations(ctx, user, reason)
+	if err != nil {
+		return err
+	}
+	if err := s.revoke(ctx, revocations); err != nil {
+		if s.maxAttempts > 1 {
+			s.retries.Add(1)
+			go s.retry(revocations)
+		}
+		return err
+	}
+	return nil
+}
+
+// FindRevocations returns the recorded revocations of the sessions of a user, newest first
+func (s *SessionService) FindRevocations(userID uint) ([]model.SessionRevocationDTO, error) {
+	revocations, err := s.databaseHandler.FindSessionRevocations(userID)
+	if err != nil {
+		return nil, err
+	}
+	revocationDTOs := make([]model.SessionRevocationDTO, 0, len(revocations))
+	for _, revocation := range revocations {
+		revocationDTOs = append(revocationDTOs, model.SessionRevocationDTO{
+			ID:        revocation.ID,
+			SessionID: revocation.SessionID,
+			Reason:    revocation.Reason,
+			Status:    revocation.Status,
+			Attempts:  revocation.Attempts,
+			LastError: revocation.LastError,
+			CreatedAt: revocation.CreatedAt,
+			RevokedAt: revocation.RevokedAt,
+		})
+	}
+	return revocationDTOs, nil
+}
+
+// prepareRevocations records a revocation for every login session a remembered consent of the user was given in,
+// followed by the revocation of the remaining sessions and consents of each subject
+func (s *SessionService) prepareRevocations(ctx context.Context, user model.UserDTO, reason string) ([]model.SessionRevocation, error) {
+	revocations := make([]model.SessionRevocation, 0)
+	for _, subject := range subjectsOf(user) {
+		consentSessions, err := s.HydraAdapter.ListConsentSessions(ctx, subject)
+		if err != nil {
+			return nil, err
+		}
+		sessionIDs := make([]string, 0, len(consentSessions))
+		for _, consentSession := range consentSessions {
+			if sessionID := consentSession.ConsentRequest.LoginSessionID; sessionID != "" && !contains(sessionIDs, sessionID) {
+				sessionIDs = append(sessionIDs, sessionID)
+			}
+		}
+		for _, sessionID := range append(sessionIDs, "") {
+			revocation := model.SessionRevocation{UserID: user.ID, Subject: subject, SessionID: sessionID, Reason: reason, Status: model.RevocationPending}
+			if err := s.databaseHandler.CreateSessionRevocation(&revocation); err != nil {
+				log.Println(err)
+			}
+			revocations = append(revocations, revocation)
+		}
+	}
+	return revocations, nil
+}
+
+// revoke attempts the pending revocations in order and returns the first error. The revocation of the remaining sessions
+// of the subjects waits while login sessions are retried, as hydra sends no logout tokens for sessions ended with it
+func (s *SessionService) revoke(ctx context.Context, revocations []model.SessionRevocation) error {
+	var firstErr error
+	retrySessions := false
+	for i := range revocations {
+		revocation := &revocations[i]
+		if revocation.Status != model.RevocationPending || (revocation.SessionID == "" && retrySessions) {
+			continue
+		}
+		revocation.Attempts++
+		err := s.revokeOne(ctx, *revocation)
+		if hydraError, ok := adapter.AsHydraError(err); ok && hydraError.IsNotFound() {
+			err = nil
+		}
+		switch {
+		case err == nil:
+			now := time.Now()
+			revocation.Status = model.RevocationRevoked
+			revocation.LastError = ""
+			revocation.RevokedAt = &now
+		case err == adapter.ErrUnsupportedVersion:
+			// hydra v1 ends single sessions only together with all sessions of the subject
+			revocation.Status = model.RevocationUnsupported
+			revocation.LastError = err.Error()
+		default:
+			revocation.LastError = err.Error()
+			if revocation.Attempts >= s.maxAttempts {
+				revocation.Status = model.RevocationFailed
+			} else if revocation.SessionID != "" {
+				retrySessions = true
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if err := s.databaseHandler.UpdateSessionRevocation(revocation); err != nil {
+			log.Println(err)
+		}
+	}
+	return firstErr
+}
+
+func (s *SessionService) revokeOne(ctx context.Context, revocation model.SessionRevocation) error {
+	if revocation.SessionID != "" {
+		return s.HydraAdapter.RevokeLoginSession(ctx, revocation.SessionID)
+	}
+	if err := s.HydraAdapter.RevokeLoginSessions(ctx, revocation.Subject); err != nil {
+		return err
+	}
+	return s.HydraAdapter.RevokeConsentSessions(ctx, revocation.Subject, "")
+}
+
+// retry attempts the pending revocations again with a growing wait until each succeeded or failed maxAttempts times
+func (s *SessionService) retry(revocations []model.SessionRevocation) {
+	defer s.retries.Done()
+	for round := 1; hasPendingRevocations(revocations); round++ {
+		time.Sleep(time.Duration(round) * s.retryWait)
+		if err := s.revoke(context.Background(), revocations); err != nil {
+			log.Printf("retry %d of the session revocations of user %d failed: %v", round, revocations[0].UserID, err)
+		}
+	}
+}
+
+func hasPendingRevocations(revocations []model.SessionRevocation) bool {
+	for _, revocation := range revocations {
+		if revocation.Status == model.RevocationPending {
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeClientTokens revokes all tokens issued to a client
+func (s *SessionService) RevokeClientTokens(ctx context.Context, clientID string) error {
+	return s.HydraAdapter.RevokeClientTokens(ctx, clientID)
+}
+
+// RevokeOnUserChange revokes the sessions of users whose password changed or who were disabled or deleted
+func (s *SessionService) RevokeOnUserChange(change UserChange) {
+	if change.Type != UserPasswordChanged && change.Type != UserDisabled && change.Type != UserDeleted {
+		return
+	}
+	if err := s.RevokeUserSessions(context.Background(), mapUserToDTO(change.User), change.Type); err != nil {
+		log.Printf("could not revoke sessions of user %d after %s: %v", change.User.ID, change.Type, err)
+	}
+}
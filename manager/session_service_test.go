@@ -0,0 +1,140 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"user-service/adapter"
+	"user-service/adapter/fake"
+	"user-service/model"
+)
+
+type mockSessionDatabase struct {
+	mutex       sync.Mutex
+	revocations []model.SessionRevocation
+}
+
+func (m *mockSessionDatabase) CreateSessionRevocation(revocation *model.SessionRevocation) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	revocation.ID = uint(len(m.revocations) + 1)
+	m.revocations = append(m.revocations, *revocation)
+	return nil
+}
+
+func (m *mockSessionDatabase) UpdateSessionRevocation(revocation *model.SessionRevocation) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.revocations[revocation.ID-1] = *revocation
+	return nil
+}
+
+func (m *mockSessionDatabase) FindSessionRevocations(userID uint) ([]model.SessionRevocation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	revocations := make([]model.SessionRevocation, 0, len(m.revocations))
+	for i := len(m.revocations) - 1; i >= 0; i-- {
+		revocations = append(revocations, m.revocations[i])
+	}
+	return revocations, nil
+}
+
+func newTestSessionService(hydraAdapter LoginAdapter) SessionService {
+	return SessionService{HydraAdapter: hydraAdapter, databaseHandler: &mockSessionDatabase{}, maxAttempts: 3, retryWait: time.Millisecond, retries: &sync.WaitGroup{}}
+}
+
+func TestSessionService_LogoutEverywhere(t *testing.T) {
+	hydra := fake.NewHydra()
+	hydra.Version = "v2.2.0"
+	hydraServer := httptest.NewServer(hydra)
+	defer hydraServer.Close()
+	os.Setenv("HYDRA_URL", hydraServer.URL)
+	hydraAdapter := adapter.NewHydraAdapter()
+	for _, consentSession := range []struct{ clientID, sessionID string }{{"app", "session-1"}, {"other", "session-1"}, {"app", "session-2"}} {
+		hydra.AddConsentSession(testSubject, model.ConsentSession{ConsentRequest: model.LoginChallenge{
+			Client: model.Client{ClientID: consentSession.clientID}, LoginSessionID: consentSession.sessionID,
+		}})
+	}
+	service := newTestSessionService(&hydraAdapter)
+
+	user := model.UserDTO{ID: 1, Subject: testSubject, LegacySubjects: []string{"homer"}, UserName: "homer", Email: "homer@springfield.com"}
+	if err := service.RevokeUserSessions(context.Background(), user, LogoutReasonAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	revocations := hydra.Revocations()
+	if len(revocations) != 6 {
+		t.Fatal("consented login sessions and the sessions and consents of subject and legacy subject should be revoked", revocations)
+	}
+	if revocations[0].SessionID != "session-1" || revocations[1].SessionID != "session-2" {
+		t.Error("each login session should be revoked once so hydra sends the back-channel logout tokens", revocations)
+	}
+	if revocations[2] != (fake.Revocation{Kind: "login", Subject: testSubject}) || revocations[3] != (fake.Revocation{Kind: "consent", Subject: testSubject}) {
+		t.Error("remaining sessions and consents of the subject should be revoked", revocations)
+	}
+}
+
+func TestSessionService_RetryRevocations(t *testing.T) {
+	hydra := fake.NewHydra()
+	hydra.Version = "v2.2.0"
+	failures := 1
+	hydraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" && strings.Contains(r.URL.RawQuery, "sid=") && failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		hydra.ServeHTTP(w, r)
+	}))
+	defer hydraServer.Close()
+	os.Setenv("HYDRA_URL", hydraServer.URL)
+	hydraAdapter := adapter.NewHydraAdapter()
+	hydra.AddConsentSession(testSubject, model.ConsentSession{ConsentRequest: model.LoginChallenge{
+		Client: model.Client{ClientID: "app"}, LoginSessionID: "session-1",
+	}})
+	service := newTestSessionService(&hydraAdapter)
+
+	if err := service.RevokeUserSessions(context.Background(), model.UserDTO{ID: 1, Subject: testSubject}, LogoutReasonAdmin); err == nil {
+		t.Fatal("failed revocation should be reported")
+	}
+	service.retries.Wait()
+
+	revocations := hydra.Revocations()
+	if len(revocations) != 3 || revocations[0].SessionID != "session-1" {
+		t.Fatal("login session should be revoked by the retry before the sessions of the subject", revocations)
+	}
+	recorded, _ := service.FindRevocations(1)
+	if len(recorded) != 2 || recorded[1].Attempts != 2 || recorded[1].Status != model.RevocationRevoked || recorded[1].RevokedAt == nil {
+		t.Fatal("retried revocation of the login session should be recorded", recorded)
+	}
+	if recorded[0].Attempts != 1 || recorded[0].Status != model.RevocationRevoked {
+		t.Error("revocation of the subject should wait for the login session and be recorded", recorded)
+	}
+}
+
+func TestSessionService_RevocationsHydraV1(t *testing.T) {
+	hydra := fake.NewHydra()
+	hydraServer := httptest.NewServer(hydra)
+	defer hydraServer.Close()
+	os.Setenv("HYDRA_URL", hydraServer.URL)
+	os.Setenv("HYDRA_VERSION", "v1")
+	defer os.Unsetenv("HYDRA_VERSION")
+	hydraAdapter := adapter.NewHydraAdapter()
+	hydra.AddConsentSession(testSubject, model.ConsentSession{ConsentRequest: model.LoginChallenge{
+		Client: model.Client{ClientID: "app"}, LoginSessionID: "session-1",
+	}})
+	service := newTestSessionService(&hydraAdapter)
+
+	if err := service.RevokeUserSessions(context.Background(), model.UserDTO{ID: 1, Subject: testSubject}, LogoutReasonAdmin); err != nil {
+		t.Fatal(err)
+	}
+	recorded, _ := service.FindRevocations(1)
+	if len(recorded) != 2 || recorded[1].Status != model.RevocationUnsupported || recorded[0].Status != model.RevocationRevoked {
+		t.Error("hydra v1 should only revoke the sessions of the subject", recorded)
+	}
+}
@@ -0,0 +1,30 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+// Subject types of a client, public clients see the subject of the user, pairwise clients a subject of their own
+const (
+	SubjectTypePublic   = "public"
+	SubjectTypePairwise = "pairwise"
+)
+
+var errMissingSubjectSalt = errors.New("SUBJECT_SALT must be set for pairwise subjects")
+
+// pairwiseSubject derives the subject a pairwise client sees from the subject of the user,
+// SUBJECT_SALT keeps the subjects of different installations apart and must not change.
+// Without the salt anybody could compute the subjects, so they are refused
+func pairwiseSubject(subject, clientID string) (string, error) {
+	salt := os.Getenv("SUBJECT_SALT")
+	if salt == "" {
+		return "", errMissingSubjectSalt
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(clientID + ":" + subject))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"os"
+	"testing"
+	"user-service/model"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestConfigService_FetchAcceptLoginConfig_Pairwise(t *testing.T) {
+	service := ConfigService{}
+	subject := testSubject
+	os.Unsetenv("SUBJECT_SALT")
+
+	if acceptLogin, err := service.FetchAcceptLoginConfig(subject, model.ClientSettings{ClientID: "app"}); err != nil || acceptLogin.ForceSubjectIdentifier != "" {
+		t.Error("public clients should see the subject of the user", acceptLogin, err)
+	}
+	if _, err := service.FetchAcceptLoginConfig(subject, model.ClientSettings{ClientID: "app", SubjectType: SubjectTypePairwise}); err != errMissingSubjectSalt {
+		t.Error("pairwise subjects should be refused without SUBJECT_SALT", err)
+	}
+
+	os.Setenv("SUBJECT_SALT", "springfield")
+	defer os.Unsetenv("SUBJECT_SALT")
+	first, _ := service.FetchAcceptLoginConfig(subject, model.ClientSettings{ClientID: "app", SubjectType: SubjectTypePairwise})
+	second, _ := service.FetchAcceptLoginConfig(subject, model.ClientSettings{ClientID: "other", SubjectType: SubjectTypePairwise})
+	if first.Subject != subject || first.ForceSubjectIdentifier == "" || first.ForceSubjectIdentifier == subject {
+		t.Error("pairwise clients should get a subject of their own", first)
+	}
+	if first.ForceSubjectIdentifier == second.ForceSubjectIdentifier {
+		t.Error("pairwise subjects of different clients should differ", first, second)
+	}
+	if again, _ := service.FetchAcceptLoginConfig(subject, model.ClientSettings{ClientID: "app", SubjectType: SubjectTypePairwise}); again.ForceSubjectIdentifier != first.ForceSubjectIdentifier {
+		t.Error("pairwise subjects should be stable", again, first)
+	}
+}
+
+func TestUserService_FindUserBySubject(t *testing.T) {
+	service := UserService{databaseHandler: newMockUserDatabase()}
+
+	if user, err := service.FindUserBySubject(testSubject); err != nil || user.UserName != "homer" {
+		t.Errorf("subject should resolve to homer but got %v %v", user, err)
+	}
+	for _, subject := range []string{"homer", "homer@springfield.com", "unknown"} {
+		if _, err := service.FindUserBySubject(subject); err == nil {
+			t.Errorf("%s should not resolve as subject", subject)
+		}
+	}
+}
+
+func TestUserService_UpdateUser_SubjectAsUserName(t *testing.T) {
+	database := newMockUserDatabase()
+	database.users = append(database.users, model.User{Model: gorm.Model{ID: 2}, Subject: "bart", UserName: "el-barto", Email: "bart@springfield.com"})
+	service := UserService{databaseHandler: database}
+
+	if err := service.UpdateUser(1, model.UserDTO{UserName: "bart"}); err == nil {
+		t.Error("username should not be changed to the subject of another user")
+	}
+	if err := service.CreateUser(model.UserDTO{UserName: "bart", Email: "new@springfield.com", Password: "secret"}); err == nil {
+		t.Error("user should not be created with the subject of another user as username")
+	}
+	if err := service.UpdateUser(2, model.UserDTO{UserName: "bart"}); err != nil {
+		t.Errorf("user should get its own subject back as username but got %v", err)
+	}
+}
+
+func TestSubjectsOf(t *testing.T) {
+	user := model.UserDTO{Subject: testSubject, LegacySubjects: []string{"homer", "homer@springfield.com"}, UserName: "homer-j"}
+	if subjects := subjectsOf(user); len(subjects) != 3 || subjects[0] != testSubject || contains(subjects, "homer-j") {
+		t.Errorf("subject and recorded legacy subjects should be used but got %v", subjects)
+	}
+}
+
+func TestNewSubject(t *testing.T) {
+	first, second := model.NewSubject(), model.NewSubject()
+	if len(first) != 36 || first[14] != '4' || first == second {
+		t.Errorf("subjects should be random uuids but got %s and %s", first, second)
+	}
+}
@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits = 6
+	totpPeriod = 30
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret creates a random base32 encoded secret for authenticator apps
+func newTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// totpURI returns the otpauth uri authenticator apps import the secret from
+func totpURI(issuer, account, secret string) string {
+	query := url.Values{
+		"secret": {secret},
+		"issuer": {issuer},
+		"digits": {fmt.Sprint(totpDigits)},
+		"period": {fmt.Sprint(totpPeriod)},
+	}
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + query.Encode()
+}
+
+// totpCode computes the code of the time step (RFC 6238 with SHA-1)
+func totpCode(secret []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// verifyTOTP accepts the code of the current time step and of its neighbours to tolerate clock drift,
+// it returns the time step of the code
+func verifyTOTP(encodedSecret, code string, now time.Time) (int64, bool) {
+	secret, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(encodedSecret, "=")))
+	if err != nil || len(secret) == 0 {
+		return 0, false
+	}
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	step := now.Unix() / totpPeriod
+	for drift := int64(-1); drift <= 1; drift++ {
+		if hmac.Equal([]byte(totpCode(secret, step+drift)), []byte(code)) {
+			return step + drift, true
+		}
+	}
+	return 0, false
+}
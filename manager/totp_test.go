@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// test vectors of RFC 6238 with SHA-1, truncated to six digits
+	secret := []byte("12345678901234567890")
+	for unix, code := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		if got := totpCode(secret, unix/totpPeriod); got != code {
+			t.Errorf("code at %d should be %s but was %s", unix, code, got)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	valid := func(secret, code string, now time.Time) bool {
+		_, ok := verifyTOTP(secret, code, now)
+		return ok
+	}
+	if step, ok := verifyTOTP(secret, "081804", now); !ok || step != 1111111109/totpPeriod {
+		t.Error("code of the current time step should be valid")
+	}
+	if step, ok := verifyTOTP(secret, "081804", now.Add(totpPeriod*time.Second)); !ok || step != 1111111109/totpPeriod {
+		t.Error("code of the previous time step should be valid and report its time step")
+	}
+	if valid(secret, "081804", now.Add(3*totpPeriod*time.Second)) {
+		t.Error("old codes should be invalid")
+	}
+	if valid(secret, "000000", now) || valid("", "081804", now) || valid(secret, "", now) {
+		t.Error("wrong codes and empty secrets should be invalid")
+	}
+}
@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"sync"
+	"user-service/model"
+)
+
+const (
+	UserCreated             = "created"
+	UserUpdated             = "updated"
+	UserPasswordChanged     = "password_changed"
+	UserSecondFactorChanged = "second_factor_changed"
+	UserDisabled            = "disabled"
+	UserDeleted             = "deleted"
+)
+
+// UserChange describes what happened to a user
+type UserChange struct {
+	Type string
+	User model.User
+}
+
+// UserChangeListener gets called after a user has been created, updated, disabled or deleted
+type UserChangeListener func(change UserChange)
+
+var (
+	userChangeMutex     sync.RWMutex
+	userChangeListeners []UserChangeListener
+)
+
+// OnUserChange registers a listener which is informed about every change of a user
+func OnUserChange(listener UserChangeListener) {
+	userChangeMutex.Lock()
+	defer userChangeMutex.Unlock()
+	userChangeListeners = append(userChangeListeners, listener)
+}
+
+func notifyUserChange(changeType string, user model.User) {
+	userChangeMutex.RLock()
+	defer userChangeMutex.RUnlock()
+	for _, listener := range userChangeListeners {
+		listener(UserChange{Type: changeType, User: user})
+	}
+}
@@ -11,17 +11,29 @@ import (
 )
 
 type UserHandler struct {
-	UserPath         string
-	ApplicationsPath string
-	userService      UserService
+	UserPath          string
+	ApplicationsPath  string
+	userService       UserService
+	sessionService    SessionService
+	deviceService     *TrustedDeviceService
+	federationService FederationService
 }
 
 func NewUserHandler() UserHandler {
+	sessionService := NewSessionService()
+	OnUserChange(sessionService.RevokeOnUserChange)
+	deviceService := NewTrustedDeviceService()
+	OnUserChange(deviceService.RevokeOnUserChange)
+	federationService := NewFederationService()
+	OnUserChange(federationService.UnlinkOnUserChange)
 
 	return UserHandler{
-		UserPath:         "/user/",
-		ApplicationsPath: "/user/application/",
-		userService:      NewUserService(),
+		UserPath:          "/user/",
+		ApplicationsPath:  "/user/application/",
+		userService:       NewUserService(),
+		sessionService:    sessionService,
+		deviceService:     deviceService,
+		federationService: federationService,
 	}
 
 }
@@ -34,6 +46,26 @@ type IUserHandler interface {
 }
 
 func (h *UserHandler) ManageUser(w http.ResponseWriter, r *http.Request) {
+	if parts := strings.Split(strings.Trim(strings.TrimPrefix(html.EscapeString(r.URL.Path), h.UserPath), "/"), "/"); len(parts) == 2 {
+		h.manageUserResource(w, r, parts[0], parts[1])
+		return
+	}
+	if r.Method == "DELETE" {
+		path := html.EscapeString(r.URL.Path)
+		userID, err := strconv.ParseUint(strings.ReplaceAll(path, h.UserPath, ""), 10, 64)
+		if userID == 0 || err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Id of user must be specified and not be null if delete is http Method"))
+			return
+		}
+		if err := h.userService.DeleteUser(uint(userID)); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	if r.Method == "POST" {
 		var userDTO model.UserDTO
 		err := json.NewDecoder(r.Body).Decode(&userDTO)
@@ -129,6 +161,137 @@ func (h *UserHandler) ManageApplications(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// manageUserResource handles PUT /user/{id}/password, DELETE /user/{id}/sessions (log out everywhere),
+// GET /user/{id}/session-revocations, PUT/DELETE /user/{id}/second-factor, GET/DELETE /user/{id}/devices
+// and GET/PUT/DELETE /user/{id}/federated-subjects
+func (h *UserHandler) manageUserResource(w http.ResponseWriter, r *http.Request, id, resource string) {
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if userID == 0 || err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Id of user must be specified"))
+		return
+	}
+
+	if resource == "password" && r.Method == "PUT" {
+		var passwordDTO model.PasswordDTO
+		if err := json.NewDecoder(r.Body).Decode(&passwordDTO); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := h.userService.ChangePassword(uint(userID), passwordDTO.Password); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if resource == "sessions" && r.Method == "DELETE" {
+		user, err := h.userService.FindUser(uint(userID))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := h.sessionService.RevokeUserSessions(r.Context(), user, LogoutReasonAdmin); err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if resource == "session-revocations" && r.Method == "GET" {
+		revocations, err := h.sessionService.FindRevocations(uint(userID))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revocations)
+		return
+	}
+	if resource == "second-factor" && r.Method == "PUT" {
+		secondFactor, err := h.userService.EnableSecondFactor(uint(userID))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(secondFactor)
+		return
+	}
+	if resource == "second-factor" && r.Method == "DELETE" {
+		if err := h.userService.DisableSecondFactor(uint(userID)); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if resource == "devices" && r.Method == "GET" {
+		devices, err := h.deviceService.FindDevices(uint(userID))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(devices)
+		return
+	}
+	if resource == "devices" && r.Method == "DELETE" {
+		deviceID, _ := strconv.ParseUint(r.URL.Query().Get("device"), 10, 64)
+		if err := h.deviceService.Revoke(uint(userID), uint(deviceID)); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if resource == "federated-subjects" && r.Method == "GET" {
+		links, err := h.federationService.FindLinks(uint(userID))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(links)
+		return
+	}
+	if resource == "federated-subjects" && r.Method == "PUT" {
+		var link model.FederatedSubjectDTO
+		if err := json.NewDecoder(r.Body).Decode(&link); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := h.userService.FindUser(uint(userID)); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := h.federationService.Link(uint(userID), link); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if resource == "federated-subjects" && r.Method == "DELETE" {
+		query := r.URL.Query()
+		if err := h.federationService.Unlink(uint(userID), query.Get("issuer"), query.Get("subject")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte("unsupported user request"))
+}
+
 func (h *UserHandler) createUser(userDTO model.UserDTO) error {
 	return h.userService.CreateUser(userDTO)
 }
@@ -3,6 +3,8 @@ package manager
 import (
 	"errors"
 	"log"
+	"os"
+	"time"
 	"user-service/model"
 	"user-service/repository"
 
@@ -11,11 +13,14 @@ import (
 
 type DatabaseHandler interface {
 	FindByUserName(string) (model.User, error)
+	FindBySubject(string) (model.User, error)
 	FindByID(uint) (model.User, error)
 	FindByEmail(string) (model.User, error)
 	FindAllUsers() ([]model.User, error)
-	CreateUser(model.User) (err error)
+	CreateUser(*model.User) (err error)
 	UpdateUser(*model.User) error
+	UpdateTOTPStep(uint, int64) (bool, error)
+	DeleteUser(*model.User) error
 	FindByEmailOrUserName(string) (model.User, error)
 	FindUsersFromApplication(string) ([]model.User, error)
 	IsNotFoundError(error) bool
@@ -81,6 +86,17 @@ func (s *UserService) FindUserByEmailOrUserName(userName string) (model.UserDTO,
 
 }
 
+// FindUserBySubject returns the user of a hydra subject. Subjects are never resolved as user names or emails,
+// which may belong to another user by now
+func (s *UserService) FindUserBySubject(subject string) (model.UserDTO, error) {
+	user, err := s.databaseHandler.FindBySubject(subject)
+	if err != nil {
+		log.Println(err)
+		return model.UserDTO{}, err
+	}
+	return mapUserToDTO(user), nil
+}
+
 func (s *UserService) FindUsersFromApplication(applicationName string) ([]model.UserDTO, error) {
 
 	users, err := s.databaseHandler.FindUsersFromApplication(applicationName)
@@ -93,7 +109,6 @@ func (s *UserService) FindUsersFromApplication(applicationName string) ([]model.
 	}
 
 	return userDTOs, err
-	return []model.UserDTO{}, nil
 }
 
 func mapUserToDTO(user model.User) model.UserDTO {
@@ -102,13 +117,18 @@ func mapUserToDTO(user model.User) model.UserDTO {
 	for _, application := range user.Applications {
 		applicationDTOs = append(applicationDTOs, model.ApplicationRoleDTO{ApplicationName: application.ApplicationName, Roles: application.Roles})
 	}
+	disabled := user.Disabled
 	return model.UserDTO{
-		UserName:     user.UserName,
-		Name:         user.Name,
-		LastName:     user.LastName,
-		Email:        user.Email,
-		ID:           user.ID,
-		Applications: applicationDTOs,
+		Subject:        user.Subject,
+		LegacySubjects: user.LegacySubjects,
+		UserName:       user.UserName,
+		Name:           user.Name,
+		LastName:       user.LastName,
+		Email:          user.Email,
+		ID:             user.ID,
+		Disabled:       &disabled,
+		SecondFactor:   user.TOTPSecret != "",
+		Applications:   applicationDTOs,
 	}
 
 }
@@ -134,6 +154,10 @@ func (s *UserService) CreateUser(userDTO model.UserDTO) (err error) {
 		return errors.New("Username already exists")
 	}
 
+	if _, err := s.databaseHandler.FindBySubject(userDTO.UserName); !s.databaseHandler.IsNotFoundError(err) {
+		return errors.New("Username is the subject of another user")
+	}
+
 	if _, err := s.databaseHandler.FindByEmail(userDTO.Email); !s.databaseHandler.IsNotFoundError(err) {
 		return errors.New("Email already exists")
 	}
@@ -141,6 +165,7 @@ func (s *UserService) CreateUser(userDTO model.UserDTO) (err error) {
 	applications := mapApplicationDTOToEntity(userDTO.Applications)
 
 	user := model.User{
+		Subject:      model.NewSubject(),
 		UserName:     userDTO.UserName,
 		Email:        userDTO.Email,
 		LastName:     userDTO.LastName,
@@ -149,7 +174,10 @@ func (s *UserService) CreateUser(userDTO model.UserDTO) (err error) {
 		Applications: applications,
 	}
 
-	err = s.databaseHandler.CreateUser(user)
+	if err = s.databaseHandler.CreateUser(&user); err != nil {
+		return
+	}
+	notifyUserChange(UserCreated, user)
 	return
 }
 
@@ -165,9 +193,12 @@ func (s *UserService) UpdateUser(userID uint, userDTO model.UserDTO) error {
 	if userDTO.UserName != "" && userDTO.UserName != user.UserName {
 		if _, err := s.databaseHandler.FindByUserName(userDTO.UserName); !s.databaseHandler.IsNotFoundError(err) {
 			return errors.New("Username cannot be changed as there is already a user with this username")
-		} else {
-			user.UserName = userDTO.UserName
 		}
+		// subjects kept from user names must not be taken by other users, services would mix them up
+		if owner, err := s.databaseHandler.FindBySubject(userDTO.UserName); !s.databaseHandler.IsNotFoundError(err) && owner.ID != user.ID {
+			return errors.New("Username cannot be changed as it is the subject of another user")
+		}
+		user.UserName = userDTO.UserName
 	}
 	if userDTO.Email == "-" {
 		return errors.New("Email cannot be deleted")
@@ -193,14 +224,125 @@ func (s *UserService) UpdateUser(userID uint, userDTO model.UserDTO) error {
 			user.Name = userDTO.Name
 		}
 	}
+	changeType := UserUpdated
+	if userDTO.Disabled != nil {
+		if *userDTO.Disabled && !user.Disabled {
+			changeType = UserDisabled
+		}
+		user.Disabled = *userDTO.Disabled
+	}
 	if userDTO.ClearApplications {
 		user.Applications = make([]model.Application, 0)
 	} else if len(userDTO.Applications) != 0 {
 		user.Applications = mapApplicationDTOToEntity(userDTO.Applications)
 	}
 
-	return s.databaseHandler.UpdateUser(&user)
+	if err := s.databaseHandler.UpdateUser(&user); err != nil {
+		return err
+	}
+	notifyUserChange(changeType, user)
+	return nil
+}
+
+// ChangePassword sets a new password for the user
+func (s *UserService) ChangePassword(userID uint, password string) error {
+	if password == "" {
+		return errors.New("Password must not be empty")
+	}
+	user, err := s.databaseHandler.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	bcryptedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println(err)
+		return errors.New("could not create password Hash")
+	}
+	user.Password = bcryptedPassword
+	if err := s.databaseHandler.UpdateUser(&user); err != nil {
+		return err
+	}
+	notifyUserChange(UserPasswordChanged, user)
+	return nil
+}
+
+// EnableSecondFactor creates a new TOTP secret for the user, the secret is only returned once
+func (s *UserService) EnableSecondFactor(userID uint) (model.SecondFactorDTO, error) {
+	user, err := s.databaseHandler.FindByID(userID)
+	if err != nil {
+		return model.SecondFactorDTO{}, err
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		log.Println(err)
+		return model.SecondFactorDTO{}, errors.New("could not create second factor")
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	if err := s.databaseHandler.UpdateUser(&user); err != nil {
+		return model.SecondFactorDTO{}, err
+	}
+	notifyUserChange(UserSecondFactorChanged, user)
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "IdService"
+	}
+	return model.SecondFactorDTO{Secret: secret, URI: totpURI(issuer, user.UserName, secret)}, nil
+}
+
+// DisableSecondFactor removes the TOTP secret of the user
+func (s *UserService) DisableSecondFactor(userID uint) error {
+	user, err := s.databaseHandler.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	if err := s.databaseHandler.UpdateUser(&user); err != nil {
+		return err
+	}
+	notifyUserChange(UserSecondFactorChanged, user)
+	return nil
+}
+
+// VerifySecondFactor checks the code of the authenticator app of the user with the subject,
+// a code is accepted once and codes of older time steps than the last accepted one are rejected
+func (s *UserService) VerifySecondFactor(subject, code string) (bool, error) {
+	user, err := s.databaseHandler.FindBySubject(subject)
+	if err != nil {
+		return false, err
+	}
+	if user.Disabled {
+		return false, errors.New("user is disabled")
+	}
+	if user.TOTPSecret == "" {
+		return false, errors.New("user has no second factor")
+	}
+	step, ok := verifyTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	accepted, err := s.databaseHandler.UpdateTOTPStep(user.ID, step)
+	if err != nil {
+		return false, err
+	}
+	if !accepted {
+		return false, errors.New("code of the second factor was used before")
+	}
+	return true, nil
+}
 
+// DeleteUser removes the user by userID
+func (s *UserService) DeleteUser(userID uint) error {
+	user, err := s.databaseHandler.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.databaseHandler.DeleteUser(&user); err != nil {
+		return err
+	}
+	notifyUserChange(UserDeleted, user)
+	return nil
 }
 
 func mapApplicationDTOToEntity(applicationDTO []model.ApplicationRoleDTO) (applications []model.Application) {
@@ -225,6 +367,9 @@ func (s *UserService) CheckPassword(userName, password string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if user.Disabled {
+		return false, errors.New("user is disabled")
+	}
 
 	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
 		return false, err
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ConsentRevocation records a consent which was revoked at hydra, an empty ClientID means all clients
+type ConsentRevocation struct {
+	gorm.Model
+	UserID    uint
+	Subject   string
+	ClientID  string
+	RevokedBy string
+}
+
+type ConsentDTO struct {
+	ClientID    string   `json:"clientId"`
+	ClientName  string   `json:"clientName"`
+	LogoURI     string   `json:"logoUri,omitempty"`
+	GrantScope  []string `json:"grantScope"`
+	Audience    []string `json:"audience"`
+	Remember    bool     `json:"remember"`
+	RememberFor int      `json:"rememberFor"`
+	GrantedAt   string   `json:"grantedAt"`
+}
+
+// ConsentRevocationDTO is a recorded revocation, an empty ClientID means all clients
+type ConsentRevocationDTO struct {
+	ClientID  string    `json:"clientId"`
+	RevokedBy string    `json:"revokedBy"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+type AccountLoginPage struct {
+	PageTitle        string
+	LoginLabel       string
+	UserNameLabel    string
+	PasswordLabel    string
+	LoginButtonLabel string
+	ErrorMessage     string
+}
+
+type AccountConsentsPage struct {
+	PageTitle           string
+	ConsentsTitle       string
+	UserName            string
+	NoConsentsLabel     string
+	ScopesLabel         string
+	GrantedAtLabel      string
+	RevokeButtonLabel   string
+	RevokeAllLabel      string
+	LogoutLabel         string
+	DevicesLabel        string
+	Consents            []ConsentDTO
+	Message             string
+	RevokedMessage      string
+	LoginFailureMessage string
+}
@@ -0,0 +1,48 @@
+package model
+
+// Authentication context class references reported to the clients, ordered by their assurance level
+const (
+	AcrPassword = "urn:user-service:acr:password"
+	AcrEmail    = "urn:user-service:acr:email"
+	AcrMFA      = "urn:user-service:acr:mfa"
+)
+
+// Authentication method references (RFC 8176)
+const (
+	AmrPassword = "pwd"
+	AmrOTP      = "otp"
+	AmrMFA      = "mfa"
+	// AmrEmail is a login link sent by mail, it is not registered by RFC 8176
+	AmrEmail = "email"
+)
+
+// AcrLevel returns the assurance level of an acr value, unknown values have level 0
+func AcrLevel(acr string) int {
+	switch acr {
+	case AcrPassword, AcrEmail:
+		return 1
+	case AcrMFA:
+		return 2
+	}
+	return 0
+}
+
+// Authentication describes how and when the subject of a browser session logged in
+type Authentication struct {
+	Subject  string   `json:"sub"`
+	AuthTime int64    `json:"auth_time"`
+	Acr      string   `json:"acr"`
+	Amr      []string `json:"amr"`
+}
+
+// SecondFactorDTO is returned once when a second factor is enrolled
+type SecondFactorDTO struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// AssuranceConfig maps scopes and clients to the least acr a login needs before the consent is accepted
+type AssuranceConfig struct {
+	Scopes  map[string]string `json:"scopes"`
+	Clients map[string]string `json:"clients"`
+}
@@ -0,0 +1,28 @@
+package model
+
+// PermissionMapping maps an application to its roles and the permissions derived from each role
+type PermissionMapping map[string]map[string][]string
+
+type AuthzCheck struct {
+	Subject     string `json:"subject"`
+	Application string `json:"application"`
+	Role        string `json:"role,omitempty"`
+	Permission  string `json:"permission,omitempty"`
+}
+
+type AuthzDecision struct {
+	Allowed     bool   `json:"allowed"`
+	Reason      string `json:"reason"`
+	Subject     string `json:"subject"`
+	Application string `json:"application"`
+	Role        string `json:"role,omitempty"`
+	Permission  string `json:"permission,omitempty"`
+}
+
+type AuthzBatchCheck struct {
+	Checks []AuthzCheck `json:"checks"`
+}
+
+type AuthzBatchDecision struct {
+	Decisions []AuthzDecision `json:"decisions"`
+}
@@ -0,0 +1,24 @@
+package model
+
+// Token names of a claim rule
+const (
+	AccessTokenClaims = "access_token"
+	IDTokenClaims     = "id_token"
+)
+
+// ClaimRule maps a user attribute or a fixed value to a token claim.
+// Attribute is one of userName, name, lastName, fullName, email, roles (of the client) or applications (all roles by client).
+// The claim is only added if Scope was granted, Tokens limits it to the access_token or id_token.
+type ClaimRule struct {
+	Claim     string      `json:"claim"`
+	Attribute string      `json:"attribute"`
+	Value     interface{} `json:"value"`
+	Scope     string      `json:"scope"`
+	Tokens    []string    `json:"tokens"`
+}
+
+// ClaimsConfig are the claim rules of all clients, rules of a client replace default rules of the same claim
+type ClaimsConfig struct {
+	Default []ClaimRule            `json:"default"`
+	Clients map[string][]ClaimRule `json:"clients"`
+}
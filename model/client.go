@@ -0,0 +1,28 @@
+package model
+
+import "github.com/jinzhu/gorm"
+
+// ClientSettings are the idprovider specific settings of a hydra client
+type ClientSettings struct {
+	ClientID                          string   `json:"clientId"`
+	RequireMembership                 bool     `json:"requireMembership"`
+	LoginRemember                     bool     `json:"loginRemember"`
+	LoginRememberFor                  int      `json:"loginRememberFor"`
+	ConsentRemember                   bool     `json:"consentRemember"`
+	ConsentRememberFor                int      `json:"consentRememberFor"`
+	SkipConsent                       bool     `json:"skipConsent"`
+	ForceReauthentication             bool     `json:"forceReauthentication"`
+	AllowedScopes                     []string `json:"allowedScopes"`
+	SubjectType                       string   `json:"subjectType"`
+	FrontChannelLogoutURI             string   `json:"frontChannelLogoutUri"`
+	FrontChannelLogoutSessionRequired bool     `json:"frontChannelLogoutSessionRequired"`
+	MagicLinkLogin                    bool     `json:"magicLinkLogin"`
+	Overridden                        bool     `json:"overridden"`
+}
+
+// ClientSettingsOverride stores the settings of a client which were changed through the admin api
+type ClientSettingsOverride struct {
+	gorm.Model
+	ClientID string `gorm:"unique_index"`
+	Settings string `gorm:"type:text"`
+}
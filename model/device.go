@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TrustedDevice is a browser on which the user does not need the second factor until it expires or is revoked,
+// only the hash of the token in the cookie of the browser is stored
+type TrustedDevice struct {
+	gorm.Model
+	UserID     uint
+	TokenHash  string `gorm:"unique_index"`
+	Name       string
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type TrustedDeviceDTO struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+type AccountDevicesPage struct {
+	PageTitle         string
+	DevicesTitle      string
+	UserName          string
+	NoDevicesLabel    string
+	TrustedAtLabel    string
+	ExpiresAtLabel    string
+	LastUsedAtLabel   string
+	RevokeButtonLabel string
+	RevokeAllLabel    string
+	ConsentsLabel     string
+	LogoutLabel       string
+	Devices           []TrustedDeviceDTO
+	Message           string
+	RevokedMessage    string
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FederatedSubject links the subject of a user at an upstream OpenID provider to the local user,
+// logout tokens of the upstream provider are only mapped to users through these links
+type FederatedSubject struct {
+	gorm.Model
+	UserID  uint
+	Issuer  string `gorm:"unique_index:idx_federated_subject"`
+	Subject string `gorm:"unique_index:idx_federated_subject"`
+}
+
+type FederatedSubjectDTO struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+}
@@ -0,0 +1,20 @@
+package model
+
+// RefreshHookRequest is sent by hydra to the refresh token hook before a refresh token is exchanged
+type RefreshHookRequest struct {
+	Subject         string   `json:"subject"`
+	ClientID        string   `json:"client_id"`
+	GrantedScopes   []string `json:"granted_scopes"`
+	GrantedAudience []string `json:"granted_audience"`
+	Requester       struct {
+		ClientID        string   `json:"client_id"`
+		GrantedScopes   []string `json:"granted_scopes"`
+		GrantedAudience []string `json:"granted_audience"`
+		GrantTypes      []string `json:"grant_types"`
+	} `json:"requester"`
+}
+
+// RefreshHookResponse replaces the claims of the refreshed tokens
+type RefreshHookResponse struct {
+	Session SessionInfo `json:"session"`
+}
@@ -8,40 +8,85 @@ type LoginChallenge struct {
 	RequestedScope       []string               `json:"requested_scope"`
 	RequestedAccessToken []string               `json:"requested_access_token_audience"`
 	RpInitiated          bool                   `json:"rp_initiated"`
+	OidcContext          OidcContext            `json:"oidc_context"`
+	Acr                  string                 `json:"acr,omitempty"`
+	Amr                  []string               `json:"amr,omitempty"`
+	DeviceChallengeID    string                 `json:"device_challenge_id,omitempty"`
+	LoginSessionID       string                 `json:"login_session_id,omitempty"`
+	SessionID            string                 `json:"sid,omitempty"`
 	X                    map[string]interface{} `json:"-"`
 }
 
+// OidcContext are the OpenID Connect parameters of the authorization request hydra passes to the login
+type OidcContext struct {
+	AcrValues []string `json:"acr_values,omitempty"`
+	Display   string   `json:"display,omitempty"`
+	LoginHint string   `json:"login_hint,omitempty"`
+	UILocales []string `json:"ui_locales,omitempty"`
+}
+
 type Client struct {
-	ClientID   string `json:"client_id"`
-	ClientName string `json:"client_name"`
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	LogoURI    string   `json:"logo_uri"`
+	PolicyURI  string   `json:"policy_uri"`
+	TosURI     string   `json:"tos_uri"`
+	ClientURI  string   `json:"client_uri"`
+	Contacts   []string `json:"contacts"`
+}
+
+// DisplayName returns the name of the client or its id if no name is registered
+func (c Client) DisplayName() string {
+	if c.ClientName != "" {
+		return c.ClientName
+	}
+	return c.ClientID
 }
 
 type AcceptLogin struct {
-	Subject     string `json:"subject"`
-	Remember    bool   `json:"remember"`
-	RememberFor int16  `json:"remember_for"`
+	Subject                string   `json:"subject"`
+	ForceSubjectIdentifier string   `json:"force_subject_identifier,omitempty"`
+	Remember               bool     `json:"remember"`
+	RememberFor            int      `json:"remember_for"`
+	Acr                    string   `json:"acr,omitempty"`
+	Amr                    []string `json:"amr,omitempty"`
 }
 
 type AcceptConsent struct {
 	GrantScope               []string    `json:"grant_scope"`
 	GrantAccessTokenAudience []string    `json:"grant_access_token_audience"`
 	Remember                 bool        `json:"remember"`
-	RememberFor              int16       `json:"remember_for"`
+	RememberFor              int         `json:"remember_for"`
 	Session                  SessionInfo `json:"session"`
 }
 
+// SessionInfo are the claims hydra adds to the access token and id token
 type SessionInfo struct {
-	AccessToken UserInfoToken `json:"access_token"`
-	IDToken     UserInfoToken `json:"id_token"`
+	AccessToken map[string]interface{} `json:"access_token"`
+	IDToken     map[string]interface{} `json:"id_token"`
+}
+
+// AcceptUserCode is the user code a user entered on the verification page of the device flow
+type AcceptUserCode struct {
+	UserCode string `json:"user_code"`
+}
+
+type RejectRequest struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	StatusCode       int    `json:"status_code,omitempty"`
 }
 
 type Redirect struct {
 	RedirectURL string `json:"redirect_to"`
 }
 
-type UserInfoToken struct {
-	UserName string   `json:"username"`
-	LastName string   `json:"lastname"`
-	EMail    string   `json:"email"`
-	Roles    []string `json:"roles"`
+// ConsentSession is a consent which was remembered by hydra
+type ConsentSession struct {
+	ConsentRequest           LoginChallenge `json:"consent_request"`
+	GrantScope               []string       `json:"grant_scope"`
+	GrantAccessTokenAudience []string       `json:"grant_access_token_audience"`
+	Remember                 bool           `json:"remember"`
+	RememberFor              int            `json:"remember_for"`
+	HandledAt                string         `json:"handled_at"`
 }
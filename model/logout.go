@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	RevocationPending     = "pending"
+	RevocationRevoked     = "revoked"
+	RevocationFailed      = "failed"
+	RevocationUnsupported = "unsupported"
+)
+
+// SessionRevocation records the end of a hydra login session, hydra sends the back-channel logout tokens of the session
+// when it ends. An empty SessionID revokes all remaining sessions and consents of the subject
+type SessionRevocation struct {
+	gorm.Model
+	UserID    uint
+	Subject   string
+	SessionID string
+	Reason    string
+	Status    string
+	Attempts  int
+	LastError string
+	RevokedAt *time.Time
+}
+
+type SessionRevocationDTO struct {
+	ID        uint       `json:"id"`
+	SessionID string     `json:"sessionId,omitempty"`
+	Reason    string     `json:"reason"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"lastError,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
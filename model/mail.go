@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Mail is a plain text message to a user
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// MailConfig are the texts of the mails, bodies are text templates
+type MailConfig struct {
+	MagicLinkSubject string
+	MagicLinkBody    string
+}
+
+// MagicLink is a single-use login link mailed to a user for a login challenge, only the hash of its token is stored
+type MagicLink struct {
+	gorm.Model
+	UserID    uint
+	TokenHash string `gorm:"unique_index"`
+	Challenge string `gorm:"type:text"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -1,5 +1,7 @@
 package model
 
+import "encoding/json"
+
 type LoginPageData struct {
 	PageTitle        string
 	LoginLabel       string
@@ -8,19 +10,69 @@ type LoginPageData struct {
 	LoginButtonLabel string
 	Challenge        string
 	ErrorMessage     string
+	Client           Client
+	PolicyLabel      string
+	TosLabel         string
+	LoginHint        string
+	RememberAllowed  bool
+	RememberLabel    string
+	InfoMessage      string
+
+	MagicLinkAllowed            bool
+	MagicLinkLabel              string
+	MagicLinkEmailLabel         string
+	MagicLinkButtonLabel        string
+	MagicLinkSentMessage        string
+	MagicLinkLimitMessage       string
+	MagicLinkErrorMessage       string
+	MagicLinkToken              string
+	MagicLinkConfirmLabel       string
+	MagicLinkConfirmButtonLabel string
+
+	SecondFactor             bool
+	PendingLogin             string
+	SecondFactorLabel        string
+	SecondFactorMessage      string
+	SecondFactorButtonLabel  string
+	SecondFactorErrorMessage string
+	TrustDeviceDays          int
+	TrustDeviceLabel         string
+
+	DeviceVerification   bool
+	DeviceDone           bool
+	UserCode             string
+	DeviceLabel          string
+	UserCodeLabel        string
+	UserCodeMessage      string
+	UserCodeButtonLabel  string
+	UserCodeErrorMessage string
+	UserCodeLimitMessage string
+	DeviceDoneMessage    string
 }
 
 type ConsentData struct {
-	UserName             string
-	ClientName           string
-	PageTitle            string
-	AuthorizeTitle       string
-	RequestMessage       string
-	ReqestScopes         []ReqestScope
-	AuthorizeButtonLabel string
-	Challenge            string
-	GrantedAccessLabel   string
-	GrantedAccessToken   []ReqestScope
+	Client                Client
+	PolicyLabel           string
+	TosLabel              string
+	ContactsLabel         string
+	PageTitle             string
+	AuthorizeTitle        string
+	RequestMessage        string
+	ReqestScopes          []ReqestScope
+	AuthorizeButtonLabel  string
+	DenyButtonLabel       string
+	Challenge             string
+	GrantedAccessLabel    string
+	GrantedAccessToken    []ReqestScope
+	RequiredScopesLabel   string
+	OptionalScopesLabel   string
+	HasRequiredScopes     bool
+	HasOptionalScopes     bool
+	RolesLabel            string
+	Roles                 []string
+	RequiredScopeMessage  string
+	NothingGrantedMessage string
+	ErrorMessage          string
 }
 
 type ConsentForm struct {
@@ -29,15 +81,51 @@ type ConsentForm struct {
 }
 
 type LogoutPage struct {
-	PageTitle         string
-	LogoutTitle       string
-	LogoutButtonLabel string
-	Challenge         string
-	LogoutDenyLabel   string
-	Subject           string `json:"subject"`
+	PageTitle           string
+	LogoutTitle         string
+	LogoutButtonLabel   string
+	Challenge           string
+	LogoutDenyLabel     string
+	Subject             string `json:"subject"`
+	LoggingOutMessage   string
+	BestEffortMessage   string
+	ContinueLabel       string
+	FrontChannelTimeout int
+	RedirectURL         string
+	FrontChannelClients []FrontChannelClient
+}
+
+// FrontChannelClient is a client whose front-channel logout uri is loaded in an iframe of the logout page
+type FrontChannelClient struct {
+	ClientID string
+	Name     string
+	URI      string
 }
 
 type ReqestScope struct {
-	ScopeName  string
-	ScopeValue string
+	ScopeName   string
+	ScopeValue  string
+	Description string
+	Icon        string
+	Sensitivity string
+	Required    bool
+}
+
+// ErrorPage holds the texts of the error page, Translations override them for other languages
+type ErrorPage struct {
+	PageTitle             string
+	ErrorTitle            string
+	ErrorMessage          string
+	AccessDeniedMessage   string
+	HydraErrorTitle       string
+	ExpiredRequestMessage string
+	UnavailableMessage    string
+	RequestFailedMessage  string
+	InvalidRequestMessage string
+	InternalErrorMessage  string
+	CorrelationIDLabel    string
+	CorrelationID         string
+	ErrorMessages         map[string]string          `json:"ErrorMessages"`
+	DefaultLanguage       string                     `json:"DefaultLanguage"`
+	Translations          map[string]json.RawMessage `json:"Translations"`
 }
@@ -0,0 +1,32 @@
+package model
+
+// AccessPolicy restricts login and consent for clients, every condition which is set must be met
+type AccessPolicy struct {
+	Name             string              `json:"name"`
+	Clients          []string            `json:"clients"`
+	Stages           []string            `json:"stages"`
+	RequireRoles     map[string][]string `json:"requireRoles"`
+	DeniedScopes     []string            `json:"deniedScopes"`
+	AllowedCIDRs     []string            `json:"allowedCidrs"`
+	BusinessHours    *TimeWindow         `json:"businessHours"`
+	ErrorDescription string              `json:"errorDescription"`
+}
+
+// TimeWindow is a daily time range like 08:00 - 18:00 on the given weekdays (Mon, Tue, ...)
+type TimeWindow struct {
+	Days     []string `json:"days"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Location string   `json:"location"`
+}
+
+type PolicyConfig struct {
+	Policies []AccessPolicy `json:"policies"`
+}
+
+// PolicyDecision is the result of evaluating all policies for a request
+type PolicyDecision struct {
+	Allowed          bool
+	Policy           string
+	ErrorDescription string
+}
@@ -0,0 +1,39 @@
+package model
+
+// ProviderConfig configures the embedded OAuth2/OIDC provider of the standalone mode
+type ProviderConfig struct {
+	Issuer               string           `json:"issuer"`
+	LoginURL             string           `json:"loginUrl"`
+	ConsentURL           string           `json:"consentUrl"`
+	LogoutURL            string           `json:"logoutUrl"`
+	AuthCodeLifespan     string           `json:"authCodeLifespan"`
+	AccessTokenLifespan  string           `json:"accessTokenLifespan"`
+	IDTokenLifespan      string           `json:"idTokenLifespan"`
+	RefreshTokenLifespan string           `json:"refreshTokenLifespan"`
+	KeyRotationInterval  string           `json:"keyRotationInterval"`
+	Clients              []ProviderClient `json:"clients"`
+}
+
+// ProviderClient is an OAuth2 client registered at the embedded provider, clients without secret must use PKCE
+type ProviderClient struct {
+	Client
+	ClientSecret           string   `json:"client_secret"`
+	RedirectURIs           []string `json:"redirect_uris"`
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"`
+	Audience               []string `json:"audience"`
+}
+
+// IsPublic is true for clients which cannot keep a secret
+func (c ProviderClient) IsPublic() bool {
+	return c.ClientSecret == ""
+}
+
+// TokenResponse is the response of the token endpoint
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
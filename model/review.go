@@ -0,0 +1,83 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+const (
+	CampaignStatusOpen   = "open"
+	CampaignStatusClosed = "closed"
+
+	DecisionPending = "pending"
+	DecisionKeep    = "keep"
+	DecisionRevoke  = "revoke"
+)
+
+// ReviewCampaign is a snapshot of role assignments which has to be recertified by reviewers
+type ReviewCampaign struct {
+	gorm.Model
+	Name         string
+	Applications pq.StringArray `gorm:"type:varchar(100)[]"`
+	Reviewers    pq.StringArray `gorm:"type:varchar(100)[]"`
+	Status       string
+	CreatedBy    string
+	ClosedAt     *time.Time
+	ClosedBy     string
+	Items        []ReviewItem
+}
+
+// ReviewItem is a single role of a user in an application at the time the campaign was started
+type ReviewItem struct {
+	gorm.Model
+	ReviewCampaignID uint
+	UserID           uint
+	UserName         string
+	ApplicationName  string
+	Role             string
+	Reviewer         string
+	Decision         string
+	DecidedBy        string
+	DecidedAt        *time.Time
+	Comment          string
+	Applied          bool
+}
+
+type ReviewCampaignDTO struct {
+	ID           uint            `json:"id"`
+	Name         string          `json:"name"`
+	Applications []string        `json:"applications"`
+	Reviewers    []string        `json:"reviewers"`
+	Status       string          `json:"status"`
+	CreatedBy    string          `json:"createdBy"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	ClosedAt     *time.Time      `json:"closedAt,omitempty"`
+	ClosedBy     string          `json:"closedBy,omitempty"`
+	Items        []ReviewItemDTO `json:"items,omitempty"`
+}
+
+type ReviewItemDTO struct {
+	ID              uint       `json:"id"`
+	UserID          uint       `json:"userId"`
+	UserName        string     `json:"userName"`
+	ApplicationName string     `json:"applicationName"`
+	Role            string     `json:"role"`
+	Reviewer        string     `json:"reviewer"`
+	Decision        string     `json:"decision"`
+	DecidedBy       string     `json:"decidedBy,omitempty"`
+	DecidedAt       *time.Time `json:"decidedAt,omitempty"`
+	Comment         string     `json:"comment,omitempty"`
+	Applied         bool       `json:"applied"`
+}
+
+type ReviewDecisionDTO struct {
+	Reviewer string `json:"reviewer"`
+	Decision string `json:"decision"`
+	Comment  string `json:"comment"`
+}
+
+type CloseCampaignDTO struct {
+	ClosedBy string `json:"closedBy"`
+}
@@ -0,0 +1,15 @@
+package model
+
+// ScopeDescription describes a scope on the consent page, texts are keyed by language
+type ScopeDescription struct {
+	DisplayName map[string]string `json:"displayName"`
+	Description map[string]string `json:"description"`
+	Icon        string            `json:"icon"`
+	Sensitivity string            `json:"sensitivity"`
+	Required    bool              `json:"required"`
+}
+
+type ScopeCatalog struct {
+	DefaultLanguage string                      `json:"defaultLanguage"`
+	Scopes          map[string]ScopeDescription `json:"scopes"`
+}
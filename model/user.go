@@ -1,18 +1,27 @@
 package model
 
 import (
+	"crypto/rand"
+	"fmt"
+
 	"github.com/jinzhu/gorm"
 	"github.com/lib/pq"
 )
 
 type User struct {
 	gorm.Model
-	UserName     string
-	Password     []byte
-	Name         string
-	LastName     string
-	Email        string
-	Applications []Application
+	Subject string `gorm:"unique_index"`
+	// LegacySubjects are the usernames and emails hydra knew the user by before the subject migration
+	LegacySubjects pq.StringArray `gorm:"type:varchar(255)[]"`
+	UserName       string
+	Password       []byte
+	Name           string
+	LastName       string
+	Email          string
+	Disabled       bool
+	TOTPSecret     string
+	TOTPLastStep   int64
+	Applications   []Application
 }
 
 type Application struct {
@@ -24,16 +33,35 @@ type Application struct {
 
 type UserDTO struct {
 	ID                uint                 `json:"id"`
+	Subject           string               `json:"subject,omitempty"`
+	LegacySubjects    []string             `json:"-"`
 	UserName          string               `json:"userName"`
 	Password          string               `json:"password,omitempty"`
 	Name              string               `json:"name"`
 	LastName          string               `json:"lastName"`
 	Email             string               `json:"eMail"`
+	Disabled          *bool                `json:"disabled,omitempty"`
+	SecondFactor      bool                 `json:"secondFactor"`
 	Applications      []ApplicationRoleDTO `json:"applicationRoleDTO"`
 	ClearApplications bool                 `json:"clearApplications,omitempty"`
 }
 
+// NewSubject creates an opaque random subject identifier (UUID version 4), subjects never change after creation
+func NewSubject() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
 type ApplicationRoleDTO struct {
 	ApplicationName string   `json:"applicationName"`
 	Roles           []string `json:"roles"`
 }
+
+type PasswordDTO struct {
+	Password string `json:"password"`
+}
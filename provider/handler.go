@@ -0,0 +1,624 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"user-service/model"
+)
+
+const (
+	loginSessionCookie = "idp_oidc_session"
+	flowCookie         = "idp_oidc_flow_"
+)
+
+// reservedClaims cannot be overwritten by the claims of the consent session
+var reservedClaims = []string{"iss", "sub", "aud", "exp", "iat", "nbf", "jti", "auth_time", "nonce", "scope", "client_id", "azp"}
+
+// DiscoveryHandler serves the OpenID Connect discovery document
+func (p *Provider) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := p.config.Issuer
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth2/auth",
+		"token_endpoint":                        issuer + "/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"revocation_endpoint":                   issuer + "/oauth2/revoke",
+		"end_session_endpoint":                  issuer + "/oauth2/sessions/logout",
+		"response_types_supported":              []string{"code"},
+		"response_modes_supported":              []string{"query"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "offline_access", "offline", "profile", "email"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_parameter_supported":            false,
+		"request_parameter_supported":           false,
+	})
+}
+
+// JWKSHandler serves the public signing keys
+func (p *Provider) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.keys.publicKeys())
+}
+
+// AuthorizeHandler starts the authorization code flow and continues it after login and consent were accepted
+func (p *Provider) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if verifier := query.Get("login_verifier"); verifier != "" {
+		p.continueWithConsent(w, r, verifier)
+		return
+	}
+	if verifier := query.Get("consent_verifier"); verifier != "" {
+		p.finishAuthorization(w, r, verifier)
+		return
+	}
+
+	client, ok := p.clients[query.Get("client_id")]
+	if !ok {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	redirectURI := query.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !contains(client.RedirectURIs, redirectURI) {
+		http.Error(w, "redirect_uri is not registered for the client", http.StatusBadRequest)
+		return
+	}
+
+	request := authorizeRequest{
+		ClientID:            client.ClientID,
+		RedirectURI:         redirectURI,
+		Scopes:              strings.Fields(query.Get("scope")),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+	redirectError := func(name, description string) {
+		http.Redirect(w, r, redirectWithQuery(redirectURI, request.State, url.Values{"error": {name}, "error_description": {description}}), http.StatusFound)
+	}
+	if query.Get("response_type") != "code" {
+		redirectError("unsupported_response_type", "only the authorization code flow is supported")
+		return
+	}
+	if request.CodeChallenge != "" && request.CodeChallengeMethod != "S256" {
+		redirectError("invalid_request", "code_challenge_method must be S256")
+		return
+	}
+	if request.CodeChallenge == "" && client.IsPublic() {
+		redirectError("invalid_request", "public clients must use PKCE")
+		return
+	}
+
+	p.mutex.Lock()
+	p.cleanup()
+	f := &flow{
+		kind:      "login",
+		challenge: randomToken(32),
+		created:   p.now(),
+		request:   request,
+		csrf:      randomToken(32),
+		body: model.LoginChallenge{
+			Client:               client.Client,
+			RequestURL:           r.URL.String(),
+			RequestedScope:       request.Scopes,
+			RequestedAccessToken: client.Audience,
+			OidcContext: model.OidcContext{
+				AcrValues: strings.Fields(query.Get("acr_values")),
+				Display:   query.Get("display"),
+				LoginHint: query.Get("login_hint"),
+				UILocales: strings.Fields(query.Get("ui_locales")),
+			},
+		},
+	}
+	if sessionID, loginSession, ok := p.readLoginSession(r); ok && query.Get("prompt") != "login" && !exceedsMaxAge(query.Get("max_age"), loginSession.authTime, p.now()) {
+		f.body.Skip = true
+		f.body.Subject = loginSession.subject
+		f.authTime = loginSession.authTime
+		f.sessionID = sessionID
+	}
+	p.flows[f.challenge] = f
+	p.mutex.Unlock()
+
+	p.setFlowCookie(w, f, time.Hour)
+	http.Redirect(w, r, p.config.LoginURL+"?"+url.Values{"login_challenge": {f.challenge}}.Encode(), http.StatusFound)
+}
+
+// continueWithConsent remembers the login and redirects to the consent page
+func (p *Provider) continueWithConsent(w http.ResponseWriter, r *http.Request, verifier string) {
+	p.mutex.Lock()
+	login, ok := p.takeVerifier(r, verifier, "login")
+	if !ok {
+		p.mutex.Unlock()
+		http.Error(w, "invalid login verifier", http.StatusBadRequest)
+		return
+	}
+	if login.remember && login.sessionID == "" {
+		lifetime := time.Duration(login.rememberFor) * time.Second
+		if lifetime == 0 {
+			lifetime = p.refreshTokenLifespan
+		}
+		sessionID := randomToken(32)
+		p.loginSessions[sessionID] = loginSession{subject: login.subject, authTime: login.authTime, expires: p.now().Add(lifetime)}
+		http.SetCookie(w, &http.Cookie{
+			Name:     loginSessionCookie,
+			Value:    sessionID,
+			Path:     "/",
+			Expires:  p.now().Add(lifetime),
+			HttpOnly: true,
+			Secure:   p.secureCookies,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	consent := &flow{
+		kind:         "consent",
+		challenge:    randomToken(32),
+		created:      p.now(),
+		request:      login.request,
+		csrf:         login.csrf,
+		subject:      login.subject,
+		tokenSubject: login.tokenSubject,
+		authTime:     login.authTime,
+		acr:          login.acr,
+		amr:          login.amr,
+		body:         login.body,
+	}
+	consent.body.Subject = login.subject
+	consent.body.Acr = login.acr
+	consent.body.Amr = login.amr
+	consent.body.Skip = p.hasConsent(login.subject, login.request.ClientID, login.request.Scopes)
+	p.flows[consent.challenge] = consent
+	p.mutex.Unlock()
+
+	http.Redirect(w, r, p.config.ConsentURL+"?"+url.Values{"consent_challenge": {consent.challenge}}.Encode(), http.StatusFound)
+}
+
+// finishAuthorization remembers the consent and redirects to the client with an authorization code
+func (p *Provider) finishAuthorization(w http.ResponseWriter, r *http.Request, verifier string) {
+	p.mutex.Lock()
+	consent, ok := p.takeVerifier(r, verifier, "consent")
+	if !ok {
+		p.mutex.Unlock()
+		http.Error(w, "invalid consent verifier", http.StatusBadRequest)
+		return
+	}
+	if consent.remember {
+		p.rememberConsent(consent)
+	}
+	code := randomToken(32)
+	p.codes[code] = &authorization{
+		clientID:     consent.request.ClientID,
+		redirectURI:  consent.request.RedirectURI,
+		subject:      consent.subject,
+		tokenSubject: consent.tokenSubject,
+		scopes:       consent.grantScope,
+		audience:     consent.grantAudience,
+		session:      consent.session,
+		nonce:        consent.request.Nonce,
+		authTime:     consent.authTime,
+		acr:          consent.acr,
+		amr:          consent.amr,
+		challenge:    consent.request.CodeChallenge,
+		method:       consent.request.CodeChallengeMethod,
+		expires:      p.now().Add(p.authCodeLifespan),
+	}
+	p.mutex.Unlock()
+
+	p.setFlowCookie(w, consent, -1)
+	http.Redirect(w, r, redirectWithQuery(consent.request.RedirectURI, consent.request.State, url.Values{"code": {code}}), http.StatusFound)
+}
+
+// TokenHandler exchanges authorization codes and refresh tokens
+func (p *Provider) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeTokenError(w, http.StatusMethodNotAllowed, "invalid_request", "token requests must be POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	client, ok := p.authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		grant, ok := p.codes[code]
+		delete(p.codes, code)
+		if !ok || p.now().After(grant.expires) || grant.clientID != client.ClientID || grant.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "the authorization code is invalid or expired")
+			return
+		}
+		if grant.challenge != "" && !verifyCodeChallenge(grant.challenge, r.PostForm.Get("code_verifier")) {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "the code_verifier does not match the code_challenge")
+			return
+		}
+		p.writeTokens(w, grant)
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		grant, ok := p.refreshTokens[refreshToken]
+		if !ok || p.now().After(grant.expires) || grant.clientID != client.ClientID {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "the refresh token is invalid or expired")
+			return
+		}
+		delete(p.refreshTokens, refreshToken)
+		grant.nonce = ""
+		if p.refreshHook != nil {
+			// the hook reads the current user, the provider is not locked meanwhile
+			hook := p.refreshHook
+			p.mutex.Unlock()
+			refreshed, err := hook(model.RefreshHookRequest{Subject: grant.subject, ClientID: grant.clientID, GrantedScopes: grant.scopes, GrantedAudience: grant.audience})
+			p.mutex.Lock()
+			if err != nil {
+				writeTokenError(w, http.StatusBadRequest, "invalid_grant", "the refresh was denied")
+				return
+			}
+			grant.session = session(refreshed)
+		}
+		p.writeTokens(w, grant)
+	default:
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+}
+
+// writeTokens issues an access token, an id token for the openid scope and a refresh token for the offline scopes
+func (p *Provider) writeTokens(w http.ResponseWriter, grant *authorization) {
+	now := p.now()
+	jti := randomToken(16)
+	subject := grant.subject
+	if grant.tokenSubject != "" {
+		subject = grant.tokenSubject
+	}
+	accessClaims := withoutReserved(grant.session.AccessToken)
+	accessClaims["iss"] = p.config.Issuer
+	accessClaims["sub"] = subject
+	accessClaims["aud"] = append([]string{}, grant.audience...)
+	accessClaims["client_id"] = grant.clientID
+	accessClaims["scope"] = strings.Join(grant.scopes, " ")
+	accessClaims["iat"] = now.Unix()
+	accessClaims["exp"] = now.Add(p.accessTokenLifespan).Unix()
+	accessClaims["jti"] = jti
+	signedAccessToken, err := p.keys.sign(accessClaims)
+	if err != nil {
+		writeTokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	p.accessTokens[jti] = accessToken{
+		subject:      grant.subject,
+		tokenSubject: subject,
+		clientID:     grant.clientID,
+		expires:      now.Add(p.accessTokenLifespan),
+		claims:       withoutReserved(grant.session.IDToken),
+	}
+
+	response := model.TokenResponse{
+		AccessToken: signedAccessToken,
+		TokenType:   "bearer",
+		ExpiresIn:   int(p.accessTokenLifespan.Seconds()),
+		Scope:       strings.Join(grant.scopes, " "),
+	}
+	if contains(grant.scopes, "openid") {
+		idClaims := withoutReserved(grant.session.IDToken)
+		idClaims["iss"] = p.config.Issuer
+		idClaims["sub"] = subject
+		idClaims["aud"] = []string{grant.clientID}
+		idClaims["iat"] = now.Unix()
+		idClaims["exp"] = now.Add(p.idTokenLifespan).Unix()
+		idClaims["auth_time"] = grant.authTime.Unix()
+		if grant.acr != "" {
+			idClaims["acr"] = grant.acr
+		}
+		if len(grant.amr) != 0 {
+			idClaims["amr"] = grant.amr
+		}
+		if grant.nonce != "" {
+			idClaims["nonce"] = grant.nonce
+		}
+		if response.IDToken, err = p.keys.sign(idClaims); err != nil {
+			writeTokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+	}
+	if contains(grant.scopes, "offline") || contains(grant.scopes, "offline_access") {
+		response.RefreshToken = randomToken(32)
+		refresh := *grant
+		refresh.expires = now.Add(p.refreshTokenLifespan)
+		p.refreshTokens[response.RefreshToken] = &refresh
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, response)
+}
+
+// UserInfoHandler returns the id token claims of the user of a bearer access token
+func (p *Provider) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := p.keys.verify(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return
+	}
+	jti, _ := claims["jti"].(string)
+
+	p.mutex.Lock()
+	access, ok := p.accessTokens[jti]
+	p.mutex.Unlock()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_token", "the access token was revoked")
+		return
+	}
+	userInfo := withoutReserved(access.claims)
+	userInfo["sub"] = access.tokenSubject
+	writeJSON(w, http.StatusOK, userInfo)
+}
+
+// RevokeHandler revokes a refresh or access token of the authenticated client
+func (p *Provider) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeTokenError(w, http.StatusMethodNotAllowed, "invalid_request", "revocation requests must be POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	client, ok := p.authenticateClient(r)
+	if !ok {
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	token := r.PostForm.Get("token")
+
+	p.mutex.Lock()
+	if refresh, ok := p.refreshTokens[token]; ok && refresh.clientID == client.ClientID {
+		delete(p.refreshTokens, token)
+	}
+	if claims, err := p.keys.parse(token); err == nil && claims["client_id"] == client.ClientID {
+		jti, _ := claims["jti"].(string)
+		delete(p.accessTokens, jti)
+	}
+	p.mutex.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// LogoutHandler starts a logout at the logout page and ends the login session after it was accepted
+func (p *Provider) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if verifier := query.Get("logout_verifier"); verifier != "" {
+		p.mutex.Lock()
+		logout, ok := p.takeVerifier(r, verifier, "logout")
+		if ok {
+			delete(p.loginSessions, logout.sessionID)
+		}
+		p.mutex.Unlock()
+		if !ok {
+			http.Error(w, "invalid logout verifier", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: loginSessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: p.secureCookies})
+		http.Redirect(w, r, logout.redirect, http.StatusFound)
+		return
+	}
+
+	redirect := p.config.Issuer + "/"
+	if postLogoutRedirectURI := query.Get("post_logout_redirect_uri"); postLogoutRedirectURI != "" {
+		claims, err := p.keys.parse(query.Get("id_token_hint"))
+		if err != nil {
+			http.Error(w, "post_logout_redirect_uri requires a valid id_token_hint", http.StatusBadRequest)
+			return
+		}
+		audience, _ := claims["aud"].([]interface{})
+		allowed := false
+		for _, clientID := range audience {
+			if client, ok := p.clients[clientID.(string)]; ok && contains(client.PostLogoutRedirectURIs, postLogoutRedirectURI) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			http.Error(w, "post_logout_redirect_uri is not registered for the client", http.StatusBadRequest)
+			return
+		}
+		redirect = redirectWithQuery(postLogoutRedirectURI, query.Get("state"), url.Values{})
+	}
+
+	p.mutex.Lock()
+	sessionID, loginSession, ok := p.readLoginSession(r)
+	if !ok {
+		p.mutex.Unlock()
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+	logout := &flow{
+		kind:      "logout",
+		challenge: randomToken(32),
+		created:   p.now(),
+		sessionID: sessionID,
+		redirect:  redirect,
+		body:      model.LoginChallenge{Subject: loginSession.subject, RpInitiated: true, RequestURL: r.URL.String()},
+	}
+	p.flows[logout.challenge] = logout
+	p.mutex.Unlock()
+
+	http.Redirect(w, r, p.config.LogoutURL+"?"+url.Values{"logout_challenge": {logout.challenge}}.Encode(), http.StatusFound)
+}
+
+// authenticateClient authenticates confidential clients by basic auth or form secret and public clients by client_id
+func (p *Provider) authenticateClient(r *http.Request) (model.ProviderClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	client, ok := p.clients[clientID]
+	if !ok {
+		return model.ProviderClient{}, false
+	}
+	if client.IsPublic() {
+		return client, secret == ""
+	}
+	return client, subtle.ConstantTimeCompare([]byte(secret), []byte(client.ClientSecret)) == 1
+}
+
+// takeVerifier returns the accepted flow of a verifier, verifiers can be used once and
+// the verifiers of an authorization only by the browser which started it
+func (p *Provider) takeVerifier(r *http.Request, verifier, kind string) (*flow, bool) {
+	f, ok := p.verifiers[verifier]
+	if !ok || f.kind != kind {
+		return nil, false
+	}
+	if f.csrf != "" {
+		cookie, err := r.Cookie(flowCookieName(f))
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(f.csrf)) != 1 {
+			return nil, false
+		}
+	}
+	delete(p.verifiers, verifier)
+	delete(p.flows, f.challenge)
+	return f, true
+}
+
+// setFlowCookie binds the authorization to the browser, a negative maxAge removes the cookie
+func (p *Provider) setFlowCookie(w http.ResponseWriter, f *flow, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     flowCookieName(f),
+		Value:    f.csrf,
+		Path:     "/oauth2/auth",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   p.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.Value = ""
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// flowCookieName is unique per authorization so several authorizations can run in the same browser
+func flowCookieName(f *flow) string {
+	digest := sha256.Sum256([]byte(f.csrf))
+	return flowCookie + base64.RawURLEncoding.EncodeToString(digest[:9])
+}
+
+func (p *Provider) readLoginSession(r *http.Request) (string, loginSession, bool) {
+	cookie, err := r.Cookie(loginSessionCookie)
+	if err != nil {
+		return "", loginSession{}, false
+	}
+	session, ok := p.loginSessions[cookie.Value]
+	if !ok || p.now().After(session.expires) {
+		return "", loginSession{}, false
+	}
+	return cookie.Value, session, true
+}
+
+func (p *Provider) hasConsent(subject, clientID string, scopes []string) bool {
+	for _, consentSession := range p.consentSessions[subject] {
+		if consentSession.ConsentRequest.Client.ClientID == clientID && !p.isExpired(consentSession) && len(intersect(scopes, consentSession.GrantScope)) == len(scopes) {
+			return true
+		}
+	}
+	return false
+}
+
+// rememberConsent replaces the remembered consent of the client
+func (p *Provider) rememberConsent(consent *flow) {
+	consentSessions := make([]model.ConsentSession, 0, len(p.consentSessions[consent.subject])+1)
+	for _, consentSession := range p.consentSessions[consent.subject] {
+		if consentSession.ConsentRequest.Client.ClientID != consent.request.ClientID {
+			consentSessions = append(consentSessions, consentSession)
+		}
+	}
+	p.consentSessions[consent.subject] = append(consentSessions, model.ConsentSession{
+		ConsentRequest:           consent.body,
+		GrantScope:               consent.grantScope,
+		GrantAccessTokenAudience: consent.grantAudience,
+		Remember:                 true,
+		RememberFor:              consent.rememberFor,
+		HandledAt:                p.now().UTC().Format(time.RFC3339),
+	})
+}
+
+// cleanup drops expired flows, codes, tokens and sessions
+func (p *Provider) cleanup() {
+	now := p.now()
+	for challenge, f := range p.flows {
+		if now.Sub(f.created) > time.Hour {
+			delete(p.flows, challenge)
+			delete(p.verifiers, f.verifier)
+		}
+	}
+	for code, grant := range p.codes {
+		if now.After(grant.expires) {
+			delete(p.codes, code)
+		}
+	}
+	for token, grant := range p.refreshTokens {
+		if now.After(grant.expires) {
+			delete(p.refreshTokens, token)
+		}
+	}
+	for jti, access := range p.accessTokens {
+		if now.After(access.expires) {
+			delete(p.accessTokens, jti)
+		}
+	}
+	for sessionID, session := range p.loginSessions {
+		if now.After(session.expires) {
+			delete(p.loginSessions, sessionID)
+		}
+	}
+}
+
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	digest := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(digest[:])), []byte(challenge)) == 1
+}
+
+func withoutReserved(claims map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(claims)+len(reservedClaims))
+	for name, value := range claims {
+		if !contains(reservedClaims, name) {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeTokenError(w http.ResponseWriter, statusCode int, name, description string) {
+	writeJSON(w, statusCode, map[string]string{"error": name, "error_description": description})
+}
@@ -0,0 +1,302 @@
+package provider
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signingKey is a RSA key of the key set, retired keys stay published until tokens signed by them expired
+type signingKey struct {
+	id         string
+	privateKey *rsa.PrivateKey
+	createdAt  time.Time
+	retiredAt  time.Time
+}
+
+// keySet signs tokens with the newest key and rotates it after the rotation interval
+type keySet struct {
+	mutex            *sync.RWMutex
+	keys             []*signingKey
+	rotationInterval time.Duration
+	maxTokenLifespan time.Duration
+	now              func() time.Time
+}
+
+// JSONWebKey is the public part of a signing key
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// JSONWebKeySet is the response of the jwks endpoint
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func newKeySet(rotationInterval, maxTokenLifespan time.Duration) (*keySet, error) {
+	keys := &keySet{
+		mutex:            &sync.RWMutex{},
+		rotationInterval: rotationInterval,
+		maxTokenLifespan: maxTokenLifespan,
+		now:              time.Now,
+	}
+	if err := keys.rotate(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// rotate creates a new signing key, retires the current one and drops keys no token can be signed with anymore
+func (k *keySet) rotate() error {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	now := k.now()
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	keys := make([]*signingKey, 0, len(k.keys)+1)
+	for _, key := range k.keys {
+		if key.retiredAt.IsZero() {
+			key.retiredAt = now
+		}
+		if now.Sub(key.retiredAt) <= k.maxTokenLifespan {
+			keys = append(keys, key)
+		}
+	}
+	k.keys = append([]*signingKey{{id: randomToken(8), privateKey: privateKey, createdAt: now}}, keys...)
+	return nil
+}
+
+// current returns the signing key and rotates it if it is older than the rotation interval
+func (k *keySet) current() (*signingKey, error) {
+	k.mutex.RLock()
+	key := k.keys[0]
+	k.mutex.RUnlock()
+	if k.rotationInterval > 0 && k.now().Sub(key.createdAt) >= k.rotationInterval {
+		if err := k.rotate(); err != nil {
+			return nil, err
+		}
+		k.mutex.RLock()
+		key = k.keys[0]
+		k.mutex.RUnlock()
+	}
+	return key, nil
+}
+
+// publicKeys returns all published keys
+func (k *keySet) publicKeys() JSONWebKeySet {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	jwks := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(k.keys))}
+	for _, key := range k.keys {
+		publicKey := key.privateKey.PublicKey
+		jwks.Keys = append(jwks.Keys, JSONWebKey{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: "RS256",
+			KeyID:     key.id,
+			Modulus:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		})
+	}
+	return jwks
+}
+
+// sign creates a RS256 JWT of the claims
+func (k *keySet) sign(claims map[string]interface{}) (string, error) {
+	key, err := k.current()
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": key.id})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// verify checks the signature and expiry of a JWT signed by a published key and returns its claims
+func (k *keySet) verify(token string) (map[string]interface{}, error) {
+	claims, err := k.parse(token)
+	if err != nil {
+		return nil, err
+	}
+	expires, ok := claims["exp"].(float64)
+	if !ok || k.now().Unix() >= int64(expires) {
+		return nil, errors.New("token expired")
+	}
+	return claims, nil
+}
+
+// parse checks the signature of a JWT signed by a published key and returns its claims
+func (k *keySet) parse(token string) (map[string]interface{}, error) {
+	return parseJWT(token, func(keyID string) (*rsa.PublicKey, error) {
+		k.mutex.RLock()
+		defer k.mutex.RUnlock()
+		for _, key := range k.keys {
+			if key.id == keyID {
+				return &key.privateKey.PublicKey, nil
+			}
+		}
+		return nil, errors.New("unknown signing key")
+	})
+}
+
+// parseJWT checks the RS256 signature of a JWT with the public key of its kid and returns its claims
+func parseJWT(token string, publicKey func(keyID string) (*rsa.PublicKey, error)) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != "RS256" {
+		return nil, errors.New("unsupported token algorithm")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := publicKey(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// RemoteKeySet verifies tokens of another issuer with the keys published at its jwks uri,
+// the keys are fetched again if a token is signed by an unknown key
+type RemoteKeySet struct {
+	uri        string
+	httpClient *http.Client
+	mutex      *sync.Mutex
+	keys       map[string]*rsa.PublicKey
+	fetchedAt  time.Time
+}
+
+// remoteKeysRefetchWait limits how often unknown keys make the key set fetch the jwks uri
+const remoteKeysRefetchWait = 10 * time.Second
+
+// NewRemoteKeySet creates a key set for the keys published at uri
+func NewRemoteKeySet(uri string) *RemoteKeySet {
+	return &RemoteKeySet{
+		uri:        uri,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		mutex:      &sync.Mutex{},
+		keys:       make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Verify checks the signature of a token and returns its claims, the claims have to be checked by the caller
+func (k *RemoteKeySet) Verify(token string) (map[string]interface{}, error) {
+	return parseJWT(token, k.publicKey)
+}
+
+func (k *RemoteKeySet) publicKey(keyID string) (*rsa.PublicKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if key, ok := k.keys[keyID]; ok {
+		return key, nil
+	}
+	if time.Since(k.fetchedAt) < remoteKeysRefetchWait {
+		return nil, errors.New("unknown signing key")
+	}
+	k.fetchedAt = time.Now()
+	keys, err := k.fetch()
+	if err != nil {
+		return nil, err
+	}
+	k.keys = keys
+	if key, ok := k.keys[keyID]; ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+func (k *RemoteKeySet) fetch() (map[string]*rsa.PublicKey, error) {
+	res, err := k.httpClient.Get(k.uri)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks uri responded with status %d", res.StatusCode)
+	}
+	var jwks JSONWebKeySet
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.Modulus)
+		if err != nil {
+			return nil, err
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.Exponent)
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}
+	}
+	return keys, nil
+}
+
+func randomToken(size int) string {
+	token := make([]byte, size)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
@@ -0,0 +1,444 @@
+// Package provider is an embedded OAuth2/OIDC authorization server for deployments without hydra.
+// It implements the admin api the login and consent handlers use, so the handlers work in both modes.
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"user-service/adapter"
+	"user-service/model"
+)
+
+// authorizeRequest are the parameters of the authorization request of a client
+type authorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	Scopes              []string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// session are the claims the consent added to the tokens
+type session struct {
+	AccessToken map[string]interface{} `json:"access_token"`
+	IDToken     map[string]interface{} `json:"id_token"`
+}
+
+// flow is a login, consent or logout request of the authorization flow
+type flow struct {
+	kind      string
+	challenge string
+	created   time.Time
+	verifier  string
+	request   authorizeRequest
+	body      model.LoginChallenge
+	handled   bool
+	redirect  string
+	csrf      string
+
+	subject      string
+	tokenSubject string
+	remember     bool
+	rememberFor  int
+	authTime     time.Time
+	acr          string
+	amr          []string
+	sessionID    string
+
+	grantScope    []string
+	grantAudience []string
+	session       session
+}
+
+// authorization is the grant of an authorization code or refresh token
+type authorization struct {
+	clientID     string
+	redirectURI  string
+	subject      string
+	tokenSubject string
+	scopes       []string
+	audience     []string
+	session      session
+	nonce        string
+	authTime     time.Time
+	acr          string
+	amr          []string
+	challenge    string
+	method       string
+	expires      time.Time
+}
+
+type loginSession struct {
+	subject  string
+	authTime time.Time
+	expires  time.Time
+}
+
+type accessToken struct {
+	subject      string
+	tokenSubject string
+	clientID     string
+	expires      time.Time
+	claims       map[string]interface{}
+}
+
+// RefreshHook recomputes the claims of a refreshed grant like the refresh token hook of hydra, an error denies the refresh
+type RefreshHook func(request model.RefreshHookRequest) (model.SessionInfo, error)
+
+// Provider holds the state of the embedded authorization server in memory
+type Provider struct {
+	config               model.ProviderConfig
+	clients              map[string]model.ProviderClient
+	authCodeLifespan     time.Duration
+	accessTokenLifespan  time.Duration
+	idTokenLifespan      time.Duration
+	refreshTokenLifespan time.Duration
+	keys                 *keySet
+	secureCookies        bool
+	now                  func() time.Time
+	refreshHook          RefreshHook
+
+	mutex           *sync.Mutex
+	flows           map[string]*flow
+	verifiers       map[string]*flow
+	loginSessions   map[string]loginSession
+	consentSessions map[string][]model.ConsentSession
+	codes           map[string]*authorization
+	refreshTokens   map[string]*authorization
+	accessTokens    map[string]accessToken
+}
+
+var (
+	defaultProvider     *Provider
+	defaultProviderOnce sync.Once
+)
+
+// IsStandalone is true if PROVIDER_MODE selects the embedded provider instead of hydra
+func IsStandalone() bool {
+	return strings.EqualFold(os.Getenv("PROVIDER_MODE"), "standalone")
+}
+
+// Default returns the provider configured by config/provider_config.json, it is shared by all services and handlers
+func Default() *Provider {
+	defaultProviderOnce.Do(func() {
+		pwd, err := os.Getwd()
+		if pwd == "/" {
+			pwd = ""
+		}
+		var config model.ProviderConfig
+		configFile, err := os.Open(pwd + "/config/provider_config.json")
+		if err != nil {
+			log.Println(err)
+		} else {
+			if err = json.NewDecoder(configFile).Decode(&config); err != nil {
+				log.Println(err)
+			}
+			configFile.Close()
+		}
+		defaultProvider, err = NewProvider(config)
+		if err != nil {
+			log.Print("Could not create provider")
+			log.Fatal(err)
+		}
+	})
+	return defaultProvider
+}
+
+// SetRefreshHook lets the refresh token grant recompute the claims instead of reusing the claims of the consent
+func (p *Provider) SetRefreshHook(hook RefreshHook) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.refreshHook = hook
+}
+
+// NewProvider creates a provider with a new signing key
+func NewProvider(config model.ProviderConfig) (*Provider, error) {
+	if config.Issuer == "" {
+		config.Issuer = "http://127.0.0.1:3000"
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if config.LoginURL == "" {
+		config.LoginURL = config.Issuer + "/login"
+	}
+	if config.ConsentURL == "" {
+		config.ConsentURL = config.Issuer + "/consent"
+	}
+	if config.LogoutURL == "" {
+		config.LogoutURL = config.Issuer + "/logout"
+	}
+
+	provider := &Provider{
+		config:               config,
+		clients:              make(map[string]model.ProviderClient, len(config.Clients)),
+		authCodeLifespan:     parseDuration(config.AuthCodeLifespan, 10*time.Minute),
+		accessTokenLifespan:  parseDuration(config.AccessTokenLifespan, time.Hour),
+		idTokenLifespan:      parseDuration(config.IDTokenLifespan, time.Hour),
+		refreshTokenLifespan: parseDuration(config.RefreshTokenLifespan, 720*time.Hour),
+		secureCookies:        strings.HasPrefix(config.Issuer, "https://"),
+		now:                  time.Now,
+		mutex:                &sync.Mutex{},
+		flows:                make(map[string]*flow),
+		verifiers:            make(map[string]*flow),
+		loginSessions:        make(map[string]loginSession),
+		consentSessions:      make(map[string][]model.ConsentSession),
+		codes:                make(map[string]*authorization),
+		refreshTokens:        make(map[string]*authorization),
+		accessTokens:         make(map[string]accessToken),
+	}
+	for _, client := range config.Clients {
+		provider.clients[client.ClientID] = client
+	}
+
+	maxTokenLifespan := provider.accessTokenLifespan
+	if provider.idTokenLifespan > maxTokenLifespan {
+		maxTokenLifespan = provider.idTokenLifespan
+	}
+	keys, err := newKeySet(parseDuration(config.KeyRotationInterval, 720*time.Hour), maxTokenLifespan)
+	if err != nil {
+		return nil, err
+	}
+	provider.keys = keys
+	return provider, nil
+}
+
+func parseDuration(value string, defaultValue time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue
+	}
+	return duration
+}
+
+// ReadChallenge returns the login, consent or logout request of a challenge
+func (p *Provider) ReadChallenge(ctx context.Context, challenge, challengeMethod string) (model.LoginChallenge, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	f, err := p.findFlow(challenge, challengeMethod)
+	if err != nil {
+		return model.LoginChallenge{}, err
+	}
+	return f.body, nil
+}
+
+// SendAcceptBody accepts a login, consent or logout request and returns the url the browser continues with
+func (p *Provider) SendAcceptBody(ctx context.Context, method, challenge string, rawJson []byte) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	f, err := p.findFlow(challenge, method)
+	if err != nil {
+		return "", err
+	}
+	if f.handled {
+		return "", &adapter.HydraError{StatusCode: 410, Name: "request_was_handled", Description: "The request was already handled"}
+	}
+
+	switch method {
+	case "login":
+		var acceptLogin model.AcceptLogin
+		if len(rawJson) != 0 {
+			if err := json.Unmarshal(rawJson, &acceptLogin); err != nil {
+				return "", &adapter.HydraError{StatusCode: 400, Name: "invalid_request", Description: err.Error()}
+			}
+		}
+		if acceptLogin.Subject == "" {
+			return "", &adapter.HydraError{StatusCode: 400, Name: "invalid_request", Description: "subject must be specified"}
+		}
+		if f.body.Skip && acceptLogin.Subject != f.body.Subject {
+			return "", &adapter.HydraError{StatusCode: 400, Name: "invalid_request", Description: "subject of a skipped login cannot be changed"}
+		}
+		f.subject = acceptLogin.Subject
+		f.tokenSubject = acceptLogin.ForceSubjectIdentifier
+		f.remember = acceptLogin.Remember
+		f.rememberFor = acceptLogin.RememberFor
+		f.acr = acceptLogin.Acr
+		f.amr = acceptLogin.Amr
+		if f.authTime.IsZero() {
+			f.authTime = p.now()
+		}
+	case "consent":
+		var acceptConsent struct {
+			GrantScope               []string `json:"grant_scope"`
+			GrantAccessTokenAudience []string `json:"grant_access_token_audience"`
+			Remember                 bool     `json:"remember"`
+			RememberFor              int      `json:"remember_for"`
+			Session                  session  `json:"session"`
+		}
+		if err := json.Unmarshal(rawJson, &acceptConsent); err != nil {
+			return "", &adapter.HydraError{StatusCode: 400, Name: "invalid_request", Description: err.Error()}
+		}
+		f.grantScope = intersect(acceptConsent.GrantScope, f.request.Scopes)
+		f.grantAudience = acceptConsent.GrantAccessTokenAudience
+		f.remember = acceptConsent.Remember
+		f.rememberFor = acceptConsent.RememberFor
+		f.session = acceptConsent.Session
+	}
+	f.handled = true
+	f.verifier = randomToken(32)
+	p.verifiers[f.verifier] = f
+	return p.verifierURL(f), nil
+}
+
+// SendRejectBody rejects a login, consent or logout request and returns the url the browser continues with
+func (p *Provider) SendRejectBody(ctx context.Context, method, challenge string, rawJson []byte) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	f, err := p.findFlow(challenge, method)
+	if err != nil {
+		return "", err
+	}
+	if f.handled {
+		return "", &adapter.HydraError{StatusCode: 410, Name: "request_was_handled", Description: "The request was already handled"}
+	}
+	f.handled = true
+	delete(p.flows, challenge)
+
+	if method == "logout" {
+		return p.config.Issuer + "/", nil
+	}
+	reject := model.RejectRequest{Error: "access_denied"}
+	if len(rawJson) != 0 {
+		json.Unmarshal(rawJson, &reject)
+	}
+	query := url.Values{"error": {reject.Error}}
+	if reject.ErrorDescription != "" {
+		query.Set("error_description", reject.ErrorDescription)
+	}
+	return redirectWithQuery(f.request.RedirectURI, f.request.State, query), nil
+}
+
+// ListConsentSessions returns the remembered consents of a subject
+func (p *Provider) ListConsentSessions(ctx context.Context, subject string) ([]model.ConsentSession, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	consentSessions := make([]model.ConsentSession, 0, len(p.consentSessions[subject]))
+	for _, consentSession := range p.consentSessions[subject] {
+		if !p.isExpired(consentSession) {
+			consentSessions = append(consentSessions, consentSession)
+		}
+	}
+	return consentSessions, nil
+}
+
+// RevokeConsentSessions removes the remembered consents and revokes the tokens of the subject for one or all clients
+func (p *Provider) RevokeConsentSessions(ctx context.Context, subject, clientID string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	kept := make([]model.ConsentSession, 0)
+	for _, consentSession := range p.consentSessions[subject] {
+		if clientID != "" && consentSession.ConsentRequest.Client.ClientID != clientID {
+			kept = append(kept, consentSession)
+		}
+	}
+	p.consentSessions[subject] = kept
+	p.revokeTokens(func(s, c string) bool { return s == subject && (clientID == "" || c == clientID) })
+	return nil
+}
+
+// RevokeLoginSessions ends all login sessions of the subject
+func (p *Provider) RevokeLoginSessions(ctx context.Context, subject string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for sessionID, loginSession := range p.loginSessions {
+		if loginSession.subject == subject {
+			delete(p.loginSessions, sessionID)
+		}
+	}
+	return nil
+}
+
+// RevokeLoginSession ends one login session
+func (p *Provider) RevokeLoginSession(ctx context.Context, sessionID string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.loginSessions, sessionID)
+	return nil
+}
+
+// RevokeClientTokens revokes all access and refresh tokens issued to a client
+func (p *Provider) RevokeClientTokens(ctx context.Context, clientID string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.revokeTokens(func(s, c string) bool { return c == clientID })
+	return nil
+}
+
+func (p *Provider) revokeTokens(matches func(subject, clientID string) bool) {
+	for token, refresh := range p.refreshTokens {
+		if matches(refresh.subject, refresh.clientID) {
+			delete(p.refreshTokens, token)
+		}
+	}
+	for id, access := range p.accessTokens {
+		if matches(access.subject, access.clientID) {
+			delete(p.accessTokens, id)
+		}
+	}
+}
+
+func (p *Provider) findFlow(challenge, kind string) (*flow, error) {
+	f, ok := p.flows[challenge]
+	if !ok || f.kind != kind {
+		return nil, &adapter.HydraError{StatusCode: 404, Name: "Not Found", Description: "Unable to locate the resource"}
+	}
+	return f, nil
+}
+
+func (p *Provider) verifierURL(f *flow) string {
+	if f.kind == "logout" {
+		return p.config.Issuer + "/oauth2/sessions/logout?" + url.Values{"logout_verifier": {f.verifier}}.Encode()
+	}
+	return p.config.Issuer + "/oauth2/auth?" + url.Values{f.kind + "_verifier": {f.verifier}}.Encode()
+}
+
+func (p *Provider) isExpired(consentSession model.ConsentSession) bool {
+	if consentSession.RememberFor == 0 {
+		return false
+	}
+	handledAt, err := time.Parse(time.RFC3339, consentSession.HandledAt)
+	return err == nil && p.now().After(handledAt.Add(time.Duration(consentSession.RememberFor)*time.Second))
+}
+
+// exceedsMaxAge is true if the client sent max_age and the login is older
+func exceedsMaxAge(maxAge string, authTime, now time.Time) bool {
+	seconds, err := strconv.Atoi(maxAge)
+	return err == nil && seconds >= 0 && now.Sub(authTime) > time.Duration(seconds)*time.Second
+}
+
+func redirectWithQuery(redirectURI, state string, query url.Values) string {
+	if state != "" {
+		query.Set("state", state)
+	}
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	return redirectURI + separator + query.Encode()
+}
+
+func intersect(values, allowed []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if contains(allowed, value) && !contains(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"user-service/adapter"
+	"user-service/model"
+)
+
+const (
+	testRedirectURI  = "http://app/callback"
+	testCodeVerifier = "dBjftJeZ4CK-mB7OQpnIMtmRTMcOLmjZhSxBtzqvK8A"
+)
+
+func newTestProvider(t *testing.T) *Provider {
+	p, err := NewProvider(model.ProviderConfig{
+		Issuer: "http://idp",
+		Clients: []model.ProviderClient{
+			{Client: model.Client{ClientID: "spa"}, RedirectURIs: []string{testRedirectURI}},
+			{Client: model.Client{ClientID: "web"}, ClientSecret: "secret", RedirectURIs: []string{testRedirectURI}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func get(handler http.HandlerFunc, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func postToken(p *Provider, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	p.TokenHandler(rec, req)
+	return rec
+}
+
+func location(t *testing.T, rec *httptest.ResponseRecorder) *url.URL {
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected a redirect but got %d: %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// authorize runs the authorization flow of the spa client for homer and returns the code and the login session cookie
+func authorize(t *testing.T, p *Provider, cookies ...*http.Cookie) (string, []*http.Cookie) {
+	digest := sha256.Sum256([]byte(testCodeVerifier))
+	rec := get(p.AuthorizeHandler, "/oauth2/auth?"+url.Values{
+		"client_id":             {"spa"},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"openid offline_access profile"},
+		"state":                 {"state-123"},
+		"nonce":                 {"nonce-123"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(digest[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode(), cookies...)
+	loginChallenge := location(t, rec).Query().Get("login_challenge")
+	flowCookies := rec.Result().Cookies()
+
+	ctx := context.Background()
+	loginRequest, err := p.ReadChallenge(ctx, loginChallenge, "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loginRequest.Client.ClientID != "spa" {
+		t.Errorf("login request has client %q", loginRequest.Client.ClientID)
+	}
+	redirect, err := p.SendAcceptBody(ctx, "login", loginChallenge, []byte(`{"subject":"homer","remember":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = get(p.AuthorizeHandler, redirect, flowCookies...)
+	consentChallenge := location(t, rec).Query().Get("consent_challenge")
+	redirect, err = p.SendAcceptBody(ctx, "consent", consentChallenge, []byte(`{
+		"grant_scope": ["openid", "offline_access", "profile", "admin"],
+		"remember": true,
+		"session": {"id_token": {"name": "Homer Simpson", "sub": "bart"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := location(t, get(p.AuthorizeHandler, redirect, append(flowCookies, rec.Result().Cookies()...)...))
+	if callback.Query().Get("state") != "state-123" {
+		t.Errorf("state was not returned: %s", callback)
+	}
+	return callback.Query().Get("code"), rec.Result().Cookies()
+}
+
+func TestProvider_AuthorizationCodeFlow(t *testing.T) {
+	p := newTestProvider(t)
+	code, _ := authorize(t, p)
+
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {testRedirectURI}, "client_id": {"spa"}}
+	if rec := postToken(p, form); rec.Code != http.StatusBadRequest {
+		t.Fatalf("exchange without code_verifier should fail but got %d", rec.Code)
+	}
+
+	code, _ = authorize(t, p)
+	form.Set("code", code)
+	form.Set("code_verifier", testCodeVerifier)
+	rec := postToken(p, form)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("token exchange failed with %d: %s", rec.Code, rec.Body.String())
+	}
+	var tokens model.TokenResponse
+	json.NewDecoder(rec.Body).Decode(&tokens)
+	if tokens.Scope != "openid offline_access profile" {
+		t.Errorf("granted scope should be limited to the requested scopes but is %q", tokens.Scope)
+	}
+
+	idClaims, err := p.keys.verify(tokens.IDToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idClaims["sub"] != "homer" || idClaims["nonce"] != "nonce-123" || idClaims["name"] != "Homer Simpson" {
+		t.Errorf("unexpected id token claims %v", idClaims)
+	}
+	if rec := postToken(p, form); rec.Code != http.StatusBadRequest {
+		t.Errorf("codes should be usable once but got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	userInfo := httptest.NewRecorder()
+	p.UserInfoHandler(userInfo, req)
+	if userInfo.Code != http.StatusOK || !strings.Contains(userInfo.Body.String(), "Homer Simpson") {
+		t.Errorf("userinfo returned %d: %s", userInfo.Code, userInfo.Body.String())
+	}
+
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}, "client_id": {"spa"}}
+	rec = postToken(p, refresh)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh failed with %d: %s", rec.Code, rec.Body.String())
+	}
+	var refreshed model.TokenResponse
+	json.NewDecoder(rec.Body).Decode(&refreshed)
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Error("refresh tokens should be rotated")
+	}
+	if rec := postToken(p, refresh); rec.Code != http.StatusBadRequest {
+		t.Errorf("rotated refresh token should be invalid but got %d", rec.Code)
+	}
+
+	if err := p.RevokeConsentSessions(context.Background(), "homer", "spa"); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshed.AccessToken)
+	userInfo = httptest.NewRecorder()
+	p.UserInfoHandler(userInfo, req)
+	if userInfo.Code != http.StatusUnauthorized {
+		t.Errorf("revoked access token should be rejected but got %d", userInfo.Code)
+	}
+}
+
+func TestProvider_RefreshHook(t *testing.T) {
+	p := newTestProvider(t)
+	code, _ := authorize(t, p)
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {testRedirectURI}, "client_id": {"spa"}, "code_verifier": {testCodeVerifier}}
+	var tokens model.TokenResponse
+	json.NewDecoder(postToken(p, form).Body).Decode(&tokens)
+
+	var hookRequest model.RefreshHookRequest
+	p.SetRefreshHook(func(request model.RefreshHookRequest) (model.SessionInfo, error) {
+		hookRequest = request
+		return model.SessionInfo{IDToken: map[string]interface{}{"name": "Homer J. Simpson"}}, nil
+	})
+	rec := postToken(p, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}, "client_id": {"spa"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh failed with %d: %s", rec.Code, rec.Body.String())
+	}
+	if hookRequest.Subject != "homer" || hookRequest.ClientID != "spa" {
+		t.Errorf("hook should get the subject and client of the grant but got %+v", hookRequest)
+	}
+	var refreshed model.TokenResponse
+	json.NewDecoder(rec.Body).Decode(&refreshed)
+	idClaims, err := p.keys.verify(refreshed.IDToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idClaims["name"] != "Homer J. Simpson" {
+		t.Errorf("refreshed id token should have the claims of the hook but got %v", idClaims)
+	}
+
+	p.SetRefreshHook(func(request model.RefreshHookRequest) (model.SessionInfo, error) {
+		return model.SessionInfo{}, errors.New("user is disabled")
+	})
+	if rec := postToken(p, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshed.RefreshToken}, "client_id": {"spa"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("refresh denied by the hook should fail but got %d", rec.Code)
+	}
+}
+
+func TestProvider_RememberedLoginAndConsent(t *testing.T) {
+	p := newTestProvider(t)
+	_, cookies := authorize(t, p)
+
+	rec := get(p.AuthorizeHandler, "/oauth2/auth?client_id=web&response_type=code&scope=openid", cookies...)
+	loginChallenge := location(t, rec).Query().Get("login_challenge")
+	loginRequest, err := p.ReadChallenge(context.Background(), loginChallenge, "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loginRequest.Skip || loginRequest.Subject != "homer" {
+		t.Errorf("login should be skipped for the remembered session but got %+v", loginRequest)
+	}
+
+	consentSessions, err := p.ListConsentSessions(context.Background(), "homer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consentSessions) != 1 || consentSessions[0].ConsentRequest.Client.ClientID != "spa" {
+		t.Errorf("expected the remembered consent of spa but got %+v", consentSessions)
+	}
+}
+
+func TestProvider_AuthorizeErrors(t *testing.T) {
+	p := newTestProvider(t)
+
+	if rec := get(p.AuthorizeHandler, "/oauth2/auth?client_id=unknown&response_type=code"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown client should fail but got %d", rec.Code)
+	}
+	if rec := get(p.AuthorizeHandler, "/oauth2/auth?client_id=web&response_type=code&redirect_uri=http://evil/"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unregistered redirect uri should fail but got %d", rec.Code)
+	}
+	callback := location(t, get(p.AuthorizeHandler, "/oauth2/auth?client_id=spa&response_type=code&state=s"))
+	if callback.Query().Get("error") != "invalid_request" || callback.Query().Get("state") != "s" {
+		t.Errorf("public client without pkce should be redirected with an error but got %s", callback)
+	}
+
+	_, err := p.ReadChallenge(context.Background(), "unknown", "login")
+	if hydraErr, ok := adapter.AsHydraError(err); !ok || !hydraErr.IsNotFound() {
+		t.Errorf("unknown challenge should be not found but got %v", err)
+	}
+}
+
+func TestProvider_VerifierBoundToBrowser(t *testing.T) {
+	p := newTestProvider(t)
+	rec := get(p.AuthorizeHandler, "/oauth2/auth?client_id=web&response_type=code&scope=openid")
+	loginChallenge := location(t, rec).Query().Get("login_challenge")
+	redirect, err := p.SendAcceptBody(context.Background(), "login", loginChallenge, []byte(`{"subject":"homer"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &http.Cookie{Name: rec.Result().Cookies()[0].Name, Value: "other-browser"}
+	if rec := get(p.AuthorizeHandler, redirect, other); rec.Code != http.StatusBadRequest {
+		t.Errorf("login verifier should be rejected in another browser but got %d", rec.Code)
+	}
+	if rec := get(p.AuthorizeHandler, redirect, rec.Result().Cookies()...); rec.Code != http.StatusFound {
+		t.Errorf("login verifier should be accepted in the browser which started the flow but got %d", rec.Code)
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	p := newTestProvider(t)
+	token, err := p.keys.sign(map[string]interface{}{"sub": "homer", "exp": p.now().Unix() + 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.keys.rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := get(p.JWKSHandler, "/.well-known/jwks.json")
+	var jwks JSONWebKeySet
+	json.NewDecoder(rec.Body).Decode(&jwks)
+	if len(jwks.Keys) != 2 {
+		t.Errorf("retired key should stay published but got %d keys", len(jwks.Keys))
+	}
+	if _, err := p.keys.verify(token); err != nil {
+		t.Errorf("token of the retired key should still verify: %v", err)
+	}
+}
+
+func TestRemoteKeySet_Verify(t *testing.T) {
+	p := newTestProvider(t)
+	srv := httptest.NewServer(http.HandlerFunc(p.JWKSHandler))
+	defer srv.Close()
+	remote := NewRemoteKeySet(srv.URL)
+
+	token, err := p.keys.sign(map[string]interface{}{"sub": "homer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := remote.Verify(token); err != nil || claims["sub"] != "homer" {
+		t.Errorf("token should verify with the published key: %v %v", claims, err)
+	}
+
+	if err := p.keys.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	token, _ = p.keys.sign(map[string]interface{}{"sub": "homer"})
+	if _, err := remote.Verify(token); err == nil {
+		t.Error("new keys should not be fetched again right away")
+	}
+	remote.fetchedAt = remote.fetchedAt.Add(-remoteKeysRefetchWait)
+	if _, err := remote.Verify(token); err != nil {
+		t.Errorf("token of a new key should verify after fetching the keys again: %v", err)
+	}
+	if _, err := remote.Verify(token[:len(token)-4] + "AAAA"); err == nil {
+		t.Error("token with invalid signature should not verify")
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 	"user-service/model"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/lib/pq"
 )
 
 type DatabaseRepository struct {
@@ -43,8 +45,12 @@ func NewDatabaseHandler() (DatabaseRepository, error) {
 
 	var databaseRepository DatabaseRepository
 	databaseRepository.connection = conn
-	databaseRepository.connection.AutoMigrate(&model.User{}, &model.Application{})
+	databaseRepository.connection.AutoMigrate(&model.User{}, &model.Application{}, &model.ReviewCampaign{}, &model.ReviewItem{}, &model.ClientSettingsOverride{}, &model.ConsentRevocation{}, &model.TrustedDevice{}, &model.MagicLink{}, &model.SessionRevocation{}, &model.FederatedSubject{})
 	databaseRepository.connection.Model(&model.Application{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+	databaseRepository.connection.Model(&model.ReviewItem{}).AddForeignKey("review_campaign_id", "review_campaigns(id)", "CASCADE", "CASCADE")
+	if err := databaseRepository.MigrateSubjects(os.Getenv("SUBJECT_MIGRATION") != "uuid"); err != nil {
+		return databaseRepository, err
+	}
 
 	return databaseRepository, nil
 }
@@ -61,6 +67,38 @@ func (repository *DatabaseRepository) FindByEmail(email string) (model.User, err
 	return person, err
 }
 
+func (repository *DatabaseRepository) FindBySubject(subject string) (model.User, error) {
+	var person model.User
+	err := repository.connection.Where("subject = ?", subject).Set("gorm:auto_preload", true).First(&person).Error
+	return person, err
+}
+
+// MigrateSubjects assigns a subject to users created before subjects existed,
+// keepUserName keeps the user name as subject so tokens of existing users do not change.
+// The username and email the user could log in with before are kept as legacy subjects of the user
+func (repository *DatabaseRepository) MigrateSubjects(keepUserName bool) error {
+	var users []model.User
+	if err := repository.connection.Where("subject IS NULL OR subject = ''").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		subject := model.NewSubject()
+		if keepUserName && user.UserName != "" {
+			subject = user.UserName
+		}
+		legacySubjects := pq.StringArray{}
+		for _, identifier := range []string{user.UserName, user.Email} {
+			if identifier != "" && identifier != subject {
+				legacySubjects = append(legacySubjects, identifier)
+			}
+		}
+		if err := repository.connection.Model(&user).UpdateColumns(map[string]interface{}{"subject": subject, "legacy_subjects": legacySubjects}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (repository *DatabaseRepository) FindByID(id uint) (model.User, error) {
 	var person model.User
 	err := repository.connection.Where("id = ?", id).Set("gorm:auto_preload", true).First(&person).Error
@@ -77,8 +115,8 @@ func (repository *DatabaseRepository) FindAllUsers() ([]model.User, error) {
 }
 
 // CreateUser requires an user with userName or eMail and password
-func (repository *DatabaseRepository) CreateUser(user model.User) (err error) {
-	err = repository.connection.Create(&user).Error
+func (repository *DatabaseRepository) CreateUser(user *model.User) (err error) {
+	err = repository.connection.Create(user).Error
 	return
 }
 
@@ -89,6 +127,23 @@ func (repository *DatabaseRepository) UpdateUser(user *model.User) (err error) {
 	return
 }
 
+// UpdateTOTPStep stores the time step of the last accepted TOTP code if it is newer than the stored one,
+// it reports whether the step was stored, so concurrent logins cannot accept the same code twice
+func (repository *DatabaseRepository) UpdateTOTPStep(userID uint, step int64) (bool, error) {
+	result := repository.connection.Model(&model.User{}).Where("id = ? AND totp_last_step < ?", userID, step).UpdateColumn("totp_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteUser removes the user together with the roles
+func (repository *DatabaseRepository) DeleteUser(user *model.User) (err error) {
+	err = repository.connection.Where("user_id = ?", user.ID).Delete(&model.Application{}).Error
+	if err != nil {
+		return
+	}
+	err = repository.connection.Delete(user).Error
+	return
+}
+
 // FindByEmailOrUserName returns user or error
 func (repository *DatabaseRepository) FindByEmailOrUserName(userName string) (model.User, error) {
 
@@ -117,6 +172,186 @@ func (repository *DatabaseRepository) FindUsersFromApplication(applicationName s
 
 }
 
+// CreateCampaign persists a campaign together with its items
+func (repository *DatabaseRepository) CreateCampaign(campaign *model.ReviewCampaign) error {
+	return repository.connection.Create(campaign).Error
+}
+
+// FindAllCampaigns returns all campaigns without their items
+func (repository *DatabaseRepository) FindAllCampaigns() ([]model.ReviewCampaign, error) {
+	var campaigns []model.ReviewCampaign
+	err := repository.connection.Order("created_at desc").Find(&campaigns).Error
+	return campaigns, err
+}
+
+// FindCampaignByID returns the campaign including all items
+func (repository *DatabaseRepository) FindCampaignByID(id uint) (model.ReviewCampaign, error) {
+	var campaign model.ReviewCampaign
+	err := repository.connection.Where("id = ?", id).Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("application_name, user_name, role")
+	}).First(&campaign).Error
+	return campaign, err
+}
+
+// UpdateCampaign persists the campaign without touching its items
+func (repository *DatabaseRepository) UpdateCampaign(campaign *model.ReviewCampaign) error {
+	return repository.connection.Set("gorm:association_autoupdate", false).Save(campaign).Error
+}
+
+// UpdateReviewItem persists a single review item
+func (repository *DatabaseRepository) UpdateReviewItem(item *model.ReviewItem) error {
+	return repository.connection.Save(item).Error
+}
+
+// FindAllClientSettingsOverrides returns the settings of all clients changed through the admin api
+func (repository *DatabaseRepository) FindAllClientSettingsOverrides() ([]model.ClientSettingsOverride, error) {
+	var overrides []model.ClientSettingsOverride
+	err := repository.connection.Order("client_id").Find(&overrides).Error
+	return overrides, err
+}
+
+// FindClientSettingsOverride returns the changed settings of a client
+func (repository *DatabaseRepository) FindClientSettingsOverride(clientID string) (model.ClientSettingsOverride, error) {
+	var override model.ClientSettingsOverride
+	err := repository.connection.Where("client_id = ?", clientID).First(&override).Error
+	return override, err
+}
+
+// SaveClientSettingsOverride creates or replaces the changed settings of a client
+func (repository *DatabaseRepository) SaveClientSettingsOverride(override *model.ClientSettingsOverride) error {
+	var existing model.ClientSettingsOverride
+	err := repository.connection.Where("client_id = ?", override.ClientID).First(&existing).Error
+	if err == nil {
+		override.ID = existing.ID
+		override.CreatedAt = existing.CreatedAt
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	return repository.connection.Save(override).Error
+}
+
+// DeleteClientSettingsOverride removes the changed settings of a client, the recorded consent revocations are kept
+func (repository *DatabaseRepository) DeleteClientSettingsOverride(clientID string) error {
+	return repository.connection.Unscoped().Where("client_id = ?", clientID).Delete(&model.ClientSettingsOverride{}).Error
+}
+
+// CreateConsentRevocation records a revoked consent
+func (repository *DatabaseRepository) CreateConsentRevocation(revocation *model.ConsentRevocation) error {
+	return repository.connection.Create(revocation).Error
+}
+
+// FindConsentRevocations returns all revoked consents of a user
+func (repository *DatabaseRepository) FindConsentRevocations(userID uint) ([]model.ConsentRevocation, error) {
+	var revocations []model.ConsentRevocation
+	err := repository.connection.Where("user_id = ?", userID).Order("created_at desc").Find(&revocations).Error
+	return revocations, err
+}
+
+// CreateSessionRevocation records a revocation of hydra sessions
+func (repository *DatabaseRepository) CreateSessionRevocation(revocation *model.SessionRevocation) error {
+	return repository.connection.Create(revocation).Error
+}
+
+// UpdateSessionRevocation stores the status of a revocation of hydra sessions
+func (repository *DatabaseRepository) UpdateSessionRevocation(revocation *model.SessionRevocation) error {
+	return repository.connection.Save(revocation).Error
+}
+
+// FindSessionRevocations returns the revocations of hydra sessions of a user, newest first
+func (repository *DatabaseRepository) FindSessionRevocations(userID uint) ([]model.SessionRevocation, error) {
+	var revocations []model.SessionRevocation
+	err := repository.connection.Where("user_id = ?", userID).Order("created_at desc, id desc").Find(&revocations).Error
+	return revocations, err
+}
+
+// CreateFederatedSubject links a subject of an upstream provider to a user
+func (repository *DatabaseRepository) CreateFederatedSubject(link *model.FederatedSubject) error {
+	return repository.connection.Create(link).Error
+}
+
+// FindFederatedSubject returns the link of a subject of an upstream provider
+func (repository *DatabaseRepository) FindFederatedSubject(issuer, subject string) (model.FederatedSubject, error) {
+	var link model.FederatedSubject
+	err := repository.connection.Where("issuer = ? AND subject = ?", issuer, subject).First(&link).Error
+	return link, err
+}
+
+// FindFederatedSubjects returns the upstream subjects linked to a user
+func (repository *DatabaseRepository) FindFederatedSubjects(userID uint) ([]model.FederatedSubject, error) {
+	var links []model.FederatedSubject
+	err := repository.connection.Where("user_id = ?", userID).Order("created_at").Find(&links).Error
+	return links, err
+}
+
+// DeleteFederatedSubject removes the link of an upstream subject from a user, all links of the user if issuer is empty
+func (repository *DatabaseRepository) DeleteFederatedSubject(userID uint, issuer, subject string) error {
+	if issuer == "" {
+		return repository.connection.Unscoped().Where("user_id = ?", userID).Delete(&model.FederatedSubject{}).Error
+	}
+	return repository.connection.Unscoped().Where("user_id = ? AND issuer = ? AND subject = ?", userID, issuer, subject).Delete(&model.FederatedSubject{}).Error
+}
+
+// CreateTrustedDevice stores a browser the user trusts
+func (repository *DatabaseRepository) CreateTrustedDevice(device *model.TrustedDevice) error {
+	return repository.connection.Create(device).Error
+}
+
+// UpdateTrustedDevice stores the last use of a trusted browser
+func (repository *DatabaseRepository) UpdateTrustedDevice(device *model.TrustedDevice) error {
+	return repository.connection.Save(device).Error
+}
+
+// FindTrustedDeviceByToken returns the trusted browser with the hash of its cookie token
+func (repository *DatabaseRepository) FindTrustedDeviceByToken(tokenHash string) (model.TrustedDevice, error) {
+	var device model.TrustedDevice
+	err := repository.connection.Where("token_hash = ?", tokenHash).First(&device).Error
+	return device, err
+}
+
+// FindTrustedDevices returns the browsers the user trusts which did not expire, newest first
+func (repository *DatabaseRepository) FindTrustedDevices(userID uint) ([]model.TrustedDevice, error) {
+	var devices []model.TrustedDevice
+	err := repository.connection.Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("created_at desc").Find(&devices).Error
+	return devices, err
+}
+
+// DeleteTrustedDevices removes a trusted browser of the user, all of them and the unused login links if deviceID is 0
+func (repository *DatabaseRepository) DeleteTrustedDevices(userID, deviceID uint) error {
+	if deviceID != 0 {
+		return repository.connection.Unscoped().Where("user_id = ? AND id = ?", userID, deviceID).Delete(&model.TrustedDevice{}).Error
+	}
+	if err := repository.connection.Unscoped().Where("user_id = ?", userID).Delete(&model.TrustedDevice{}).Error; err != nil {
+		return err
+	}
+	return repository.connection.Unscoped().Where("user_id = ?", userID).Delete(&model.MagicLink{}).Error
+}
+
+// CreateMagicLink stores a mailed login link
+func (repository *DatabaseRepository) CreateMagicLink(link *model.MagicLink) error {
+	return repository.connection.Create(link).Error
+}
+
+// FindMagicLinkByToken returns the login link with the hash of its token
+func (repository *DatabaseRepository) FindMagicLinkByToken(tokenHash string) (model.MagicLink, error) {
+	var link model.MagicLink
+	err := repository.connection.Where("token_hash = ?", tokenHash).First(&link).Error
+	return link, err
+}
+
+// UseMagicLink marks an unused login link as used, it fails if the link was used in the meantime
+func (repository *DatabaseRepository) UseMagicLink(link *model.MagicLink) error {
+	now := time.Now()
+	result := repository.connection.Model(link).Where("used_at IS NULL").Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("login link was already used")
+	}
+	link.UsedAt = &now
+	return nil
+}
+
 func (repository *DatabaseRepository) IsNotFoundError(err error) bool {
 	return gorm.IsRecordNotFoundError(err)
 }